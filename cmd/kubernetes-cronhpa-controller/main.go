@@ -21,18 +21,39 @@ import (
 	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis"
 	autoscalingv1beta1 "github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
 	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/controller"
+	cronhpawebhook "github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/webhook"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	klog "k8s.io/klog/v2"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strings"
 )
 
 var (
-	enableLeaderElection bool
-	pprofAddr            string
-	metricsAddr          string
+	enableLeaderElection      bool
+	enableWorkloadAnnotations bool
+	requireServiceAccount     bool
+	impersonateAuthor         bool
+	enableWebhook             bool
+	webhookPort               int
+	webhookCertDir            string
+	pauseConfigMap            string
+	inversePatchConfigMap     string
+	sizeSourceHosts           string
+	approvalNotifyHosts       string
+	externalScalerHosts       string
+	pprofAddr                 string
+	metricsAddr               string
 )
 
 func main() {
@@ -44,6 +65,8 @@ func main() {
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "kubernetes-cronhpa-controller",
 		MetricsBindAddress: metricsAddr,
+		Port:               webhookPort,
+		CertDir:            webhookCertDir,
 	})
 	if err != nil {
 		klog.Errorf("Failed to set up controller manager,because of %v", err)
@@ -57,14 +80,88 @@ func main() {
 		os.Exit(1)
 	}
 
+	reconciler := controller.NewReconciler(mgr)
+	reconciler.CronManager.RequireServiceAccount(requireServiceAccount)
+	if impersonateAuthor && !enableWebhook {
+		klog.Errorf("impersonateAuthor requires enableWebhook, the author annotation could be forged without the webhook")
+		os.Exit(1)
+	}
+	reconciler.CronManager.ImpersonateAuthors(impersonateAuthor)
+	if !enableWebhook && !requireServiceAccount {
+		klog.Warningf("Neither enableWebhook nor requireServiceAccount is set, the jobs change the targets with the identity of the controller and anyone who could create a cronHPA could scale or patch any object in the namespace.")
+	}
+	if pauseConfigMap != "" {
+		parts := strings.SplitN(pauseConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			klog.Errorf("Invalid pauseConfigMap %s, it should be <namespace>/<name>", pauseConfigMap)
+			os.Exit(1)
+		}
+		reconciler.CronManager.SetPauseConfigMap(parts[0], parts[1])
+	}
+	if inversePatchConfigMap != "" {
+		parts := strings.SplitN(inversePatchConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			klog.Errorf("Invalid inversePatchConfigMap %s, it should be <namespace>/<name>", inversePatchConfigMap)
+			os.Exit(1)
+		}
+		reconciler.CronManager.SetInversePatchConfigMap(parts[0], parts[1])
+	}
+	if sizeSourceHosts != "" {
+		reconciler.CronManager.SetSizeSourceHosts(strings.Split(sizeSourceHosts, ","))
+	}
+	if approvalNotifyHosts != "" {
+		reconciler.CronManager.SetApprovalNotifyHosts(strings.Split(approvalNotifyHosts, ","))
+	}
+	if externalScalerHosts != "" {
+		reconciler.CronManager.SetExternalScalerHosts(strings.Split(externalScalerHosts, ","))
+	}
 	err = ctrl.NewControllerManagedBy(mgr).
 		For(&autoscalingv1beta1.CronHorizontalPodAutoscaler{}).
-		Complete(controller.NewReconciler(mgr))
+		Watches(&source.Kind{Type: &autoscalingv1beta1.CronHPAProfile{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(reconciler.ProfileToRequests),
+		}).
+		Complete(reconciler)
 	if err != nil {
 		klog.Errorf("Failed to set up controller watch loop,because of %v", err)
 		os.Exit(1)
 	}
 
+	err = ctrl.NewControllerManagedBy(mgr).
+		For(&autoscalingv1beta1.ClusterCronHorizontalPodAutoscaler{}).
+		Complete(controller.NewClusterReconciler(mgr, reconciler.CronManager))
+	if err != nil {
+		klog.Errorf("Failed to set up clusterCronHPA controller watch loop,because of %v", err)
+		os.Exit(1)
+	}
+
+	if enableWorkloadAnnotations {
+		workloads := map[schema.GroupVersionKind]func() runtime.Object{
+			appsv1.SchemeGroupVersion.WithKind("Deployment"):  func() runtime.Object { return &appsv1.Deployment{} },
+			appsv1.SchemeGroupVersion.WithKind("StatefulSet"): func() runtime.Object { return &appsv1.StatefulSet{} },
+		}
+		for gvk, newObject := range workloads {
+			err = ctrl.NewControllerManagedBy(mgr).
+				For(newObject()).
+				Owns(&autoscalingv1beta1.CronHorizontalPodAutoscaler{}).
+				Complete(controller.NewWorkloadReconciler(mgr, gvk, newObject))
+			if err != nil {
+				klog.Errorf("Failed to set up %s annotation controller watch loop,because of %v", gvk.Kind, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if enableWebhook {
+		server := mgr.GetWebhookServer()
+		server.Register(cronhpawebhook.MutatePath, &webhook.Admission{Handler: &cronhpawebhook.AuthorAnnotator{}})
+		validators := admission.MultiValidatingHandler(
+			cronhpawebhook.NewTargetAuthorizer(mgr.GetClient(), mgr.GetRESTMapper()),
+			cronhpawebhook.NewPolicyValidator(mgr.GetClient(), mgr.GetRESTMapper(), dynamic.NewForConfigOrDie(mgr.GetConfig())),
+			cronhpawebhook.NewApprovalAuthorizer(mgr.GetClient()),
+		)
+		server.Register(cronhpawebhook.ValidatePath, &webhook.Admission{Handler: validators})
+	}
+
 	go func() {
 		http.ListenAndServe(pprofAddr, nil)
 	}()
@@ -78,5 +175,16 @@ func main() {
 
 func init() {
 	flag.BoolVar(&enableLeaderElection, "enableLeaderElection", false, "default false, if enabled the cronHPA would be in primary and standby mode.")
+	flag.BoolVar(&enableWorkloadAnnotations, "enableWorkloadAnnotations", false, "default false, if enabled the cronHPA would be generated from the cronhpa.alibabacloud.com/schedule annotation of Deployment and StatefulSet.")
+	flag.BoolVar(&requireServiceAccount, "requireServiceAccount", false, "default false, if enabled the cronHPA without serviceAccountName and the clusterCronHPA would be refused and every job impersonates the ServiceAccount.")
+	flag.BoolVar(&impersonateAuthor, "impersonateAuthor", false, "default false, if enabled the jobs of the cronHPA without serviceAccountName impersonate the author recorded by the webhook. it requires enableWebhook and the impersonate permission of users and groups.")
+	flag.BoolVar(&enableWebhook, "enableWebhook", false, "default false, if enabled the cronHPA would be rejected when the author could not scale the targets. see config/webhook.")
+	flag.IntVar(&webhookPort, "webhookPort", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhookCertDir", "/tmp/k8s-webhook-server/serving-certs", "The directory of tls.crt and tls.key of the webhook server.")
+	flag.StringVar(&pauseConfigMap, "pauseConfigMap", "kube-system/cronhpa-pause", "<namespace>/<name> of the ConfigMap pausing all jobs when its paused key is true, empty to disable.")
+	flag.StringVar(&inversePatchConfigMap, "inversePatchConfigMap", "kube-system/cronhpa-inverse-patches", "<namespace>/<name> of the ConfigMap keeping the inverse patches of the patch and vpa jobs, only the controller should be able to write it. empty to disable the revert action.")
+	flag.StringVar(&sizeSourceHosts, "sizeSourceHosts", "", "comma separated hosts(host or host:port, * for any) the http sources of targetSizeFrom are allowed to request from the network of the controller. empty to refuse the http sources.")
+	flag.StringVar(&approvalNotifyHosts, "approvalNotifyHosts", "", "comma separated hosts(host or host:port, * for any) the notifyURL of approval is allowed to post to from the network of the controller. empty to drop the notifications.")
+	flag.StringVar(&externalScalerHosts, "externalScalerHosts", "", "comma separated hosts(host or host:port, * for any) the external targets of the cronHPAs are allowed to dial from the network of the controller. empty to refuse the external targets.")
 	klog.InitFlags(nil)
 }
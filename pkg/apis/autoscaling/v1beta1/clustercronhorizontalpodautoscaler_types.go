@@ -0,0 +1,84 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCronHorizontalPodAutoscalerSpec defines the desired state of ClusterCronHorizontalPodAutoscaler
+type ClusterCronHorizontalPodAutoscalerSpec struct {
+	ExcludeDates []string `json:"excludeDates,omitempty"`
+	// NamespaceSelector selects the namespaces to scale, all namespaces are selected if it's empty.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// ScaleTargetSelector selects the targets to scale in every selected namespace.
+	ScaleTargetSelector ScaleTargetSelector `json:"scaleTargetSelector"`
+	Jobs                []Job               `json:"jobs"`
+}
+
+type ScaleTargetSelector struct {
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// all the targets of the kind are selected if it's empty.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// NamespaceSummary is the result of a job in one namespace.
+type NamespaceSummary struct {
+	Namespace string `json:"namespace"`
+	Targets   int32  `json:"targets"`
+	Succeed   int32  `json:"succeed"`
+	Failed    int32  `json:"failed"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type ClusterCondition struct {
+	Condition `json:",inline"`
+	// +optional
+	Namespaces []NamespaceSummary `json:"namespaces,omitempty"`
+}
+
+// ClusterCronHorizontalPodAutoscalerStatus defines the observed state of ClusterCronHorizontalPodAutoscaler
+type ClusterCronHorizontalPodAutoscalerStatus struct {
+	Conditions []ClusterCondition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=ccronhpa
+// ClusterCronHorizontalPodAutoscaler is the Schema for the clustercronhorizontalpodautoscalers API
+type ClusterCronHorizontalPodAutoscaler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCronHorizontalPodAutoscalerSpec   `json:"spec,omitempty"`
+	Status ClusterCronHorizontalPodAutoscalerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// ClusterCronHorizontalPodAutoscalerList contains a list of ClusterCronHorizontalPodAutoscaler
+type ClusterCronHorizontalPodAutoscalerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCronHorizontalPodAutoscaler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCronHorizontalPodAutoscaler{}, &ClusterCronHorizontalPodAutoscalerList{})
+}
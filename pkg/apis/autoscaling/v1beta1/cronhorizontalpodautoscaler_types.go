@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,22 +29,414 @@ type CronHorizontalPodAutoscalerSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	ExcludeDates   []string       `json:"excludeDates,omitempty"`
-	ScaleTargetRef ScaleTargetRef `json:"scaleTargetRef"`
-	Jobs           []Job          `json:"jobs"`
+	ScaleTargetRef ScaleTargetRef `json:"scaleTargetRef,omitempty"`
+	// Distribution splits the targetSize of every job across several targets.
+	// scaleTargetRef is ignored when distribution is set.
+	// +optional
+	Distribution *Distribution `json:"distribution,omitempty"`
+	// External scales a target outside of the cluster through an external scaler over gRPC.
+	// scaleTargetRef is ignored by the scale action when external is set.
+	// +optional
+	External *ExternalTarget `json:"external,omitempty"`
+	// Sleep configures the jobs with sleep and wake action.
+	// +optional
+	Sleep *SleepSpec `json:"sleep,omitempty"`
+	// ServiceAccountName in the namespace impersonated by the jobs to change the targets,
+	// so that the jobs could only do what the ServiceAccount is allowed to.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ProfileRef expands the jobs from a CronHPAProfile, jobs should be empty when it's set.
+	// +optional
+	ProfileRef *ProfileRef `json:"profileRef,omitempty"`
+	// Approval makes the large changes of the scale jobs wait for a human approval.
+	// +optional
+	Approval *ApprovalPolicy `json:"approval,omitempty"`
+	// Preflight checks a scale-up against the ResourceQuotas of the namespace and the capacity of the nodes.
+	// +optional
+	Preflight *PreflightPolicy `json:"preflight,omitempty"`
+	// PDB keeps the scale-downs within the PodDisruptionBudgets matching the pods of the targets.
+	// +optional
+	PDB *PDBPolicy `json:"pdb,omitempty"`
+	// ScaleDownPreference chooses the pods removed by the scale-downs of a Deployment or a ReplicaSet with the
+	// pod-deletion-cost annotation.
+	// +optional
+	ScaleDownPreference *ScaleDownPreference `json:"scaleDownPreference,omitempty"`
+	// WaitForRollout defers the scale jobs while the target is in a rollout or paused.
+	// +optional
+	WaitForRollout *RolloutWaitPolicy `json:"waitForRollout,omitempty"`
+	// +optional
+	Jobs []Job `json:"jobs,omitempty"`
+}
+
+// PreflightAction is what a scale-up does when the extra pods don't fit.
+type PreflightAction string
+
+const (
+	// scale to the target size and record a warning.
+	PreflightWarn PreflightAction = "Warn"
+	// scale to the replicas which fit.
+	PreflightCap PreflightAction = "Cap"
+	// fail the job without scaling.
+	PreflightAbort PreflightAction = "Abort"
+)
+
+type PreflightPolicy struct {
+	// action when the extra pods don't fit, default is Warn.
+	// +optional
+	Action PreflightAction `json:"action,omitempty"`
+	// skip the check of the allocatable capacity of the nodes, e.g. when cluster autoscaler adds nodes.
+	// +optional
+	SkipNodeCapacity bool `json:"skipNodeCapacity,omitempty"`
+}
+
+// PDBPolicy clamps a scale-down to the replicas the matching PodDisruptionBudgets require, resolving
+// minAvailable and maxUnavailable against the current replicas.
+type PDBPolicy struct {
+	// continue the scale-down in steps after the removed pods terminate, until the target size or the
+	// replicas the budgets require.
+	// +optional
+	StepWise bool `json:"stepWise,omitempty"`
+}
+
+// RolloutWaitPolicy defers a scale of a Deployment in a rollout or paused, or a StatefulSet whose pods are not all
+// updated, until the rollout completes or the timeout.
+type RolloutWaitPolicy struct {
+	// seconds the scale waits at most, the target is scaled after the timeout even if the rollout is not complete.
+	// Defaults to 600.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// ScaleDownStrategy is the order the pods are removed in by a scale-down.
+type ScaleDownStrategy string
+
+const (
+	// the newest pods are removed first.
+	ScaleDownNewest ScaleDownStrategy = "Newest"
+	// the pods on the nodes with the values of the node label are removed first, e.g. the spot nodes.
+	ScaleDownNodeLabel ScaleDownStrategy = "NodeLabel"
+	// the pods of the zones having the most pods are removed first, so the zones stay balanced.
+	ScaleDownZoneBalance ScaleDownStrategy = "ZoneBalance"
+)
+
+type ScaleDownPreference struct {
+	Strategy ScaleDownStrategy `json:"strategy"`
+	// node label of the NodeLabel strategy.
+	// +optional
+	NodeLabel string `json:"nodeLabel,omitempty"`
+	// values of the node label whose pods are removed first.
+	// +optional
+	Values []string `json:"values,omitempty"`
+}
+
+// PDBClampStatus is the clamp of a scale-down of one target.
+type PDBClampStatus struct {
+	ScaleTargetRef    `json:",inline"`
+	CurrentReplicas   int32 `json:"currentReplicas"`
+	RequestedReplicas int32 `json:"requestedReplicas"`
+	// replicas the scale-down stopped at, which the budgets require.
+	AllowedReplicas      int32    `json:"allowedReplicas"`
+	PodDisruptionBudgets []string `json:"podDisruptionBudgets,omitempty"`
+	// the scale-down continues in steps.
+	Stepping bool   `json:"stepping,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// PreflightStatus is the result of the preflight of a scale-up of one target.
+type PreflightStatus struct {
+	ScaleTargetRef `json:",inline"`
+	// Passed, Warned, Capped, Aborted or Skipped.
+	Decision          string `json:"decision"`
+	CurrentReplicas   int32  `json:"currentReplicas"`
+	RequestedReplicas int32  `json:"requestedReplicas"`
+	// replicas which fit into the quota and the nodes.
+	AllowedReplicas int32 `json:"allowedReplicas"`
+	// requests of the extra pods.
+	// +optional
+	ExtraCPU string `json:"extraCPU,omitempty"`
+	// +optional
+	ExtraMemory string `json:"extraMemory,omitempty"`
+	// extra pods allowed by the ResourceQuotas and the free capacity of the nodes, empty if not checked.
+	// +optional
+	QuotaAllows *int32 `json:"quotaAllows,omitempty"`
+	// +optional
+	NodesAllow *int32 `json:"nodesAllow,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ApprovalPolicy defines the thresholds of the changes needing approval, the thresholds not set are not checked.
+// A job is approved by adding its name to the cronhpa.alibabacloud.com/approve annotation.
+type ApprovalPolicy struct {
+	// a job scaling a target down by more than the percent of its current replicas needs approval.
+	// +optional
+	MaxScaleDownPercent *int32 `json:"maxScaleDownPercent,omitempty"`
+	// a job scaling a target to more than the replicas needs approval.
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+	// how long a job waits for the approval before it's expired, default is 3600.
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// URL receiving a POST of the job awaiting approval.
+	// +optional
+	NotifyURL string `json:"notifyURL,omitempty"`
 }
 
 type Job struct {
 	Name     string `json:"name"`
 	Schedule string `json:"schedule"`
 	// job will only run once if enabled.
-	RunOnce    bool  `json:"runOnce,omitempty"`
+	RunOnce bool `json:"runOnce,omitempty"`
+	// targetSize is ignored by the sleep and wake action.
+	// +optional
 	TargetSize int32 `json:"targetSize"`
+	// expression evaluated at fire time in place of targetSize, e.g. max(current, 20), ceil(current * 1.5) or hpa.max / 2.
+	// variables are current, previous, hpa.min, hpa.max and the spec fields of the target like spec.replicas.
+	// +optional
+	TargetSizeExpr string `json:"targetSizeExpr,omitempty"`
+	// source to read the target size from at fire time in place of targetSize.
+	// +optional
+	TargetSizeFrom *TargetSizeSource `json:"targetSizeFrom,omitempty"`
+	// action of the job, default is scale.
+	// +optional
+	Action JobAction `json:"action,omitempty"`
+	// patch applied by the patch action.
+	// +optional
+	Patch *PatchSpec `json:"patch,omitempty"`
+	// bounds and update mode applied to a VerticalPodAutoscaler by the vpa action.
+	// +optional
+	VPA *VPASpec `json:"vpa,omitempty"`
+	// name of the patch or vpa job whose inverse patch is applied by the revert action.
+	// +optional
+	RevertOf string `json:"revertOf,omitempty"`
+	// low priority balloon pods created ahead of the schedule, which the pods of the scale-up preempt.
+	// +optional
+	Prewarm *PrewarmSpec `json:"prewarm,omitempty"`
+	// pull the images of the pod template of the target onto the candidate nodes ahead of the schedule.
+	// +optional
+	PrepullImages *PrepullSpec `json:"prepullImages,omitempty"`
+	// the schedule is when the target should be Ready, the job fires earlier by the time the past scale-ups
+	// of the target took to become Ready.
+	// +optional
+	ReadyBy bool `json:"readyBy,omitempty"`
+}
+
+// PrepullSpec pulls the images with a DaemonSet running on the nodes matching the node selector and the
+// node affinity of the pod template of the target, the DaemonSet is deleted after the job runs.
+type PrepullSpec struct {
+	// how long before the schedule the images are pulled.
+	LeadSeconds int32 `json:"leadSeconds"`
+}
+
+// PrepullStatus is the progress of the image pre-pull of a job.
+type PrepullStatus struct {
+	DaemonSet string   `json:"daemonSet,omitempty"`
+	Images    []string `json:"images,omitempty"`
+	// nodes the DaemonSet runs on.
+	DesiredNodes int32 `json:"desiredNodes"`
+	// nodes which have pulled all images.
+	PulledNodes int32       `json:"pulledNodes"`
+	StartTime   metav1.Time `json:"startTime,omitempty"`
+	// the DaemonSet is deleted after the job runs.
+	CleanedUp bool   `json:"cleanedUp,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// PrewarmSpec reserves the capacity of a scale-up with balloon pods having the resource requests and the
+// scheduling constraints of the pod template of the target, so the nodes are added before the schedule.
+type PrewarmSpec struct {
+	// how long before the schedule the balloon pods are created.
+	LeadSeconds int32 `json:"leadSeconds"`
+	// number of balloon pods, default is targetSize minus the current replicas when they are created. At most 100.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// priority class of the balloon pods, default is cronhpa-balloon. Its value should be lower than the one of the target pods.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+type JobAction string
+
+const (
+	// ScaleAction scales the target to targetSize.
+	ScaleAction JobAction = "scale"
+	// SleepAction scales every scalable object in the namespace to 0 and records the original replicas.
+	SleepAction JobAction = "sleep"
+	// WakeAction restores every object scaled to 0 by the sleep action.
+	WakeAction JobAction = "wake"
+	// PatchAction applies the patch of the job to the target.
+	PatchAction JobAction = "patch"
+	// RevertAction applies the inverse patch stored by another patch or vpa job.
+	RevertAction JobAction = "revert"
+	// VPAAction changes the bounds or update mode of a VerticalPodAutoscaler and stores the previous values.
+	VPAAction JobAction = "vpa"
+)
+
+// ExternalTarget is served by an external scaler implementing the cronhpa.external.v1.ExternalScaler
+// gRPC service, e.g. a cloud node pool or the consumers of a managed queue.
+type ExternalTarget struct {
+	// address of the external scaler, e.g. nodepool-scaler.kube-system.svc:9090.
+	Address string `json:"address"`
+	// name of the target passed to the external scaler.
+	Name string `json:"name"`
+	// metadata passed to the external scaler with every call.
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// plaintext is used if tls is not set.
+	// +optional
+	TLS *ExternalTLS `json:"tls,omitempty"`
+	// timeout of every call, default is 10 seconds.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+type ExternalTLS struct {
+	// Secret in the namespace of the cronHPA with ca.crt, and tls.crt and tls.key for client certificate.
+	// the system roots are used if it's empty.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// server name to verify, default is the host of address.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// VPASpec is applied to a VerticalPodAutoscaler(autoscaling.k8s.io) in the namespace of the cronHPA.
+type VPASpec struct {
+	// name of the VerticalPodAutoscaler.
+	Name string `json:"name"`
+	// Off, Initial, Recreate or Auto.
+	// +optional
+	UpdateMode string `json:"updateMode,omitempty"`
+	// policies merged into resourcePolicy.containerPolicies by containerName.
+	// +optional
+	ContainerPolicies []VPAContainerPolicy `json:"containerPolicies,omitempty"`
+}
+
+type VPAContainerPolicy struct {
+	// name of the container or "*" for the default policy.
+	ContainerName string `json:"containerName"`
+	// +optional
+	MinAllowed v1.ResourceList `json:"minAllowed,omitempty"`
+	// +optional
+	MaxAllowed v1.ResourceList `json:"maxAllowed,omitempty"`
+}
+
+type PatchType string
+
+const (
+	StrategicMergePatch PatchType = "strategic"
+	MergePatch          PatchType = "merge"
+	JSONPatch           PatchType = "json"
+)
+
+type PatchSpec struct {
+	// type of the patch, default is strategic.
+	// +optional
+	Type PatchType `json:"type,omitempty"`
+	// the patch in JSON or YAML.
+	Patch string `json:"patch"`
+	// object in the namespace to patch, default is scaleTargetRef.
+	// +optional
+	Target *ScaleTargetRef `json:"target,omitempty"`
+	// store the inverse patch in status so that a revert job could restore the object.
+	// +optional
+	StoreInverse bool `json:"storeInverse,omitempty"`
+}
+
+// TargetSizeSource reads the target size from a ConfigMap key or a HTTP JSON endpoint.
+// Only one of configMapKeyRef and http could be set.
+type TargetSizeSource struct {
+	// key of a ConfigMap in the namespace of the cronHPA.
+	// +optional
+	ConfigMapKeyRef *v1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// +optional
+	HTTP *HTTPTargetSizeSource `json:"http,omitempty"`
+	// lower bound of the size.
+	// +optional
+	Min *int32 `json:"min,omitempty"`
+	// upper bound of the size.
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+	// size used when the source is unavailable, the job fails if it's not set.
+	// +optional
+	Fallback *int32 `json:"fallback,omitempty"`
+}
+
+type HTTPTargetSizeSource struct {
+	// url of the endpoint returning JSON.
+	URL string `json:"url"`
+	// JSONPath of the size in the response, e.g. {.web.replicas}
+	JSONPath string `json:"jsonPath"`
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// default is 10 seconds.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+type SleepSpec struct {
+	// objects with the label are skipped by the sleep action, default is cronhpa.alibabacloud.com/sleep-exclude.
+	// +optional
+	ExcludeLabel string `json:"excludeLabel,omitempty"`
 }
 
 type ScaleTargetRef struct {
 	ApiVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Name       string `json:"name"`
+	// JSON pointer of the replicas field, e.g. /spec/parallelism of a Job.
+	// the field is patched directly for targets without scale subresource.
+	// +optional
+	ReplicasPath string `json:"replicasPath,omitempty"`
+	// remote cluster of the target, the target is in the cluster of the controller if it's not set.
+	// +optional
+	Cluster *ClusterRef `json:"cluster,omitempty"`
+}
+
+// ClusterRef is a remote cluster reached with the kubeconfig in a Secret in the namespace of the cronHPA.
+type ClusterRef struct {
+	// name of the Secret.
+	SecretName string `json:"secretName"`
+	// key of the kubeconfig in the Secret, default is kubeconfig.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// namespace of the target in the remote cluster, default is the namespace of the cronHPA.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ClusterStatus is the connection health of a remote cluster when it's used the last time.
+type ClusterStatus struct {
+	// name of the Secret of the cluster.
+	Name          string      `json:"name"`
+	Healthy       bool        `json:"healthy"`
+	LastProbeTime metav1.Time `json:"lastProbeTime"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type Distribution struct {
+	Targets []DistributionTarget `json:"targets"`
+}
+
+// DistributionTarget is one of the workloads sharing the targetSize of a job.
+// Either weight or percentage should be used by all targets of a distribution.
+type DistributionTarget struct {
+	ScaleTargetRef `json:",inline"`
+	// relative weight of the target.
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+	// share of the target in percent, percentages of all targets must sum up to 100.
+	// +optional
+	Percentage int32 `json:"percentage,omitempty"`
+}
+
+// TargetSizeStatus is the computed size of one target of a distribution.
+type TargetSizeStatus struct {
+	ScaleTargetRef `json:",inline"`
+	TargetSize     int32 `json:"targetSize"`
 }
 
 type JobState string
@@ -52,6 +445,14 @@ const (
 	Succeed   JobState = "Succeed"
 	Failed    JobState = "Failed"
 	Submitted JobState = "Submitted"
+	// the job is skipped by a CronHPAFreeze or the global pause.
+	Frozen JobState = "Frozen"
+	// the job waits for the approval of a large change.
+	AwaitingApproval JobState = "AwaitingApproval"
+	// the job is not approved before the deadline.
+	Expired JobState = "Expired"
+	// the job waits for the rollout of the target.
+	Deferred JobState = "Deferred"
 )
 
 type Condition struct {
@@ -73,6 +474,50 @@ type Condition struct {
 	// Human readable message indicating details about last transition.
 	// +optional
 	Message string `json:"message"`
+
+	// computed size of every target when the job is distributed.
+	// +optional
+	Distribution []TargetSizeStatus `json:"distribution,omitempty"`
+
+	// +optional
+	TargetSizeExpr string `json:"targetSizeExpr,omitempty"`
+
+	// result of the last evaluation of targetSizeExpr or targetSizeFrom.
+	// +optional
+	EvaluatedSize *int32 `json:"evaluatedSize,omitempty"`
+
+	// where the last size of targetSizeFrom came from.
+	// +optional
+	SizeSource string `json:"sizeSource,omitempty"`
+	// inverse of the last patch applied by the job.
+	// +optional
+	InversePatch *InversePatch `json:"inversePatch,omitempty"`
+	// deadline of the approval of the job awaiting approval.
+	// +optional
+	ApprovalDeadline *metav1.Time `json:"approvalDeadline,omitempty"`
+	// preflight of the scale-ups of the last execution.
+	// +optional
+	Preflight []PreflightStatus `json:"preflight,omitempty"`
+	// progress of the image pre-pull before the last execution.
+	// +optional
+	Prepull *PrepullStatus `json:"prepull,omitempty"`
+	// +optional
+	ReadyBy *ReadyByStatus `json:"readyBy,omitempty"`
+	// clamps of the scale-downs of the last execution by the PodDisruptionBudgets.
+	// +optional
+	PDBClamps []PDBClampStatus `json:"pdbClamps,omitempty"`
+	// deadline of the wait for the rollout of the deferred job.
+	// +optional
+	DeferredUntil *metav1.Time `json:"deferredUntil,omitempty"`
+}
+
+// InversePatch is a patch restoring the fields changed by a patch job.
+type InversePatch struct {
+	Target ScaleTargetRef `json:"target"`
+	Patch  string         `json:"patch"`
+	// json for a json patch testing the patched values before restoring them, merge if empty.
+	// +optional
+	Type PatchType `json:"type,omitempty"`
 }
 
 // CronHorizontalPodAutoscalerStatus defines the observed state of CronHorizontalPodAutoscaler
@@ -82,6 +527,42 @@ type CronHorizontalPodAutoscalerStatus struct {
 	ExcludeDates   []string       `json:"excludeDates,omitempty"`
 	// Important: Run "make" to regenerate code after modifying this file
 	Conditions []Condition `json:"conditions,omitempty"`
+	// +optional
+	Sleep *SleepStatus `json:"sleep,omitempty"`
+	// health of the remote clusters of the targets.
+	// +optional
+	Clusters []ClusterStatus `json:"clusters,omitempty"`
+	// seconds the last scale-ups of the readyBy jobs took until the target was Ready, the latest last.
+	// +optional
+	ReadyDurations []int32 `json:"readyDurations,omitempty"`
+}
+
+// ReadyByStatus is the lead time of a readyBy job.
+type ReadyByStatus struct {
+	// seconds the job fires before the schedule.
+	LeadSeconds int32 `json:"leadSeconds"`
+	// number of the measured scale-ups the lead time is learned from.
+	Samples int32 `json:"samples"`
+	// next time the target should be Ready.
+	// +optional
+	ScheduledTime *metav1.Time `json:"scheduledTime,omitempty"`
+	// next time the job fires.
+	// +optional
+	EffectiveFireTime *metav1.Time `json:"effectiveFireTime,omitempty"`
+}
+
+// SleepStatus is the state of the namespace after the last sleep or wake.
+type SleepStatus struct {
+	Asleep             bool        `json:"asleep"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// objects scaled to 0 by the last sleep and their original replicas.
+	// +optional
+	Objects []SleptObject `json:"objects,omitempty"`
+}
+
+type SleptObject struct {
+	ScaleTargetRef `json:",inline"`
+	Replicas       int32 `json:"replicas"`
 }
 
 // +kubebuilder:object:root=true
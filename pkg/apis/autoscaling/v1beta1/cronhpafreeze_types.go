@@ -0,0 +1,65 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CronHPAFreezeSpec defines a window in which the jobs of the selected cronHPAs are skipped.
+type CronHPAFreezeSpec struct {
+	// start of the window, the freeze begins once it's created if it's not set.
+	// +optional
+	Start *metav1.Time `json:"start,omitempty"`
+	// end of the window, the freeze lasts until it's deleted if it's not set.
+	// +optional
+	End *metav1.Time `json:"end,omitempty"`
+	// namespaces the freeze applies to, all namespaces if it's not set.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// labels of the cronHPAs the freeze applies to, all cronHPAs if it's not set.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// run the last job missed by every cronHPA when the freeze ends.
+	// +optional
+	ReplayMissedJobs bool `json:"replayMissedJobs,omitempty"`
+	// shown in the status of the skipped jobs, e.g. the incident or change freeze.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cronhpafreeze
+// CronHPAFreeze is the Schema for the cronhpafreezes API
+type CronHPAFreeze struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CronHPAFreezeSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// CronHPAFreezeList contains a list of CronHPAFreeze
+type CronHPAFreezeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CronHPAFreeze `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CronHPAFreeze{}, &CronHPAFreezeList{})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CronHPAPolicySpec defines the limits of the CronHorizontalPodAutoscalers in the selected namespaces.
+// The limits not set are not checked.
+type CronHPAPolicySpec struct {
+	// namespaces the policy applies to, all namespaces if it's not set.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// maximum target size of a job on one target.
+	// +optional
+	MaxReplicasPerTarget *int32 `json:"maxReplicasPerTarget,omitempty"`
+	// maximum sum of the target sizes scheduled by the cronHPAs in a namespace.
+	// +optional
+	MaxReplicasPerNamespace *int32 `json:"maxReplicasPerNamespace,omitempty"`
+	// the targets with the labels could not be scaled to 0.
+	// +optional
+	CriticalWorkloadSelector *metav1.LabelSelector `json:"criticalWorkloadSelector,omitempty"`
+	// minimum interval between two jobs on the same target.
+	// +optional
+	MinJobIntervalSeconds *int32 `json:"minJobIntervalSeconds,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cronhpapolicy
+// CronHPAPolicy is the Schema for the cronhpapolicies API
+type CronHPAPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CronHPAPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// CronHPAPolicyList contains a list of CronHPAPolicy
+type CronHPAPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CronHPAPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CronHPAPolicy{}, &CronHPAPolicyList{})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CronHPAProfileSpec defines the jobs shared by the CronHorizontalPodAutoscalers referencing the profile
+type CronHPAProfileSpec struct {
+	// parameters which could be used as the targetSize of jobs.
+	// +optional
+	Parameters []ProfileParameter `json:"parameters,omitempty"`
+	Jobs       []ProfileJob       `json:"jobs"`
+}
+
+type ProfileParameter struct {
+	Name string `json:"name"`
+	// value used when the referencing cronHPA doesn't set the parameter.
+	// +optional
+	Default *int32 `json:"default,omitempty"`
+}
+
+type ProfileJob struct {
+	Job `json:",inline"`
+	// name of the parameter which gives the targetSize, targetSize is ignored if it's set.
+	// +optional
+	TargetSizeParameter string `json:"targetSizeParameter,omitempty"`
+}
+
+// ProfileRef references a CronHPAProfile in the same namespace.
+type ProfileRef struct {
+	Name string `json:"name"`
+	// values of the parameters defined by the profile.
+	// +optional
+	Parameters map[string]int32 `json:"parameters,omitempty"`
+	// jobs which replace the jobs of the profile with the same name, or are appended if no such job.
+	// +optional
+	Overrides []Job `json:"overrides,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=cronhpaprofile
+// CronHPAProfile is the Schema for the cronhpaprofiles API
+type CronHPAProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CronHPAProfileSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// CronHPAProfileList contains a list of CronHPAProfile
+type CronHPAProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CronHPAProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CronHPAProfile{}, &CronHPAProfileList{})
+}
@@ -21,27 +21,64 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Condition) DeepCopyInto(out *Condition) {
+func (in *ApprovalPolicy) DeepCopyInto(out *ApprovalPolicy) {
 	*out = *in
-	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	if in.MaxScaleDownPercent != nil {
+		in, out := &in.MaxScaleDownPercent, &out.MaxScaleDownPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
-func (in *Condition) DeepCopy() *Condition {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalPolicy.
+func (in *ApprovalPolicy) DeepCopy() *ApprovalPolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(Condition)
+	out := new(ApprovalPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CronHorizontalPodAutoscaler) DeepCopyInto(out *CronHorizontalPodAutoscaler) {
+func (in *ClusterCondition) DeepCopyInto(out *ClusterCondition) {
+	*out = *in
+	in.Condition.DeepCopyInto(&out.Condition)
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]NamespaceSummary, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCondition.
+func (in *ClusterCondition) DeepCopy() *ClusterCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCronHorizontalPodAutoscaler) DeepCopyInto(out *ClusterCronHorizontalPodAutoscaler) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
@@ -49,18 +86,18 @@ func (in *CronHorizontalPodAutoscaler) DeepCopyInto(out *CronHorizontalPodAutosc
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscaler.
-func (in *CronHorizontalPodAutoscaler) DeepCopy() *CronHorizontalPodAutoscaler {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCronHorizontalPodAutoscaler.
+func (in *ClusterCronHorizontalPodAutoscaler) DeepCopy() *ClusterCronHorizontalPodAutoscaler {
 	if in == nil {
 		return nil
 	}
-	out := new(CronHorizontalPodAutoscaler)
+	out := new(ClusterCronHorizontalPodAutoscaler)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CronHorizontalPodAutoscaler) DeepCopyObject() runtime.Object {
+func (in *ClusterCronHorizontalPodAutoscaler) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -68,31 +105,31 @@ func (in *CronHorizontalPodAutoscaler) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CronHorizontalPodAutoscalerList) DeepCopyInto(out *CronHorizontalPodAutoscalerList) {
+func (in *ClusterCronHorizontalPodAutoscalerList) DeepCopyInto(out *ClusterCronHorizontalPodAutoscalerList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]CronHorizontalPodAutoscaler, len(*in))
+		*out = make([]ClusterCronHorizontalPodAutoscaler, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerList.
-func (in *CronHorizontalPodAutoscalerList) DeepCopy() *CronHorizontalPodAutoscalerList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCronHorizontalPodAutoscalerList.
+func (in *ClusterCronHorizontalPodAutoscalerList) DeepCopy() *ClusterCronHorizontalPodAutoscalerList {
 	if in == nil {
 		return nil
 	}
-	out := new(CronHorizontalPodAutoscalerList)
+	out := new(ClusterCronHorizontalPodAutoscalerList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CronHorizontalPodAutoscalerList) DeepCopyObject() runtime.Object {
+func (in *ClusterCronHorizontalPodAutoscalerList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -100,85 +137,1255 @@ func (in *CronHorizontalPodAutoscalerList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CronHorizontalPodAutoscalerSpec) DeepCopyInto(out *CronHorizontalPodAutoscalerSpec) {
+func (in *ClusterCronHorizontalPodAutoscalerSpec) DeepCopyInto(out *ClusterCronHorizontalPodAutoscalerSpec) {
 	*out = *in
 	if in.ExcludeDates != nil {
 		in, out := &in.ExcludeDates, &out.ExcludeDates
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	out.ScaleTargetRef = in.ScaleTargetRef
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.ScaleTargetSelector.DeepCopyInto(&out.ScaleTargetSelector)
 	if in.Jobs != nil {
 		in, out := &in.Jobs, &out.Jobs
 		*out = make([]Job, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerSpec.
-func (in *CronHorizontalPodAutoscalerSpec) DeepCopy() *CronHorizontalPodAutoscalerSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCronHorizontalPodAutoscalerSpec.
+func (in *ClusterCronHorizontalPodAutoscalerSpec) DeepCopy() *ClusterCronHorizontalPodAutoscalerSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(CronHorizontalPodAutoscalerSpec)
+	out := new(ClusterCronHorizontalPodAutoscalerSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CronHorizontalPodAutoscalerStatus) DeepCopyInto(out *CronHorizontalPodAutoscalerStatus) {
+func (in *ClusterCronHorizontalPodAutoscalerStatus) DeepCopyInto(out *ClusterCronHorizontalPodAutoscalerStatus) {
 	*out = *in
-	out.ScaleTargetRef = in.ScaleTargetRef
-	if in.ExcludeDates != nil {
-		in, out := &in.ExcludeDates, &out.ExcludeDates
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]Condition, len(*in))
+		*out = make([]ClusterCondition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerStatus.
-func (in *CronHorizontalPodAutoscalerStatus) DeepCopy() *CronHorizontalPodAutoscalerStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCronHorizontalPodAutoscalerStatus.
+func (in *ClusterCronHorizontalPodAutoscalerStatus) DeepCopy() *ClusterCronHorizontalPodAutoscalerStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(CronHorizontalPodAutoscalerStatus)
+	out := new(ClusterCronHorizontalPodAutoscalerStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Job) DeepCopyInto(out *Job) {
+func (in *ClusterRef) DeepCopyInto(out *ClusterRef) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Job.
-func (in *Job) DeepCopy() *Job {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRef.
+func (in *ClusterRef) DeepCopy() *ClusterRef {
 	if in == nil {
 		return nil
 	}
-	out := new(Job)
+	out := new(ClusterRef)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ScaleTargetRef) DeepCopyInto(out *ScaleTargetRef) {
+func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleTargetRef.
-func (in *ScaleTargetRef) DeepCopy() *ScaleTargetRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
+func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(ScaleTargetRef)
+	out := new(ClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	if in.Distribution != nil {
+		in, out := &in.Distribution, &out.Distribution
+		*out = make([]TargetSizeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EvaluatedSize != nil {
+		in, out := &in.EvaluatedSize, &out.EvaluatedSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.InversePatch != nil {
+		in, out := &in.InversePatch, &out.InversePatch
+		*out = new(InversePatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApprovalDeadline != nil {
+		in, out := &in.ApprovalDeadline, &out.ApprovalDeadline
+		*out = (*in).DeepCopy()
+	}
+	if in.Preflight != nil {
+		in, out := &in.Preflight, &out.Preflight
+		*out = make([]PreflightStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Prepull != nil {
+		in, out := &in.Prepull, &out.Prepull
+		*out = new(PrepullStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadyBy != nil {
+		in, out := &in.ReadyBy, &out.ReadyBy
+		*out = new(ReadyByStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PDBClamps != nil {
+		in, out := &in.PDBClamps, &out.PDBClamps
+		*out = make([]PDBClampStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeferredUntil != nil {
+		in, out := &in.DeferredUntil, &out.DeferredUntil
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAFreeze) DeepCopyInto(out *CronHPAFreeze) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAFreeze.
+func (in *CronHPAFreeze) DeepCopy() *CronHPAFreeze {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAFreeze)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAFreeze) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAFreezeList) DeepCopyInto(out *CronHPAFreezeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CronHPAFreeze, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAFreezeList.
+func (in *CronHPAFreezeList) DeepCopy() *CronHPAFreezeList {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAFreezeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAFreezeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAFreezeSpec) DeepCopyInto(out *CronHPAFreezeSpec) {
+	*out = *in
+	if in.Start != nil {
+		in, out := &in.Start, &out.Start
+		*out = (*in).DeepCopy()
+	}
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = (*in).DeepCopy()
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAFreezeSpec.
+func (in *CronHPAFreezeSpec) DeepCopy() *CronHPAFreezeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAFreezeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAPolicy) DeepCopyInto(out *CronHPAPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAPolicy.
+func (in *CronHPAPolicy) DeepCopy() *CronHPAPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAPolicyList) DeepCopyInto(out *CronHPAPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CronHPAPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAPolicyList.
+func (in *CronHPAPolicyList) DeepCopy() *CronHPAPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAPolicySpec) DeepCopyInto(out *CronHPAPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxReplicasPerTarget != nil {
+		in, out := &in.MaxReplicasPerTarget, &out.MaxReplicasPerTarget
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicasPerNamespace != nil {
+		in, out := &in.MaxReplicasPerNamespace, &out.MaxReplicasPerNamespace
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CriticalWorkloadSelector != nil {
+		in, out := &in.CriticalWorkloadSelector, &out.CriticalWorkloadSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MinJobIntervalSeconds != nil {
+		in, out := &in.MinJobIntervalSeconds, &out.MinJobIntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAPolicySpec.
+func (in *CronHPAPolicySpec) DeepCopy() *CronHPAPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAProfile) DeepCopyInto(out *CronHPAProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAProfile.
+func (in *CronHPAProfile) DeepCopy() *CronHPAProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAProfileList) DeepCopyInto(out *CronHPAProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CronHPAProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAProfileList.
+func (in *CronHPAProfileList) DeepCopy() *CronHPAProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHPAProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHPAProfileSpec) DeepCopyInto(out *CronHPAProfileSpec) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]ProfileParameter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Jobs != nil {
+		in, out := &in.Jobs, &out.Jobs
+		*out = make([]ProfileJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHPAProfileSpec.
+func (in *CronHPAProfileSpec) DeepCopy() *CronHPAProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHPAProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHorizontalPodAutoscaler) DeepCopyInto(out *CronHorizontalPodAutoscaler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscaler.
+func (in *CronHorizontalPodAutoscaler) DeepCopy() *CronHorizontalPodAutoscaler {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHorizontalPodAutoscaler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHorizontalPodAutoscaler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHorizontalPodAutoscalerList) DeepCopyInto(out *CronHorizontalPodAutoscalerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CronHorizontalPodAutoscaler, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerList.
+func (in *CronHorizontalPodAutoscalerList) DeepCopy() *CronHorizontalPodAutoscalerList {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHorizontalPodAutoscalerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CronHorizontalPodAutoscalerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHorizontalPodAutoscalerSpec) DeepCopyInto(out *CronHorizontalPodAutoscalerSpec) {
+	*out = *in
+	if in.ExcludeDates != nil {
+		in, out := &in.ExcludeDates, &out.ExcludeDates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+	if in.Distribution != nil {
+		in, out := &in.Distribution, &out.Distribution
+		*out = new(Distribution)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(ExternalTarget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sleep != nil {
+		in, out := &in.Sleep, &out.Sleep
+		*out = new(SleepSpec)
+		**out = **in
+	}
+	if in.ProfileRef != nil {
+		in, out := &in.ProfileRef, &out.ProfileRef
+		*out = new(ProfileRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Preflight != nil {
+		in, out := &in.Preflight, &out.Preflight
+		*out = new(PreflightPolicy)
+		**out = **in
+	}
+	if in.PDB != nil {
+		in, out := &in.PDB, &out.PDB
+		*out = new(PDBPolicy)
+		**out = **in
+	}
+	if in.ScaleDownPreference != nil {
+		in, out := &in.ScaleDownPreference, &out.ScaleDownPreference
+		*out = new(ScaleDownPreference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WaitForRollout != nil {
+		in, out := &in.WaitForRollout, &out.WaitForRollout
+		*out = new(RolloutWaitPolicy)
+		**out = **in
+	}
+	if in.Jobs != nil {
+		in, out := &in.Jobs, &out.Jobs
+		*out = make([]Job, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerSpec.
+func (in *CronHorizontalPodAutoscalerSpec) DeepCopy() *CronHorizontalPodAutoscalerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHorizontalPodAutoscalerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronHorizontalPodAutoscalerStatus) DeepCopyInto(out *CronHorizontalPodAutoscalerStatus) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+	if in.ExcludeDates != nil {
+		in, out := &in.ExcludeDates, &out.ExcludeDates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sleep != nil {
+		in, out := &in.Sleep, &out.Sleep
+		*out = new(SleepStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ReadyDurations != nil {
+		in, out := &in.ReadyDurations, &out.ReadyDurations
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronHorizontalPodAutoscalerStatus.
+func (in *CronHorizontalPodAutoscalerStatus) DeepCopy() *CronHorizontalPodAutoscalerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CronHorizontalPodAutoscalerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Distribution) DeepCopyInto(out *Distribution) {
+	*out = *in
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]DistributionTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Distribution.
+func (in *Distribution) DeepCopy() *Distribution {
+	if in == nil {
+		return nil
+	}
+	out := new(Distribution)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DistributionTarget) DeepCopyInto(out *DistributionTarget) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DistributionTarget.
+func (in *DistributionTarget) DeepCopy() *DistributionTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(DistributionTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalTLS) DeepCopyInto(out *ExternalTLS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalTLS.
+func (in *ExternalTLS) DeepCopy() *ExternalTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalTarget) DeepCopyInto(out *ExternalTarget) {
+	*out = *in
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(ExternalTLS)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalTarget.
+func (in *ExternalTarget) DeepCopy() *ExternalTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPTargetSizeSource) DeepCopyInto(out *HTTPTargetSizeSource) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPTargetSizeSource.
+func (in *HTTPTargetSizeSource) DeepCopy() *HTTPTargetSizeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPTargetSizeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InversePatch) DeepCopyInto(out *InversePatch) {
+	*out = *in
+	in.Target.DeepCopyInto(&out.Target)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InversePatch.
+func (in *InversePatch) DeepCopy() *InversePatch {
+	if in == nil {
+		return nil
+	}
+	out := new(InversePatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Job) DeepCopyInto(out *Job) {
+	*out = *in
+	if in.TargetSizeFrom != nil {
+		in, out := &in.TargetSizeFrom, &out.TargetSizeFrom
+		*out = new(TargetSizeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Patch != nil {
+		in, out := &in.Patch, &out.Patch
+		*out = new(PatchSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VPA != nil {
+		in, out := &in.VPA, &out.VPA
+		*out = new(VPASpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prewarm != nil {
+		in, out := &in.Prewarm, &out.Prewarm
+		*out = new(PrewarmSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PrepullImages != nil {
+		in, out := &in.PrepullImages, &out.PrepullImages
+		*out = new(PrepullSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Job.
+func (in *Job) DeepCopy() *Job {
+	if in == nil {
+		return nil
+	}
+	out := new(Job)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceSummary) DeepCopyInto(out *NamespaceSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceSummary.
+func (in *NamespaceSummary) DeepCopy() *NamespaceSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PDBClampStatus) DeepCopyInto(out *PDBClampStatus) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+	if in.PodDisruptionBudgets != nil {
+		in, out := &in.PodDisruptionBudgets, &out.PodDisruptionBudgets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PDBClampStatus.
+func (in *PDBClampStatus) DeepCopy() *PDBClampStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PDBClampStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PDBPolicy) DeepCopyInto(out *PDBPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PDBPolicy.
+func (in *PDBPolicy) DeepCopy() *PDBPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PDBPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchSpec) DeepCopyInto(out *PatchSpec) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(ScaleTargetRef)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchSpec.
+func (in *PatchSpec) DeepCopy() *PatchSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightPolicy) DeepCopyInto(out *PreflightPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightPolicy.
+func (in *PreflightPolicy) DeepCopy() *PreflightPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreflightStatus) DeepCopyInto(out *PreflightStatus) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+	if in.QuotaAllows != nil {
+		in, out := &in.QuotaAllows, &out.QuotaAllows
+		*out = new(int32)
+		**out = **in
+	}
+	if in.NodesAllow != nil {
+		in, out := &in.NodesAllow, &out.NodesAllow
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreflightStatus.
+func (in *PreflightStatus) DeepCopy() *PreflightStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PreflightStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrepullSpec) DeepCopyInto(out *PrepullSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrepullSpec.
+func (in *PrepullSpec) DeepCopy() *PrepullSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PrepullSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrepullStatus) DeepCopyInto(out *PrepullStatus) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrepullStatus.
+func (in *PrepullStatus) DeepCopy() *PrepullStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PrepullStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrewarmSpec) DeepCopyInto(out *PrewarmSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrewarmSpec.
+func (in *PrewarmSpec) DeepCopy() *PrewarmSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PrewarmSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileJob) DeepCopyInto(out *ProfileJob) {
+	*out = *in
+	in.Job.DeepCopyInto(&out.Job)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileJob.
+func (in *ProfileJob) DeepCopy() *ProfileJob {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileParameter) DeepCopyInto(out *ProfileParameter) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileParameter.
+func (in *ProfileParameter) DeepCopy() *ProfileParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileRef) DeepCopyInto(out *ProfileRef) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]Job, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileRef.
+func (in *ProfileRef) DeepCopy() *ProfileRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadyByStatus) DeepCopyInto(out *ReadyByStatus) {
+	*out = *in
+	if in.ScheduledTime != nil {
+		in, out := &in.ScheduledTime, &out.ScheduledTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EffectiveFireTime != nil {
+		in, out := &in.EffectiveFireTime, &out.EffectiveFireTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadyByStatus.
+func (in *ReadyByStatus) DeepCopy() *ReadyByStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadyByStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutWaitPolicy) DeepCopyInto(out *RolloutWaitPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutWaitPolicy.
+func (in *RolloutWaitPolicy) DeepCopy() *RolloutWaitPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutWaitPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleDownPreference) DeepCopyInto(out *ScaleDownPreference) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleDownPreference.
+func (in *ScaleDownPreference) DeepCopy() *ScaleDownPreference {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleDownPreference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleTargetRef) DeepCopyInto(out *ScaleTargetRef) {
+	*out = *in
+	if in.Cluster != nil {
+		in, out := &in.Cluster, &out.Cluster
+		*out = new(ClusterRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleTargetRef.
+func (in *ScaleTargetRef) DeepCopy() *ScaleTargetRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleTargetRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleTargetSelector) DeepCopyInto(out *ScaleTargetSelector) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleTargetSelector.
+func (in *ScaleTargetSelector) DeepCopy() *ScaleTargetSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleTargetSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SleepSpec) DeepCopyInto(out *SleepSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SleepSpec.
+func (in *SleepSpec) DeepCopy() *SleepSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SleepSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SleepStatus) DeepCopyInto(out *SleepStatus) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]SleptObject, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SleepStatus.
+func (in *SleepStatus) DeepCopy() *SleepStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SleepStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SleptObject) DeepCopyInto(out *SleptObject) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SleptObject.
+func (in *SleptObject) DeepCopy() *SleptObject {
+	if in == nil {
+		return nil
+	}
+	out := new(SleptObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetSizeSource) DeepCopyInto(out *TargetSizeSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPTargetSizeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Fallback != nil {
+		in, out := &in.Fallback, &out.Fallback
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetSizeSource.
+func (in *TargetSizeSource) DeepCopy() *TargetSizeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetSizeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetSizeStatus) DeepCopyInto(out *TargetSizeStatus) {
+	*out = *in
+	in.ScaleTargetRef.DeepCopyInto(&out.ScaleTargetRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetSizeStatus.
+func (in *TargetSizeStatus) DeepCopy() *TargetSizeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetSizeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPAContainerPolicy) DeepCopyInto(out *VPAContainerPolicy) {
+	*out = *in
+	if in.MinAllowed != nil {
+		in, out := &in.MinAllowed, &out.MinAllowed
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxAllowed != nil {
+		in, out := &in.MaxAllowed, &out.MaxAllowed
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPAContainerPolicy.
+func (in *VPAContainerPolicy) DeepCopy() *VPAContainerPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(VPAContainerPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPASpec) DeepCopyInto(out *VPASpec) {
+	*out = *in
+	if in.ContainerPolicies != nil {
+		in, out := &in.ContainerPolicies, &out.ContainerPolicies
+		*out = make([]VPAContainerPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPASpec.
+func (in *VPASpec) DeepCopy() *VPASpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VPASpec)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ringtail/go-cron"
+	log "k8s.io/klog/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// names of the jobs approved, separated by comma.
+	ApproveAnnotation = "cronhpa.alibabacloud.com/approve"
+	// user who added the approval, recorded by the webhook.
+	ApprovedByAnnotation = "cronhpa.alibabacloud.com/approved-by"
+
+	defaultApprovalTimeout = time.Hour
+	approvalNotifyTimeout  = 10 * time.Second
+)
+
+// AwaitingApproval is the result of a job whose change needs approval.
+type AwaitingApproval struct {
+	Reason   string
+	Deadline time.Time
+}
+
+func (a *AwaitingApproval) Error() string {
+	return fmt.Sprintf("awaiting approval before %s, %s", a.Deadline.Format(time.RFC3339), a.Reason)
+}
+
+// ApprovalExpired is the result of a job not approved before the deadline.
+type ApprovalExpired struct {
+	Deadline time.Time
+}
+
+func (e *ApprovalExpired) Error() string {
+	return fmt.Sprintf("not approved before %s", e.Deadline.Format(time.RFC3339))
+}
+
+type pendingApproval struct {
+	job        *CronJobHPA
+	deadline   time.Time
+	approved   bool
+	approvedBy string
+}
+
+// ApprovalQueue keeps the jobs awaiting approval. A job firing again replaces its pending approval,
+// and a job not approved before the deadline is reported to the expired handler.
+type ApprovalQueue struct {
+	sync.Mutex
+	pending map[string]*pendingApproval
+	expired func(js *cron.JobResult)
+}
+
+func NewApprovalQueue(expired func(js *cron.JobResult)) *ApprovalQueue {
+	return &ApprovalQueue{
+		pending: make(map[string]*pendingApproval),
+		expired: expired,
+	}
+}
+
+func (q *ApprovalQueue) add(job *CronJobHPA, deadline time.Time) {
+	q.Lock()
+	q.pending[job.ID()] = &pendingApproval{job: job, deadline: deadline}
+	q.Unlock()
+	time.AfterFunc(time.Until(deadline), func() {
+		q.Lock()
+		p, ok := q.pending[job.ID()]
+		expired := ok && !p.approved && p.deadline.Equal(deadline)
+		if expired {
+			delete(q.pending, job.ID())
+		}
+		q.Unlock()
+		if expired && q.expired != nil {
+			q.expired(&cron.JobResult{JobId: job.ID(), Ref: job, Error: &ApprovalExpired{Deadline: deadline}})
+		}
+	})
+}
+
+// restore adds the job awaiting approval before a restart of the controller, the deadline is the one in its condition.
+// It returns false if the job already awaits approval or the deadline has passed.
+func (q *ApprovalQueue) restore(job *CronJobHPA, deadline time.Time) bool {
+	q.Lock()
+	_, ok := q.pending[job.ID()]
+	q.Unlock()
+	if ok || !time.Now().Before(deadline) {
+		return false
+	}
+	q.add(job, deadline)
+	return true
+}
+
+// approve marks the pending job of the cronHPA approved, it returns false if the job doesn't await approval.
+func (q *ApprovalQueue) approve(namespace, cronHPA, jobName, approvedBy string) (*CronJobHPA, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for _, p := range q.pending {
+		if p.job.HPARef.Namespace == namespace && p.job.HPARef.Name == cronHPA && p.job.Name() == jobName &&
+			!p.approved && time.Now().Before(p.deadline) {
+			p.approved = true
+			p.approvedBy = approvedBy
+			return p.job, true
+		}
+	}
+	return nil, false
+}
+
+// consume returns the approver if the job is approved, the approval is used only once.
+func (q *ApprovalQueue) consume(id string) (string, bool) {
+	q.Lock()
+	defer q.Unlock()
+	p, ok := q.pending[id]
+	if !ok || !p.approved {
+		return "", false
+	}
+	delete(q.pending, id)
+	return p.approvedBy, true
+}
+
+// requireApproval returns AwaitingApproval if a change of the job exceeds the thresholds of approval.
+func (ch *CronJobHPA) requireApproval(refs []*TargetRef, sizes []int32) error {
+	if ch.approval == nil || ch.approvals == nil {
+		return nil
+	}
+	if approvedBy, ok := ch.approvals.consume(ch.id); ok {
+		log.Infof("Job %s of cronHPA %s in %s namespace is approved by %s", ch.name, ch.HPARef.Name, ch.HPARef.Namespace, approvedBy)
+		return nil
+	}
+	reasons := make([]string, 0)
+	for i, ref := range refs {
+		reason, err := ch.exceedsApproval(ref, sizes[i])
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	timeout := defaultApprovalTimeout
+	if ch.approval.TimeoutSeconds != nil {
+		timeout = time.Duration(*ch.approval.TimeoutSeconds) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	ch.approvals.add(ch, deadline)
+	return &AwaitingApproval{Reason: strings.Join(reasons, "; "), Deadline: deadline}
+}
+
+func (ch *CronJobHPA) exceedsApproval(ref *TargetRef, size int32) (string, error) {
+	policy := ch.approval
+	if policy.MaxReplicas != nil && size > *policy.MaxReplicas {
+		return fmt.Sprintf("scaling %s %s to %d is more than maxReplicas %d", ref.RefKind, ref.RefName, size, *policy.MaxReplicas), nil
+	}
+	if policy.MaxScaleDownPercent == nil {
+		return "", nil
+	}
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	current, err := env.currentReplicas()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current replicas of %s %s for approval,because of %v", ref.RefKind, ref.RefName, err)
+	}
+	if current > 0 && int64(current-size)*100 > int64(*policy.MaxScaleDownPercent)*int64(current) {
+		return fmt.Sprintf("scaling %s %s down from %d to %d is more than maxScaleDownPercent %d%%", ref.RefKind, ref.RefName, current, size, *policy.MaxScaleDownPercent), nil
+	}
+	return "", nil
+}
+
+// approvalNotification is posted to the notifyURL of the approval policy.
+type approvalNotification struct {
+	Namespace string `json:"namespace"`
+	CronHPA   string `json:"cronHPA"`
+	Job       string `json:"job"`
+	Reason    string `json:"reason"`
+	Deadline  string `json:"deadline"`
+	Approve   string `json:"approve"`
+}
+
+// notifyApproval posts the notification from the network of the controller, so it's dropped unless the host of the
+// url is allowed.
+func notifyApproval(notifyURL string, hosts *AllowedHosts, job *CronJobHPA, awaiting *AwaitingApproval) {
+	u, err := url.Parse(notifyURL)
+	if err != nil || !hosts.allowed(u) {
+		log.Warningf("Drop approval notification of job %s to %s,because the host is not allowed by --approvalNotifyHosts", job.Name(), notifyURL)
+		return
+	}
+	body, err := json.Marshal(approvalNotification{
+		Namespace: job.HPARef.Namespace,
+		CronHPA:   job.HPARef.Name,
+		Job:       job.Name(),
+		Reason:    awaiting.Reason,
+		Deadline:  awaiting.Deadline.Format(time.RFC3339),
+		Approve:   fmt.Sprintf("kubectl -n %s annotate cronhpa %s %s=%s", job.HPARef.Namespace, job.HPARef.Name, ApproveAnnotation, job.Name()),
+	})
+	if err != nil {
+		log.Errorf("Failed to encode approval notification of job %s,because of %v", job.Name(), err)
+		return
+	}
+	resp, err := hosts.httpClient(approvalNotifyTimeout).Post(notifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("Failed to notify approval of job %s to %s,because of %v", job.Name(), notifyURL, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Errorf("Failed to notify approval of job %s to %s,because of status %d", job.Name(), notifyURL, resp.StatusCode)
+	}
+}
+
+// ApprovedJobs returns the names of the jobs in the approve annotation.
+func ApprovedJobs(annotations map[string]string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(annotations[ApproveAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func TestApprovalQueueRestore(t *testing.T) {
+	instance := &v1beta1.CronHorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	cases := []struct {
+		name     string
+		pending  bool
+		deadline time.Duration
+		restored bool
+	}{
+		{
+			name:     "awaiting approval before restart",
+			deadline: time.Hour,
+			restored: true,
+		},
+		{
+			name:     "deadline passed during restart",
+			deadline: -time.Minute,
+		},
+		{
+			name:     "already awaiting approval",
+			pending:  true,
+			deadline: time.Hour,
+		},
+	}
+	for _, c := range cases {
+		q := NewApprovalQueue(nil)
+		job := &CronJobHPA{id: "job-id", name: "scale-up", HPARef: instance}
+		if c.pending {
+			q.add(job, time.Now().Add(2*time.Hour))
+		}
+		if restored := q.restore(job, time.Now().Add(c.deadline)); restored != c.restored {
+			t.Errorf("%s: expected restored %v, got %v", c.name, c.restored, restored)
+		}
+		_, approved := q.approve("default", "web", "scale-up", "admin")
+		if expected := c.restored || c.pending; approved != expected {
+			t.Errorf("%s: expected approved %v, got %v", c.name, expected, approved)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"math"
+	"strconv"
+)
+
+const (
+	kedaGroup                 = "keda.sh"
+	knativeServingGroup       = "serving.knative.dev"
+	KnativeMinScaleAnnotation = "autoscaling.knative.dev/min-scale"
+	KnativeMaxScaleAnnotation = "autoscaling.knative.dev/max-scale"
+	// replicas of the unknown current size, the lower bound is always moved to the desired size.
+	unknownReplicas int32 = -1
+)
+
+// autoscalerBounds returns the bounds which make an autoscaler(HPA, KEDA or Knative) keep at least desiredSize replicas.
+// The upper bound is raised when it's lower than desiredSize. The lower bound is lowered when it's higher than desiredSize,
+// and is raised to desiredSize when the current replicas are fewer.
+func autoscalerBounds(min, max, current, desiredSize int32) (int32, int32) {
+	if desiredSize > max {
+		max = desiredSize
+	}
+	if desiredSize < min {
+		min = desiredSize
+	}
+	if current < desiredSize {
+		min = desiredSize
+	}
+	return min, max
+}
+
+func isKEDAScaledObject(ref *TargetRef) bool {
+	return ref.RefGroup == kedaGroup && ref.RefKind == "ScaledObject"
+}
+
+func isKnativeTarget(ref *TargetRef) bool {
+	return ref.RefGroup == knativeServingGroup && (ref.RefKind == "Service" || ref.RefKind == "Revision")
+}
+
+// scaleReplicas returns the replicas of the target through the scale subresource.
+func (ch *CronJobHPA) scaleReplicas(ref *TargetRef) (int32, error) {
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return 0, err
+	}
+	mappings, err := clients.mapper.RESTMappings(schema.GroupKind{Group: ref.RefGroup, Kind: ref.RefKind})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create mapping,because of %v", err)
+	}
+	for _, mapping := range mappings {
+		scale, err := clients.scaler.Scales(ref.RefNamespace).Get(context.Background(), mapping.Resource.GroupResource(), ref.RefName, metav1.GetOptions{})
+		if err == nil {
+			return scale.Spec.Replicas, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to find source target %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace)
+}
+
+func (ch *CronJobHPA) resourceOf(ref *TargetRef) (dynamic.ResourceInterface, error) {
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := clients.mapper.RESTMapping(schema.GroupKind{Group: ref.RefGroup, Kind: ref.RefKind}, ref.RefVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create mapping,because of %v", err)
+	}
+	return clients.dynamicClient.Resource(mapping.Resource).Namespace(ref.RefNamespace), nil
+}
+
+func (ch *CronJobHPA) mergePatch(resource dynamic.ResourceInterface, ref *TargetRef, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = resource.Patch(context.Background(), ref.RefName, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+// ScaleKEDA moves minReplicaCount and maxReplicaCount of a ScaledObject, KEDA owns the replicas of the target.
+func (ch *CronJobHPA) ScaleKEDA(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	resource, err := ch.resourceOf(ref)
+	if err != nil {
+		return "", err
+	}
+	obj, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to find source target %s %s in %s namespace, err is %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	// defaults of KEDA
+	min := nestedInt32(obj, 0, "spec", "minReplicaCount")
+	max := nestedInt32(obj, 100, "spec", "maxReplicaCount")
+
+	current := unknownReplicas
+	if targetRef, err := kedaScaleTargetRef(obj, ref); err == nil {
+		if replicas, err := ch.scaleReplicas(targetRef); err == nil {
+			current = replicas
+		} else {
+			log.Warningf("Failed to get replicas of the target of ScaledObject %s in %s namespace,because of %v", ref.RefName, ref.RefNamespace, err)
+		}
+	}
+
+	newMin, newMax := autoscalerBounds(min, max, current, desiredSize)
+	msg = fmt.Sprintf("ScaledObject %s minReplicaCount:%d->%d, maxReplicaCount:%d->%d.", ref.RefName, min, newMin, max, newMax)
+	if newMin == min && newMax == max {
+		return "Skip updating ScaledObject because bounds are unchanged. " + msg, nil
+	}
+	err = ch.mergePatch(resource, ref, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"minReplicaCount": newMin,
+			"maxReplicaCount": newMax,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update %s %s in %s namespace, because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	return msg, nil
+}
+
+// kedaScaleTargetRef returns the workload of the ScaledObject, it's in the same cluster as the ScaledObject.
+func kedaScaleTargetRef(obj *unstructured.Unstructured, owner *TargetRef) (*TargetRef, error) {
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "scaleTargetRef", "name")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "scaleTargetRef", "kind")
+	apiVersion, _, _ := unstructured.NestedString(obj.Object, "spec", "scaleTargetRef", "apiVersion")
+	if kind == "" {
+		kind = "Deployment"
+	}
+	if apiVersion == "" {
+		apiVersion = "apps/v1"
+	}
+	ref, err := newTargetRef(v1beta1.ScaleTargetRef{ApiVersion: apiVersion, Kind: kind, Name: name}, owner.RefNamespace)
+	if err != nil {
+		return nil, err
+	}
+	ref.Cluster = owner.Cluster
+	ref.ClusterKey = owner.ClusterKey
+	return ref, nil
+}
+
+// ScaleKnative moves the min-scale and max-scale annotations of a Knative Service template or a Revision.
+func (ch *CronJobHPA) ScaleKnative(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	resource, err := ch.resourceOf(ref)
+	if err != nil {
+		return "", err
+	}
+	obj, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to find source target %s %s in %s namespace, err is %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	fields := []string{"metadata", "annotations"}
+	if ref.RefKind == "Service" {
+		fields = []string{"spec", "template", "metadata", "annotations"}
+	}
+	annotations, _, _ := unstructured.NestedStringMap(obj.Object, fields...)
+	min := annotationInt32(annotations, KnativeMinScaleAnnotation, 0)
+	// 0 means unlimited
+	max := annotationInt32(annotations, KnativeMaxScaleAnnotation, 0)
+	bound := max
+	if bound == 0 {
+		bound = math.MaxInt32
+	}
+
+	// Knative doesn't expose the replicas of a Service, so the lower bound always follows the desired size.
+	newMin, newBound := autoscalerBounds(min, bound, unknownReplicas, desiredSize)
+	newMax := max
+	if newBound != bound {
+		newMax = newBound
+	}
+	msg = fmt.Sprintf("%s %s min-scale:%d->%d, max-scale:%d->%d.", ref.RefKind, ref.RefName, min, newMin, max, newMax)
+	if newMin == min && newMax == max {
+		return "Skip updating " + ref.RefKind + " because bounds are unchanged. " + msg, nil
+	}
+
+	var patch interface{} = map[string]interface{}{
+		KnativeMinScaleAnnotation: strconv.Itoa(int(newMin)),
+		KnativeMaxScaleAnnotation: strconv.Itoa(int(newMax)),
+	}
+	for i := len(fields) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{fields[i]: patch}
+	}
+	if err := ch.mergePatch(resource, ref, patch.(map[string]interface{})); err != nil {
+		return "", fmt.Errorf("failed to update %s %s in %s namespace, because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	return msg, nil
+}
+
+func nestedInt32(obj *unstructured.Unstructured, defaultValue int32, fields ...string) int32 {
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+	if err != nil || !found {
+		return defaultValue
+	}
+	switch v := value.(type) {
+	case int64:
+		return int32(v)
+	case float64:
+		return int32(v)
+	}
+	return defaultValue
+}
+
+func annotationInt32(annotations map[string]string, key string, defaultValue int32) int32 {
+	value, ok := annotations[key]
+	if !ok {
+		return defaultValue
+	}
+	v, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return defaultValue
+	}
+	return int32(v)
+}
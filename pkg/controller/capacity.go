@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	log "k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// only the pods bound to a node and not terminated use the capacity of the nodes.
+	capacityPodFieldSelector = "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed"
+	capacitySyncTimeout      = 30 * time.Second
+	// the informers of a cluster not checked by any preflight for the duration are stopped.
+	capacityIdleTimeout = time.Hour
+)
+
+type capacityInformers struct {
+	dynamicClient dynamic.Interface
+	nodes         cache.SharedIndexInformer
+	pods          cache.SharedIndexInformer
+	stop          chan struct{}
+	lastUsed      time.Time
+}
+
+// CapacityCache keeps the informers of the nodes and the running pods of the clusters checked by the preflights,
+// so a firing job reads the capacity from the cache instead of listing all the nodes and pods of the cluster.
+// The informers of a cluster are started by its first preflight and restarted when the clients of the cluster change.
+type CapacityCache struct {
+	sync.Mutex
+	clusters map[string]*capacityInformers
+}
+
+func NewCapacityCache() *CapacityCache {
+	return &CapacityCache{
+		clusters: make(map[string]*capacityInformers),
+	}
+}
+
+// Get returns the nodes and the running pods of the cluster, key is empty for the cluster of the controller.
+func (c *CapacityCache) Get(key string, dynamicClient dynamic.Interface) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+	c.Lock()
+	for k, informers := range c.clusters {
+		if k != key && time.Since(informers.lastUsed) > capacityIdleTimeout {
+			close(informers.stop)
+			delete(c.clusters, k)
+		}
+	}
+	informers, ok := c.clusters[key]
+	if !ok || informers.dynamicClient != dynamicClient {
+		if ok {
+			close(informers.stop)
+		}
+		informers = newCapacityInformers(dynamicClient)
+		c.clusters[key] = informers
+	}
+	informers.lastUsed = time.Now()
+	c.Unlock()
+
+	if !informers.nodes.HasSynced() || !informers.pods.HasSynced() {
+		timeout := make(chan struct{})
+		timer := time.AfterFunc(capacitySyncTimeout, func() { close(timeout) })
+		synced := cache.WaitForCacheSync(timeout, informers.nodes.HasSynced, informers.pods.HasSynced)
+		timer.Stop()
+		if !synced {
+			return nil, nil, fmt.Errorf("nodes and pods are not synced in %v", capacitySyncTimeout)
+		}
+	}
+	return storedObjects(informers.nodes.GetStore()), storedObjects(informers.pods.GetStore()), nil
+}
+
+func newCapacityInformers(dynamicClient dynamic.Interface) *capacityInformers {
+	informers := &capacityInformers{
+		dynamicClient: dynamicClient,
+		stop:          make(chan struct{}),
+	}
+	informers.nodes = newCapacityInformer(dynamicClient.Resource(nodeResource), "")
+	informers.pods = newCapacityInformer(dynamicClient.Resource(podResource), capacityPodFieldSelector)
+	go informers.nodes.Run(informers.stop)
+	go informers.pods.Run(informers.stop)
+	return informers
+}
+
+func newCapacityInformer(resource dynamic.NamespaceableResourceInterface, fieldSelector string) cache.SharedIndexInformer {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return resource.List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return resource.Watch(context.Background(), options)
+		},
+	}
+	return cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+}
+
+func storedObjects(store cache.Store) []*unstructured.Unstructured {
+	objects := make([]*unstructured.Unstructured, 0)
+	for _, item := range store.List() {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			log.Warningf("Skip unexpected object %T in the capacity cache", item)
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	scalelib "github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/lib"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/clientcmd"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKubeconfigKey = "kubeconfig"
+	// timeout of every request to a remote cluster, an unreachable cluster fails its jobs fast.
+	clusterRequestTimeout = 10 * time.Second
+	// the health of a cluster is probed again after the interval.
+	clusterProbeInterval = time.Minute
+)
+
+// targetClients are the clients of the cluster of a target.
+type targetClients struct {
+	scaler        scale.ScalesGetter
+	mapper        apimeta.RESTMapper
+	client        client.Client
+	dynamicClient dynamic.Interface
+	// only set for remote clusters
+	discovery discovery.DiscoveryInterface
+}
+
+// clientsOf returns the clients of the remote cluster of the target, or the ones of the controller.
+func (ch *CronJobHPA) clientsOf(ref *TargetRef) (*targetClients, error) {
+	identity, err := ch.identityClients()
+	if err != nil {
+		return nil, err
+	}
+	if ref.Cluster == "" && identity != nil {
+		return identity, nil
+	}
+	if ref.Cluster == "" {
+		return &targetClients{
+			scaler:        ch.scaler,
+			mapper:        ch.mapper,
+			client:        ch.client,
+			dynamicClient: ch.dynamicClient,
+		}, nil
+	}
+	if ch.clusters == nil {
+		return nil, fmt.Errorf("remote cluster %s is not supported", ref.Cluster)
+	}
+	if err := ch.identities.checkClusters([]string{ref.Cluster}); err != nil {
+		return nil, err
+	}
+	// the kubeconfig Secret is read with the identity of the job
+	secrets := ch.dynamicClient
+	if identity != nil {
+		secrets = identity.dynamicClient
+	}
+	return ch.clusters.Get(secrets, ch.HPARef.Namespace, ref.Cluster, ref.ClusterKey)
+}
+
+// identityClients returns the clients impersonating the ServiceAccount or the author of the job, nil if the job
+// changes the targets with the identity of the controller.
+func (ch *CronJobHPA) identityClients() (*targetClients, error) {
+	if ch.serviceAccount == "" && ch.author == "" {
+		return nil, nil
+	}
+	return ch.identities.clientsOf(ch.HPARef.Namespace, ch.serviceAccount, ch.author, ch.authorGroups)
+}
+
+// namespaceClient returns the dynamic client reading the objects in the namespace of the cronHPA, such as
+// ConfigMaps and Secrets, with the identity of the job.
+func (ch *CronJobHPA) namespaceClient() (dynamic.Interface, error) {
+	identity, err := ch.identityClients()
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		return identity.dynamicClient, nil
+	}
+	return ch.dynamicClient, nil
+}
+
+// setCluster points the target to the remote cluster, the namespace of the cluster replaces the one of the cronHPA.
+func setCluster(ref *TargetRef, cluster *v1beta1.ClusterRef) error {
+	if cluster == nil {
+		return nil
+	}
+	if cluster.SecretName == "" {
+		return errors.New("secretName of cluster could not be empty")
+	}
+	ref.Cluster = cluster.SecretName
+	ref.ClusterKey = cluster.Key
+	if cluster.Namespace != "" {
+		ref.RefNamespace = cluster.Namespace
+	}
+	return nil
+}
+
+func clusterRefOf(ref *TargetRef) *v1beta1.ClusterRef {
+	if ref.Cluster == "" {
+		return nil
+	}
+	return &v1beta1.ClusterRef{SecretName: ref.Cluster, Key: ref.ClusterKey, Namespace: ref.RefNamespace}
+}
+
+// Clusters returns the remote clusters of the targets of the job.
+func (ch *CronJobHPA) Clusters() []string {
+	clusters := make([]string, 0)
+	refs := []*TargetRef{ch.TargetRef}
+	for _, t := range ch.Distribution {
+		refs = append(refs, t.TargetRef)
+	}
+	for _, ref := range refs {
+		if ref.Cluster != "" && !containsString(clusters, ref.Cluster) {
+			clusters = append(clusters, ref.Cluster)
+		}
+	}
+	return clusters
+}
+
+// specClusters returns the remote clusters referenced by the spec.
+func specClusters(spec v1beta1.CronHorizontalPodAutoscalerSpec) []string {
+	clusters := make([]string, 0)
+	refs := []v1beta1.ScaleTargetRef{spec.ScaleTargetRef}
+	if spec.Distribution != nil {
+		for _, t := range spec.Distribution.Targets {
+			refs = append(refs, t.ScaleTargetRef)
+		}
+	}
+	for _, job := range spec.Jobs {
+		if job.Patch != nil && job.Patch.Target != nil {
+			refs = append(refs, *job.Patch.Target)
+		}
+	}
+	for _, ref := range refs {
+		if ref.Cluster != nil && !containsString(clusters, ref.Cluster.SecretName) {
+			clusters = append(clusters, ref.Cluster.SecretName)
+		}
+	}
+	return clusters
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type clusterEntry struct {
+	clients         *targetClients
+	resourceVersion string
+	status          v1beta1.ClusterStatus
+}
+
+// ClusterCache builds the clients of the remote clusters lazily from the kubeconfig Secrets.
+// The clients are rebuilt when the Secret changes. Connections are probed outside of the lock,
+// so an unreachable cluster doesn't block the jobs of other clusters.
+type ClusterCache struct {
+	sync.Mutex
+	clusters map[string]*clusterEntry
+}
+
+func NewClusterCache() *ClusterCache {
+	return &ClusterCache{
+		clusters: make(map[string]*clusterEntry),
+	}
+}
+
+// Get returns the clients of the cluster, the Secret is read by the secrets client every time so the clients
+// cached are only returned to the callers allowed to read it.
+func (c *ClusterCache) Get(secrets dynamic.Interface, namespace, name, key string) (*targetClients, error) {
+	if key == "" {
+		key = defaultKubeconfigKey
+	}
+	cacheKey := namespace + "/" + name
+	secret, err := secrets.Resource(secretResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		err = fmt.Errorf("failed to get kubeconfig secret %s,because of %v", name, err)
+		c.setStatus(cacheKey, &clusterEntry{}, name, err)
+		return nil, err
+	}
+
+	c.Lock()
+	entry, ok := c.clusters[cacheKey]
+	c.Unlock()
+	if ok && entry.resourceVersion == secret.GetResourceVersion() && time.Since(entry.status.LastProbeTime.Time) < clusterProbeInterval {
+		if !entry.status.Healthy {
+			return nil, fmt.Errorf("cluster %s is unhealthy, %s", name, entry.status.Message)
+		}
+		return entry.clients, nil
+	}
+
+	if !ok || entry.clients == nil || entry.resourceVersion != secret.GetResourceVersion() {
+		clients, err := newClusterClients(secret, key)
+		if err != nil {
+			c.setStatus(cacheKey, &clusterEntry{resourceVersion: secret.GetResourceVersion()}, name, err)
+			return nil, fmt.Errorf("failed to build clients of cluster %s,because of %v", name, err)
+		}
+		entry = &clusterEntry{clients: clients, resourceVersion: secret.GetResourceVersion()}
+	} else {
+		entry = &clusterEntry{clients: entry.clients, resourceVersion: entry.resourceVersion}
+	}
+
+	err = probeCluster(entry.clients)
+	c.setStatus(cacheKey, entry, name, err)
+	if err != nil {
+		log.Warningf("Cluster %s in %s namespace is unhealthy,because of %v", name, namespace, err)
+		return nil, fmt.Errorf("cluster %s is unhealthy, %v", name, err)
+	}
+	return entry.clients, nil
+}
+
+func (c *ClusterCache) setStatus(cacheKey string, entry *clusterEntry, name string, err error) {
+	entry.status = v1beta1.ClusterStatus{
+		Name:          name,
+		Healthy:       err == nil,
+		LastProbeTime: metav1.Time{Time: time.Now()},
+	}
+	if err != nil {
+		entry.status.Message = err.Error()
+	}
+	c.Lock()
+	c.clusters[cacheKey] = entry
+	c.Unlock()
+}
+
+// Status returns the health of the cluster when it's used the last time.
+func (c *ClusterCache) Status(namespace, name string) (v1beta1.ClusterStatus, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.clusters[namespace+"/"+name]
+	if !ok {
+		return v1beta1.ClusterStatus{}, false
+	}
+	return entry.status, true
+}
+
+func newClusterClients(secret *unstructured.Unstructured, key string) (*targetClients, error) {
+	data, _, err := unstructured.NestedStringMap(secret.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	encoded, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not found in secret %s", key, secret.GetName())
+	}
+	kubeconfig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := restConfigOf(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = clusterRequestTimeout
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// the mappings are discovered on the first use and refreshed when a kind is not found.
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	// build dynamic client before the scale client which overrides the GroupVersion of config
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scaler, err := scalelib.NewForConfig(rest.CopyConfig(cfg), mapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(discoveryClient))
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(rest.CopyConfig(cfg), client.Options{Scheme: scheme.Scheme, Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+	return &targetClients{
+		scaler:        scaler,
+		mapper:        mapper,
+		client:        c,
+		dynamicClient: dynamicClient,
+		discovery:     discoveryClient,
+	}, nil
+}
+
+// restConfigOf builds the config of the current context from the inline data of the kubeconfig only. The kubeconfig is
+// written by the tenants, so the exec and auth-provider plugins, the file paths, the proxy and the impersonation are
+// refused, they would run commands in the controller or read its files.
+func restConfigOf(kubeconfig []byte) (*rest.Config, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" || cluster.ProxyURL != "" {
+			return nil, fmt.Errorf("certificate-authority and proxy-url of cluster %s are not allowed, use certificate-authority-data", name)
+		}
+	}
+	for name, authInfo := range config.AuthInfos {
+		if authInfo.Exec != nil || authInfo.AuthProvider != nil {
+			return nil, fmt.Errorf("exec and auth-provider of user %s are not allowed", name)
+		}
+		if authInfo.TokenFile != "" || authInfo.ClientCertificate != "" || authInfo.ClientKey != "" {
+			return nil, fmt.Errorf("tokenFile, client-certificate and client-key of user %s are not allowed, use token, client-certificate-data and client-key-data", name)
+		}
+		if authInfo.Impersonate != "" || len(authInfo.ImpersonateGroups) != 0 || len(authInfo.ImpersonateUserExtra) != 0 {
+			return nil, fmt.Errorf("act-as of user %s is not allowed", name)
+		}
+	}
+	current, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("current-context %s is not found", config.CurrentContext)
+	}
+	cluster, ok := config.Clusters[current.Cluster]
+	if !ok || cluster.Server == "" {
+		return nil, fmt.Errorf("server of cluster %s is not found", current.Cluster)
+	}
+	cfg := &rest.Config{
+		Host: cluster.Server,
+		TLSClientConfig: rest.TLSClientConfig{
+			Insecure:   cluster.InsecureSkipTLSVerify,
+			ServerName: cluster.TLSServerName,
+			CAData:     cluster.CertificateAuthorityData,
+		},
+	}
+	if authInfo, ok := config.AuthInfos[current.AuthInfo]; ok {
+		cfg.BearerToken = authInfo.Token
+		cfg.Username = authInfo.Username
+		cfg.Password = authInfo.Password
+		cfg.TLSClientConfig.CertData = authInfo.ClientCertificateData
+		cfg.TLSClientConfig.KeyData = authInfo.ClientKeyData
+	}
+	return cfg, nil
+}
+
+func probeCluster(clients *targetClients) error {
+	_, err := clients.discovery.ServerVersion()
+	return err
+}
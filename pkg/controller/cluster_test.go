@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: remote
+clusters:
+- name: remote
+  cluster:
+    server: https://10.0.0.1:6443
+    certificate-authority-data: Y2E=
+%s
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+users:
+- name: remote
+  user:
+    token: secret
+%s
+`
+
+func kubeconfigWith(cluster, user string) []byte {
+	return []byte(strings.Replace(strings.Replace(testKubeconfig, "%s", cluster, 1), "%s", user, 1))
+}
+
+func TestRestConfigOf(t *testing.T) {
+	cases := []struct {
+		name    string
+		cluster string
+		user    string
+		err     string
+	}{
+		{name: "inline data"},
+		{name: "exec", user: "    exec:\n      apiVersion: client.authentication.k8s.io/v1beta1\n      command: sh", err: "exec and auth-provider"},
+		{name: "auth-provider", user: "    auth-provider:\n      name: gcp", err: "exec and auth-provider"},
+		{name: "token file", user: "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token", err: "tokenFile"},
+		{name: "client certificate file", user: "    client-certificate: /etc/cert", err: "tokenFile"},
+		{name: "client key file", user: "    client-key: /etc/key", err: "tokenFile"},
+		{name: "act-as", user: "    as: admin", err: "act-as"},
+		{name: "certificate authority file", cluster: "    certificate-authority: /etc/ca", err: "certificate-authority"},
+		{name: "proxy", cluster: "    proxy-url: http://169.254.169.254", err: "proxy-url"},
+	}
+	for _, c := range cases {
+		cfg, err := restConfigOf(kubeconfigWith(c.cluster, c.user))
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if cfg.Host != "https://10.0.0.1:6443" || cfg.BearerToken != "secret" || string(cfg.CAData) != "ca" {
+			t.Errorf("%s: unexpected config %+v", c.name, cfg)
+		}
+		if cfg.ExecProvider != nil || cfg.AuthProvider != nil || cfg.BearerTokenFile != "" {
+			t.Errorf("%s: config should only have inline data, got %+v", c.name, cfg)
+		}
+	}
+}
+
+func TestRestConfigOfCurrentContext(t *testing.T) {
+	kubeconfig := []byte(strings.Replace(string(kubeconfigWith("", "")), "current-context: remote", "current-context: other", 1))
+	if _, err := restConfigOf(kubeconfig); err == nil {
+		t.Errorf("expected error of missing current-context")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+)
+
+// NewClusterReconciler returns a new reconcile.Reconciler of ClusterCronHorizontalPodAutoscaler.
+// The jobs share the CronManager with CronHorizontalPodAutoscaler.
+func NewClusterReconciler(mgr manager.Manager, cm *CronManager) reconcile.Reconciler {
+	return &ReconcileClusterCronHorizontalPodAutoscaler{Client: mgr.GetClient(), scheme: mgr.GetScheme(), CronManager: cm}
+}
+
+var _ reconcile.Reconciler = &ReconcileClusterCronHorizontalPodAutoscaler{}
+
+// ReconcileClusterCronHorizontalPodAutoscaler reconciles a ClusterCronHorizontalPodAutoscaler object
+type ReconcileClusterCronHorizontalPodAutoscaler struct {
+	client.Client
+	scheme      *runtime.Scheme
+	CronManager *CronManager
+}
+
+// +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=clustercronhorizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+func (r *ReconcileClusterCronHorizontalPodAutoscaler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	log.Infof("Start to handle clusterCronHPA %s", request.Name)
+	instance := &v1beta1.ClusterCronHorizontalPodAutoscaler{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			go r.CronManager.GC()
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	conditions := instance.Status.Conditions
+	jobs := make(map[string]bool)
+	for _, job := range instance.Spec.Jobs {
+		jobs[job.Name] = true
+	}
+
+	// remove the jobs which are not in spec any more
+	leftConditions := make([]v1beta1.ClusterCondition, 0)
+	for _, c := range conditions {
+		if jobs[c.Name] {
+			leftConditions = append(leftConditions, c)
+			continue
+		}
+		if c.JobId != "" {
+			if err := r.CronManager.delete(c.JobId); err != nil {
+				log.Errorf("Failed to delete expired job %s,because of %v", c.Name, err)
+			}
+		}
+	}
+	instance.Status.Conditions = leftConditions
+	leftConditionsMap := make(map[string]v1beta1.ClusterCondition)
+	for _, c := range leftConditions {
+		leftConditionsMap[c.Name] = c
+	}
+
+	noNeedUpdateStatus := true
+	for _, job := range instance.Spec.Jobs {
+		jobCondition := v1beta1.ClusterCondition{
+			Condition: v1beta1.Condition{
+				Name:          job.Name,
+				Schedule:      job.Schedule,
+				RunOnce:       job.RunOnce,
+				TargetSize:    job.TargetSize,
+				LastProbeTime: metav1.Time{Time: time.Now()},
+			},
+		}
+		c, exists := leftConditionsMap[job.Name]
+		j, err := ClusterCronHPAJobFactory(instance, job, r.CronManager.scaler, r.CronManager.mapper, r.Client, r.CronManager.dynamicClient, r.CronManager.identities, r.CronManager.freezes)
+		if err != nil {
+			jobCondition.State = v1beta1.Failed
+			jobCondition.Message = fmt.Sprintf("Failed to create cron hpa job %s,because of %v", job.Name, err)
+			log.Errorf("Failed to create cron hpa job %s,because of %v", job.Name, err)
+		} else {
+			if exists && c.JobId != "" {
+				j.SetID(c.JobId)
+				// run once and return when reaches the final state
+				if runOnce(job) && (c.State == v1beta1.Succeed || c.State == v1beta1.Failed) {
+					if err := r.CronManager.delete(c.JobId); err != nil {
+						log.Errorf("cron hpa %s(%s) has ran once but fail to exit,because of %v", job.Name, c.JobId, err)
+					}
+					continue
+				}
+			}
+
+			jobCondition.JobId = j.ID()
+			err := r.CronManager.createOrUpdate(j)
+			if err != nil {
+				if _, ok := err.(*NoNeedUpdate); ok {
+					continue
+				}
+				jobCondition.State = v1beta1.Failed
+				jobCondition.Message = fmt.Sprintf("Failed to update cron hpa job %s,because of %v", job.Name, err)
+			} else {
+				jobCondition.State = v1beta1.Submitted
+			}
+		}
+		if exists && c.State == jobCondition.State && c.Message == jobCondition.Message && c.JobId == jobCondition.JobId {
+			continue
+		}
+		noNeedUpdateStatus = false
+		leftConditionsMap[job.Name] = jobCondition
+	}
+
+	if !noNeedUpdateStatus || len(leftConditions) != len(conditions) {
+		instance.Status.Conditions = make([]v1beta1.ClusterCondition, 0, len(leftConditionsMap))
+		for _, job := range instance.Spec.Jobs {
+			if c, ok := leftConditionsMap[job.Name]; ok {
+				instance.Status.Conditions = append(instance.Status.Conditions, c)
+			}
+		}
+		err := r.Update(context.Background(), instance)
+		if err != nil {
+			log.Errorf("Failed to update clusterCronHPA %s status,because of %v", instance.Name, err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
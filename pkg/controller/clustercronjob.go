@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/satori/go.uuid"
+	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	scaleclient "k8s.io/client-go/scale"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClusterCronJobHPA is a job of ClusterCronHorizontalPodAutoscaler.
+// It scales all the targets matched by the selectors in every selected namespace.
+type ClusterCronJobHPA struct {
+	sync.Mutex
+	HPARef            *v1beta1.ClusterCronHorizontalPodAutoscaler
+	id                string
+	name              string
+	DesiredSize       int32
+	Plan              string
+	RunOnce           bool
+	targetGVK         schema.GroupVersionKind
+	namespaceSelector labels.Selector
+	targetSelector    labels.Selector
+	excludeDates      []string
+	scaler            scaleclient.ScalesGetter
+	mapper            apimeta.RESTMapper
+	client            client.Client
+	dynamicClient     dynamic.Interface
+	freezes           *FreezeGate
+	// summaries of the last execution
+	summaries []v1beta1.NamespaceSummary
+}
+
+func (cj *ClusterCronJobHPA) SetID(id string) {
+	cj.id = id
+}
+
+func (cj *ClusterCronJobHPA) Name() string {
+	return cj.name
+}
+
+func (cj *ClusterCronJobHPA) ID() string {
+	return cj.id
+}
+
+func (cj *ClusterCronJobHPA) Equals(j CronJob) bool {
+	other, ok := j.(*ClusterCronJobHPA)
+	if !ok {
+		return false
+	}
+	return cj.id == other.id && cj.Plan == other.Plan && cj.Ref().toString() == other.Ref().toString() &&
+		cj.DesiredSize == other.DesiredSize && strings.Join(cj.excludeDates, ",") == strings.Join(other.excludeDates, ",")
+}
+
+func (cj *ClusterCronJobHPA) SchedulePlan() string {
+	return cj.Plan
+}
+
+// Ref returns the selectors in place of the name and namespace of the target.
+func (cj *ClusterCronJobHPA) Ref() *TargetRef {
+	return &TargetRef{
+		RefName:      cj.targetSelector.String(),
+		RefNamespace: cj.namespaceSelector.String(),
+		RefKind:      cj.targetGVK.Kind,
+		RefGroup:     cj.targetGVK.Group,
+		RefVersion:   cj.targetGVK.Version,
+	}
+}
+
+func (cj *ClusterCronJobHPA) CronHPAMeta() metav1.Object {
+	return cj.HPARef
+}
+
+// NamespaceSummaries returns the per namespace results of the last execution.
+func (cj *ClusterCronJobHPA) NamespaceSummaries() []v1beta1.NamespaceSummary {
+	cj.Lock()
+	defer cj.Unlock()
+	return cj.summaries
+}
+
+func (cj *ClusterCronJobHPA) Run() (msg string, err error) {
+	if skip, msg := IsTodayOff(cj.excludeDates); skip {
+		return msg, nil
+	}
+	if err := cj.freezes.check(cj, "", labels.Set(cj.HPARef.Labels)); err != nil {
+		return "", err
+	}
+
+	mapping, err := cj.mapper.RESTMapping(cj.targetGVK.GroupKind(), cj.targetGVK.Version)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create mapping,because of %v", err)
+	}
+
+	namespaces := &v1.NamespaceList{}
+	if err := cj.client.List(context.Background(), namespaces, client.MatchingLabelsSelector{Selector: cj.namespaceSelector}); err != nil {
+		return "", fmt.Errorf("failed to list namespaces,because of %v", err)
+	}
+
+	results := make([]v1beta1.NamespaceSummary, len(namespaces.Items))
+	var wg sync.WaitGroup
+	for i, ns := range namespaces.Items {
+		wg.Add(1)
+		go func(i int, namespace string) {
+			defer wg.Done()
+			results[i] = cj.runInNamespace(mapping, namespace)
+		}(i, ns.Name)
+	}
+	wg.Wait()
+
+	summaries := make([]v1beta1.NamespaceSummary, 0)
+	var targets, failed int32
+	for _, s := range results {
+		if s.Targets == 0 && s.Message == "" {
+			continue
+		}
+		summaries = append(summaries, s)
+		targets += s.Targets
+		failed += s.Failed
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Namespace < summaries[j].Namespace
+	})
+	cj.Lock()
+	cj.summaries = summaries
+	cj.Unlock()
+
+	msg = fmt.Sprintf("%d of %d %s in %d namespaces scaled to %d.", targets-failed, targets, cj.targetGVK.Kind, len(summaries), cj.DesiredSize)
+	if failed > 0 {
+		return msg, fmt.Errorf("failed to scale %d of %d %s, check the namespaces in status for details", failed, targets, cj.targetGVK.Kind)
+	}
+	return msg, nil
+}
+
+func (cj *ClusterCronJobHPA) runInNamespace(mapping *apimeta.RESTMapping, namespace string) v1beta1.NamespaceSummary {
+	summary := v1beta1.NamespaceSummary{Namespace: namespace}
+	if f, err := cj.freezes.frozen(namespace, labels.Set(cj.HPARef.Labels)); err != nil {
+		log.Errorf("Failed to check freezes of job %s in %s namespace,because of %v", cj.name, namespace, err)
+	} else if f != nil {
+		summary.Message = fmt.Sprintf("skipped, %v", f)
+		return summary
+	}
+	list, err := cj.dynamicClient.Resource(mapping.Resource).Namespace(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: cj.targetSelector.String(),
+	})
+	if err != nil {
+		log.Errorf("Failed to list %s in %s namespace for job %s,because of %v", cj.targetGVK.Kind, namespace, cj.name, err)
+		summary.Message = fmt.Sprintf("failed to list %s,because of %v", cj.targetGVK.Kind, err)
+		return summary
+	}
+
+	// scale the targets by the same routine of CronHorizontalPodAutoscaler, with the identity of the controller
+	executor := &CronJobHPA{
+		name:            cj.name,
+		DesiredSize:     cj.DesiredSize,
+		scaler:          cj.scaler,
+		mapper:          cj.mapper,
+		client:          cj.client,
+		dynamicClient:   cj.dynamicClient,
+		freezes:         cj.freezes,
+		policyNamespace: namespace,
+	}
+	errs := make([]string, 0)
+	for _, item := range list.Items {
+		ref := &TargetRef{
+			RefName:      item.GetName(),
+			RefNamespace: namespace,
+			RefKind:      cj.targetGVK.Kind,
+			RefGroup:     cj.targetGVK.Group,
+			RefVersion:   cj.targetGVK.Version,
+		}
+		summary.Targets++
+		if _, err := executor.scaleWithRetry(ref, cj.DesiredSize); err != nil {
+			summary.Failed++
+			errs = append(errs, err.Error())
+			continue
+		}
+		summary.Succeed++
+	}
+	if len(errs) != 0 {
+		summary.Message = strings.Join(errs, "; ")
+	}
+	return summary
+}
+
+func labelSelectorOrEverything(selector *metav1.LabelSelector) (labels.Selector, error) {
+	if selector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+func ClusterCronHPAJobFactory(instance *v1beta1.ClusterCronHorizontalPodAutoscaler, job v1beta1.Job, scaler scaleclient.ScalesGetter, mapper apimeta.RESTMapper, client client.Client, dynamicClient dynamic.Interface, identities *IdentityCache, freezes *FreezeGate) (CronJob, error) {
+	if job.Action != "" && job.Action != v1beta1.ScaleAction {
+		return nil, fmt.Errorf("action %s of job %s is not supported by ClusterCronHorizontalPodAutoscaler", job.Action, job.Name)
+	}
+	if job.TargetSizeExpr != "" || job.TargetSizeFrom != nil {
+		return nil, fmt.Errorf("targetSizeExpr and targetSizeFrom of job %s are not supported by ClusterCronHorizontalPodAutoscaler", job.Name)
+	}
+	if err := identities.checkClusterCronHPA(); err != nil {
+		return nil, err
+	}
+	targetSelector := instance.Spec.ScaleTargetSelector
+	gv, err := schema.ParseGroupVersion(targetSelector.ApiVersion)
+	if err != nil {
+		return nil, err
+	}
+	if gv.Version == "" || targetSelector.Kind == "" {
+		return nil, errors.New("apiVersion and kind of scaleTargetSelector could not be empty")
+	}
+	gvk := gv.WithKind(targetSelector.Kind)
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource of %s,because of %v", gvk.String(), err)
+	}
+	if mapping.Scope.Name() != apimeta.RESTScopeNameNamespace {
+		return nil, fmt.Errorf("%s is not a namespaced resource", gvk.String())
+	}
+
+	nsSelector, err := labelSelectorOrEverything(instance.Spec.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespaceSelector,because of %v", err)
+	}
+	selector, err := labelSelectorOrEverything(targetSelector.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of scaleTargetSelector,because of %v", err)
+	}
+
+	if err := checkPlanValid(job.Schedule); err != nil {
+		return nil, err
+	}
+	return &ClusterCronJobHPA{
+		id:                uuid.Must(uuid.NewV4(), nil).String(),
+		HPARef:            instance,
+		name:              job.Name,
+		Plan:              job.Schedule,
+		DesiredSize:       job.TargetSize,
+		RunOnce:           job.RunOnce,
+		targetGVK:         gvk,
+		namespaceSelector: nsSelector,
+		targetSelector:    selector,
+		excludeDates:      instance.Spec.ExcludeDates,
+		scaler:            scaler,
+		mapper:            mapper,
+		client:            client,
+		dynamicClient:     dynamicClient,
+		freezes:           freezes,
+	}, nil
+}
@@ -33,11 +33,25 @@ type CronHPAExecutor struct {
 }
 
 func (ce *CronHPAExecutor) AddJob(job CronJob) error {
-	err := ce.Engine.AddJob(job.SchedulePlan(), job)
+	schedule, err := scheduleOf(job)
 	if err != nil {
 		log.Errorf("Failed to add job to engine,because of %v", err)
+		return err
 	}
-	return err
+	ce.Engine.Schedule(schedule, job)
+	return nil
+}
+
+// scheduleOf returns the schedule of the job, a readyBy job fires earlier than its plan.
+func scheduleOf(job CronJob) (cron.Schedule, error) {
+	schedule, err := cron.Parse(job.SchedulePlan())
+	if err != nil {
+		return nil, err
+	}
+	if j, ok := job.(*CronJobHPA); ok && j.readyBy {
+		return &readyBySchedule{schedule: schedule, job: j}, nil
+	}
+	return schedule, nil
 }
 
 func (ce *CronHPAExecutor) ListEntries() []*cron.Entry {
@@ -62,11 +76,13 @@ func (ce *CronHPAExecutor) FindJob(job CronJob) (bool, FailedFindJobReason) {
 
 func (ce *CronHPAExecutor) Update(job CronJob) error {
 	ce.Engine.RemoveJob(job.ID())
-	err := ce.Engine.AddJob(job.SchedulePlan(), job)
+	schedule, err := scheduleOf(job)
 	if err != nil {
 		log.Errorf("Failed to update job to engine,because of %v", err)
+		return err
 	}
-	return err
+	ce.Engine.Schedule(schedule, job)
+	return nil
 }
 
 func (ce *CronHPAExecutor) RemoveJob(job CronJob) error {
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
 	autoscalingv1beta1 "github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -38,7 +40,7 @@ import (
  */
 
 // newReconciler returns a new reconcile.Reconciler
-func NewReconciler(mgr manager.Manager) reconcile.Reconciler {
+func NewReconciler(mgr manager.Manager) *ReconcileCronHorizontalPodAutoscaler {
 	var stopChan chan struct{}
 	cm := NewCronManager(mgr.GetConfig(), mgr.GetClient(), mgr.GetEventRecorderFor("CronHorizontalPodAutoscaler"))
 	r := &ReconcileCronHorizontalPodAutoscaler{Client: mgr.GetClient(), scheme: mgr.GetScheme(), CronManager: cm}
@@ -70,6 +72,14 @@ type ReconcileCronHorizontalPodAutoscaler struct {
 // Automatically generate RBAC rules to allow the Controller to read and write Deployments
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=cronhorizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=cronhpaprofiles,verbs=get;list;watch
+// +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=cronhpapolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=cronhpafreezes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes;resourcequotas,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;create;delete;patch
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=create;delete;deletecollection
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list
+// +kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=get;list
 func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	// Fetch the CronHorizontalPodAutoscaler instance
 	log.Infof("Start to handle cronHPA %s in %s namespace", request.Name, request.Namespace)
@@ -80,6 +90,7 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
 			go r.CronManager.GC()
+			go r.CronManager.inverses.forget(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -87,6 +98,31 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 	}
 
 	//log.Infof("%v is handled by cron-hpa controller", instance.Name)
+	wokeUp := false
+	if _, ok := instance.Annotations[WakeUpAnnotation]; ok {
+		r.wakeUp(instance)
+		wokeUp = true
+	}
+	_, approved := instance.Annotations[ApproveAnnotation]
+
+	jobs, err := r.resolveJobs(instance)
+	if err != nil {
+		// keep the running jobs until the profile is fixed, the cronHPA is requeued when the profile changes.
+		log.Errorf("Failed to resolve jobs of cronHPA %s in %s namespace,because of %v", instance.Name, instance.Namespace, err)
+		r.CronManager.eventRecorder.Event(instance, v1.EventTypeWarning, "InvalidProfile", err.Error())
+		if approved {
+			jobs, approvedBy := r.CronManager.approve(instance)
+			// run after the annotations are removed
+			defer r.CronManager.runApproved(jobs, approvedBy)
+		}
+		if wokeUp || approved {
+			if err := r.Update(context.Background(), instance); err != nil {
+				log.Errorf("Failed to update cron hpa %s status,because of %v", instance.Name, err)
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
 	conditions := instance.Status.Conditions
 
 	leftConditions := make([]v1beta1.Condition, 0)
@@ -105,10 +141,10 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 		// check status and delete the expired job
 		for _, cJob := range conditions {
 			skip := false
-			for _, job := range instance.Spec.Jobs {
+			for _, job := range jobs {
 				if cJob.Name == job.Name {
 					// schedule has changed or RunOnce changed
-					if cJob.Schedule != job.Schedule || cJob.RunOnce != job.RunOnce || cJob.TargetSize != job.TargetSize {
+					if cJob.Schedule != job.Schedule || cJob.RunOnce != job.RunOnce || cJob.TargetSize != job.TargetSize || cJob.TargetSizeExpr != job.TargetSizeExpr {
 						// jobId exists and remove the job from cronManager
 						if cJob.JobId != "" {
 							err := r.CronManager.delete(cJob.JobId)
@@ -144,25 +180,37 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 
 	noNeedUpdateStatus := true
 
-	for _, job := range instance.Spec.Jobs {
+	for _, job := range jobs {
 		jobCondition := v1beta1.Condition{
-			Name:          job.Name,
-			Schedule:      job.Schedule,
-			RunOnce:       job.RunOnce,
-			TargetSize:    job.TargetSize,
-			LastProbeTime: metav1.Time{Time: time.Now()},
+			Name:           job.Name,
+			Schedule:       job.Schedule,
+			RunOnce:        job.RunOnce,
+			TargetSize:     job.TargetSize,
+			LastProbeTime:  metav1.Time{Time: time.Now()},
+			TargetSizeExpr: job.TargetSizeExpr,
 		}
-		j, err := CronHPAJobFactory(instance, job, r.CronManager.scaler, r.CronManager.mapper, r.Client)
+		j, err := CronHPAJobFactory(instance, job, r.CronManager.scaler, r.CronManager.mapper, r.Client, r.CronManager.dynamicClient, r.CronManager.discovery, r.CronManager.clusters, r.CronManager.identities, r.CronManager.freezes, r.CronManager.approvals, r.CronManager.readiness, r.CronManager.steps, r.CronManager.rollouts, r.CronManager.inverses, r.CronManager.capacity, r.CronManager.sizeSourceHosts, r.CronManager.externalHosts)
 
 		if err != nil {
 			jobCondition.State = v1beta1.Failed
 			jobCondition.Message = fmt.Sprintf("Failed to create cron hpa job %s,because of %v", job.Name, err)
 			log.Errorf("Failed to create cron hpa job %s,because of %v", job.Name, err)
 		} else {
+			jobCondition.Distribution = j.(*CronJobHPA).DistributionStatus()
+			jobCondition.ReadyBy = j.(*CronJobHPA).ReadyByStatus()
 			name := job.Name
 			if c, ok := leftConditionsMap[name]; ok {
 				jobId := c.JobId
 				j.SetID(jobId)
+				// the last result is the previous of next evaluation
+				jobCondition.EvaluatedSize = c.EvaluatedSize
+				jobCondition.SizeSource = c.SizeSource
+				jobCondition.InversePatch = c.InversePatch
+				jobCondition.Preflight = c.Preflight
+				jobCondition.Prepull = c.Prepull
+				jobCondition.PDBClamps = c.PDBClamps
+				j.(*CronJobHPA).SetEvaluatedSize(c.EvaluatedSize)
+				j.(*CronJobHPA).prepullStatus = c.Prepull
 
 				// run once and return when reaches the final state
 				if runOnce(job) && (c.State == v1beta1.Succeed || c.State == v1beta1.Failed) {
@@ -176,6 +224,18 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 
 			jobCondition.JobId = j.ID()
 			err := r.CronManager.createOrUpdate(j)
+			// the jobs awaiting approval are lost on restart, restore them with the deadline in their conditions
+			_, noNeedUpdate := err.(*NoNeedUpdate)
+			if c, ok := leftConditionsMap[name]; ok && (err == nil || noNeedUpdate) && c.State == v1beta1.AwaitingApproval && c.ApprovalDeadline != nil &&
+				r.CronManager.approvals.restore(j.(*CronJobHPA), c.ApprovalDeadline.Time) {
+				log.Infof("Restored job %s of cronHPA %s in %s namespace awaiting approval before %s", name, instance.Name, instance.Namespace, c.ApprovalDeadline.Format(time.RFC3339))
+				jobCondition.State = c.State
+				jobCondition.Message = c.Message
+				jobCondition.ApprovalDeadline = c.ApprovalDeadline
+				noNeedUpdateStatus = false
+				instance.Status.Conditions = updateConditions(instance.Status.Conditions, jobCondition)
+				continue
+			}
 			if err != nil {
 				if _, ok := err.(*NoNeedUpdate); ok {
 					continue
@@ -190,8 +250,15 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 		noNeedUpdateStatus = false
 		instance.Status.Conditions = updateConditions(instance.Status.Conditions, jobCondition)
 	}
+	// approve after the jobs awaiting approval are restored
+	if approved {
+		jobs, approvedBy := r.CronManager.approve(instance)
+		// run after the annotations are removed
+		defer r.CronManager.runApproved(jobs, approvedBy)
+	}
+
 	// conditions doesn't changed and no need to update.
-	if !noNeedUpdateStatus || len(leftConditions) != len(conditions) {
+	if !noNeedUpdateStatus || len(leftConditions) != len(conditions) || wokeUp || approved {
 		err := r.Update(context.Background(), instance)
 		if err != nil {
 			log.Errorf("Failed to update cron hpa %s status,because of %v", instance.Name, err)
@@ -202,6 +269,46 @@ func (r *ReconcileCronHorizontalPodAutoscaler) Reconcile(request reconcile.Reque
 	return reconcile.Result{}, nil
 }
 
+// wakeUp restores the sleeping namespace at once and removes the WakeUpAnnotation.
+func (r *ReconcileCronHorizontalPodAutoscaler) wakeUp(instance *v1beta1.CronHorizontalPodAutoscaler) {
+	delete(instance.Annotations, WakeUpAnnotation)
+	if instance.Status.Sleep == nil || !instance.Status.Sleep.Asleep {
+		log.Infof("Skip waking up namespace %s of cronHPA %s, because it is not asleep", instance.Namespace, instance.Name)
+		return
+	}
+	// the objects are restored with the identity of the jobs of the cronHPA
+	dynamicClient, scaler := r.CronManager.dynamicClient, r.CronManager.scaler
+	identities, sa := r.CronManager.identities, instance.Spec.ServiceAccountName
+	var author string
+	var groups []string
+	err := identities.checkServiceAccount(sa)
+	if err == nil {
+		author, groups, err = identities.authorOf(sa, instance.Annotations)
+	}
+	if err == nil && (sa != "" || author != "") {
+		var clients *targetClients
+		if clients, err = identities.clientsOf(instance.Namespace, sa, author, groups); err == nil {
+			dynamicClient, scaler = clients.dynamicClient, clients.scaler
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to wake up namespace %s of cronHPA %s,because of %v", instance.Namespace, instance.Name, err)
+		r.CronManager.eventRecorder.Event(instance, v1.EventTypeWarning, "WakeUpFailed", err.Error())
+		return
+	}
+	sleeper := newNamespaceSleeper(instance.Namespace, instance.Spec.Sleep, r.CronManager.discovery, dynamicClient, scaler)
+	status, msg, err := sleeper.Wake()
+	if status != nil {
+		instance.Status.Sleep = status
+	}
+	if err != nil {
+		log.Errorf("Failed to wake up namespace %s of cronHPA %s,because of %v", instance.Namespace, instance.Name, err)
+		r.CronManager.eventRecorder.Event(instance, v1.EventTypeWarning, "WakeUpFailed", fmt.Sprintf("%s %v", msg, err))
+		return
+	}
+	r.CronManager.eventRecorder.Event(instance, v1.EventTypeNormal, "WakeUp", msg)
+}
+
 func convertConditionMaps(conditions []v1beta1.Condition) map[string]v1beta1.Condition {
 	m := make(map[string]v1beta1.Condition)
 	for _, condition := range conditions {
@@ -223,7 +330,8 @@ func updateConditions(conditions []v1beta1.Condition, condition v1beta1.Conditio
 // if global params changed then all jobs need to be recreated.
 func checkGlobalParamsChanges(status v1beta1.CronHorizontalPodAutoscalerStatus, spec v1beta1.CronHorizontalPodAutoscalerSpec) bool {
 	if &status.ScaleTargetRef != nil && (status.ScaleTargetRef.Kind != spec.ScaleTargetRef.Kind || status.ScaleTargetRef.ApiVersion != spec.ScaleTargetRef.ApiVersion ||
-		status.ScaleTargetRef.Name != spec.ScaleTargetRef.Name) {
+		status.ScaleTargetRef.Name != spec.ScaleTargetRef.Name || status.ScaleTargetRef.ReplicasPath != spec.ScaleTargetRef.ReplicasPath ||
+		!equality.Semantic.DeepEqual(status.ScaleTargetRef.Cluster, spec.ScaleTargetRef.Cluster)) {
 		return true
 	}
 
@@ -5,18 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/lib"
 	"github.com/ringtail/go-cron"
 	"github.com/satori/go.uuid"
 	autoscalingapi "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	scaleclient "k8s.io/client-go/scale"
 	log "k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,7 +38,7 @@ type CronJob interface {
 	Equals(Job CronJob) bool
 	SchedulePlan() string
 	Ref() *TargetRef
-	CronHPAMeta() *v1beta1.CronHorizontalPodAutoscaler
+	CronHPAMeta() metav1.Object
 	Run() (msg string, err error)
 }
 
@@ -43,25 +48,101 @@ type TargetRef struct {
 	RefKind      string
 	RefGroup     string
 	RefVersion   string
+	// JSON pointer of the replicas field, the scale subresource is used if it's empty.
+	ReplicasPath string
+	// kubeconfig Secret of the remote cluster, the target is in the controller cluster if it's empty.
+	Cluster    string
+	ClusterKey string
 }
 
 // needed when compare equals.
 func (tr *TargetRef) toString() string {
-	return fmt.Sprintf("%s:%s:%s:%s:%s", tr.RefName, tr.RefNamespace, tr.RefKind, tr.RefGroup, tr.RefVersion)
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%s:%s:%s", tr.RefName, tr.RefNamespace, tr.RefKind, tr.RefGroup, tr.RefVersion, tr.ReplicasPath, tr.Cluster, tr.ClusterKey)
 }
 
 type CronJobHPA struct {
+	sync.Mutex
 	TargetRef    *TargetRef
+	Distribution []*WeightedTargetRef
 	HPARef       *v1beta1.CronHorizontalPodAutoscaler
 	id           string
 	name         string
 	DesiredSize  int32
 	Plan         string
 	RunOnce      bool
-	scaler       scaleclient.ScalesGetter
-	mapper       apimeta.RESTMapper
-	excludeDates []string
-	client       client.Client
+	Action       v1beta1.JobAction
+	// TargetSizeExpr computes the target size at fire time in place of DesiredSize.
+	TargetSizeExpr string
+	sizeExpr       lib.Expr
+	// TargetSizeFrom reads the target size at fire time in place of DesiredSize.
+	TargetSizeFrom *v1beta1.TargetSizeSource
+	scaler         scaleclient.ScalesGetter
+	mapper         apimeta.RESTMapper
+	excludeDates   []string
+	client         client.Client
+	sleeper        *namespaceSleeper
+	// state of the namespace after the last sleep or wake
+	sleepStatus *v1beta1.SleepStatus
+	// result of the last evaluation of TargetSizeExpr or TargetSizeFrom
+	evaluatedSize *int32
+	sizeSource    string
+	// allowed hosts of the http source of TargetSizeFrom
+	sizeSourceHosts *AllowedHosts
+	// patch of the patch action
+	patchType    types.PatchType
+	patchData    []byte
+	storeInverse bool
+	inversePatch *v1beta1.InversePatch
+	inverses     *InverseStore
+	// name of the job reverted by the revert action
+	revertOf string
+	// bounds and update mode of the vpa action
+	vpa *v1beta1.VPASpec
+	// target served by an external scaler
+	external      *v1beta1.ExternalTarget
+	externalHosts *AllowedHosts
+	dynamicClient dynamic.Interface
+	// clients of the remote clusters of the targets
+	clusters *ClusterCache
+	// ServiceAccount impersonated to change the targets in the cluster of the controller
+	serviceAccount string
+	// author impersonated if serviceAccount is empty and the controller impersonates the authors
+	author       string
+	authorGroups []string
+	identities   *IdentityCache
+	// freezes skipping the job
+	freezes *FreezeGate
+	// namespace whose CronHPAPolicies are enforced on a job of a clusterCronHPA, which has no HPARef
+	policyNamespace string
+	// thresholds of the changes needing approval
+	approval  *v1beta1.ApprovalPolicy
+	approvals *ApprovalQueue
+	// quota and capacity check of the scale-ups, and its results of the last execution
+	preflightPolicy *v1beta1.PreflightPolicy
+	capacity        *CapacityCache
+	preflights      []v1beta1.PreflightStatus
+	// balloon pods created ahead of the schedule, and the fire time they are created for
+	prewarm      *v1beta1.PrewarmSpec
+	prewarmedFor time.Time
+	// images pulled ahead of the schedule, the fire time they are pulled for and the progress
+	prepull       *v1beta1.PrepullSpec
+	prepulledFor  time.Time
+	prepullStatus *v1beta1.PrepullStatus
+	// scale-downs kept within the PodDisruptionBudgets, and their clamps of the last execution
+	pdbPolicy *v1beta1.PDBPolicy
+	pdbClamps []v1beta1.PDBClampStatus
+	steps     *ScaleDownStepper
+	// order the pods are removed in by the scale-downs
+	scaleDownPreference *v1beta1.ScaleDownPreference
+	// scales deferred while the target is in a rollout
+	waitForRollout *v1beta1.RolloutWaitPolicy
+	rollouts       *RolloutWaiter
+	// the job fires earlier than the schedule by the time the target took to become Ready
+	readyBy     bool
+	readiness   *ReadinessHistory
+	scheduledAt time.Time
+	fireAt      time.Time
+	firedFor    time.Time
 }
 
 func (ch *CronJobHPA) SetID(id string) {
@@ -78,10 +159,34 @@ func (ch *CronJobHPA) ID() string {
 
 func (ch *CronJobHPA) Equals(j CronJob) bool {
 	// update will create a new uuid
-	if ch.id == j.ID() && ch.SchedulePlan() == j.SchedulePlan() && ch.Ref().toString() == j.Ref().toString() {
-		return true
+	if ch.id != j.ID() || ch.SchedulePlan() != j.SchedulePlan() || ch.Ref().toString() != j.Ref().toString() {
+		return false
 	}
-	return false
+	// the size of every target depends on both the target size and the distribution
+	if other, ok := j.(*CronJobHPA); ok {
+		if ch.Action != other.Action || ch.sleepExcludeLabel() != other.sleepExcludeLabel() || ch.TargetSizeExpr != other.TargetSizeExpr ||
+			!equality.Semantic.DeepEqual(ch.TargetSizeFrom, other.TargetSizeFrom) ||
+			ch.patchType != other.patchType || string(ch.patchData) != string(other.patchData) ||
+			ch.storeInverse != other.storeInverse || ch.revertOf != other.revertOf || ch.serviceAccount != other.serviceAccount ||
+			ch.author != other.author || !equality.Semantic.DeepEqual(ch.authorGroups, other.authorGroups) ||
+			!equality.Semantic.DeepEqual(ch.vpa, other.vpa) || !equality.Semantic.DeepEqual(ch.external, other.external) ||
+			!equality.Semantic.DeepEqual(ch.preflightPolicy, other.preflightPolicy) || !equality.Semantic.DeepEqual(ch.prewarm, other.prewarm) ||
+			!equality.Semantic.DeepEqual(ch.prepull, other.prepull) || ch.readyBy != other.readyBy ||
+			!equality.Semantic.DeepEqual(ch.pdbPolicy, other.pdbPolicy) ||
+			!equality.Semantic.DeepEqual(ch.scaleDownPreference, other.scaleDownPreference) ||
+			!equality.Semantic.DeepEqual(ch.waitForRollout, other.waitForRollout) {
+			return false
+		}
+		return ch.DesiredSize == other.DesiredSize && distributionToString(ch.Distribution) == distributionToString(other.Distribution)
+	}
+	return true
+}
+
+func (ch *CronJobHPA) sleepExcludeLabel() string {
+	if ch.sleeper == nil {
+		return ""
+	}
+	return ch.sleeper.excludeLabel
 }
 
 func (ch *CronJobHPA) SchedulePlan() string {
@@ -92,16 +197,130 @@ func (ch *CronJobHPA) Ref() *TargetRef {
 	return ch.TargetRef
 }
 
-func (ch *CronJobHPA) CronHPAMeta() *v1beta1.CronHorizontalPodAutoscaler {
+func (ch *CronJobHPA) CronHPAMeta() metav1.Object {
 	return ch.HPARef
 }
 
 func (ch *CronJobHPA) Run() (msg string, err error) {
+	ch.releaseBalloons()
+	ch.cleanupPrepull()
 
 	if skip, msg := IsTodayOff(ch.excludeDates); skip {
 		return msg, nil
 	}
+	if err := ch.freezes.check(ch, ch.HPARef.Namespace, labels.Set(ch.HPARef.Labels)); err != nil {
+		return "", err
+	}
+	ch.Lock()
+	ch.preflights = nil
+	ch.pdbClamps = nil
+	ch.Unlock()
+
+	if isSleepAction(ch.Action) {
+		return ch.runSleeper()
+	}
+	if ch.Action == v1beta1.PatchAction {
+		return ch.runPatch()
+	}
+	if ch.Action == v1beta1.RevertAction {
+		return ch.runRevert()
+	}
+	if ch.Action == v1beta1.VPAAction {
+		return ch.runVPA()
+	}
+	if len(ch.Distribution) != 0 {
+		return ch.runDistribution()
+	}
+	if ch.sizeExpr != nil {
+		size, evalMsg, err := ch.evaluateTargetSize(ch.TargetRef)
+		if err != nil {
+			return "", err
+		}
+		if err := ch.requireApproval([]*TargetRef{ch.TargetRef}, []int32{size}); err != nil {
+			return evalMsg, err
+		}
+		msg, err = ch.scaleWithRetry(ch.TargetRef, size)
+		return evalMsg + " " + msg, err
+	}
+	if ch.TargetSizeFrom != nil {
+		size, resolveMsg, err := ch.resolveTargetSize()
+		if err != nil {
+			return "", err
+		}
+		if err := ch.requireApproval([]*TargetRef{ch.TargetRef}, []int32{size}); err != nil {
+			return resolveMsg, err
+		}
+		msg, err = ch.scaleWithRetry(ch.TargetRef, size)
+		return resolveMsg + " " + msg, err
+	}
+	if err := ch.requireApproval([]*TargetRef{ch.TargetRef}, []int32{ch.DesiredSize}); err != nil {
+		return "", err
+	}
+	return ch.scaleWithRetry(ch.TargetRef, ch.DesiredSize)
+}
 
+func (ch *CronJobHPA) scaleWithRetry(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	// a job changing the target stops the wait of its deferred scale
+	ch.rollouts.stop(ref)
+	if err := ch.deferForRollout(ref, desiredSize); err != nil {
+		return "", err
+	}
+	return ch.scaleTarget(ref, desiredSize)
+}
+
+// scaleTarget scales the target after the preflight, the clamp and the policies.
+func (ch *CronJobHPA) scaleTarget(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	desiredSize, preflightMsg, err := ch.preflight(ref, desiredSize)
+	if err != nil {
+		return "", err
+	}
+	if preflightMsg != "" {
+		defer func() {
+			msg = preflightMsg + " " + msg
+		}()
+	}
+	// a job changing the target stops its step-wise scale-down
+	ch.steps.stop(ref)
+	requestedSize := desiredSize
+	desiredSize, clampMsg, stepping, err := ch.clampScaleDown(ref, desiredSize)
+	if err != nil {
+		return "", err
+	}
+	if clampMsg != "" {
+		defer func() {
+			msg = clampMsg + " " + msg
+		}()
+	}
+	if stepping {
+		defer func() {
+			if err == nil {
+				ch.steps.start(ch, ref, desiredSize, requestedSize)
+			}
+		}()
+	}
+	// a violation is not retried
+	if err := ch.enforcePolicies(ref, desiredSize); err != nil {
+		return "", err
+	}
+	if ch.readyBy {
+		start := time.Now()
+		defer func() {
+			if err == nil {
+				go ch.measureReady(ref, desiredSize, start)
+			}
+		}()
+	}
+	msg, err = ch.retryScale(ref, desiredSize)
+	return msg, err
+}
+
+// retryScale scales the target to the size, and retries until maxRetryTimeout.
+func (ch *CronJobHPA) retryScale(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	if cleanup := ch.preferScaleDown(ref, desiredSize); cleanup != nil {
+		defer func() {
+			go cleanup()
+		}()
+	}
 	startTime := time.Now()
 	times := 0
 	for {
@@ -109,17 +328,37 @@ func (ch *CronJobHPA) Run() (msg string, err error) {
 
 		// timeout and exit
 		if startTime.Add(maxRetryTimeout).Before(now) {
-			return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d after retrying %d times and exit,because of %v", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace, ch.DesiredSize, times, err)
+			return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d after retrying %d times and exit,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, desiredSize, times, err)
 		}
 
 		// hpa compatible
-		if ch.TargetRef.RefKind == "HorizontalPodAutoscaler" {
-			msg, err = ch.ScaleHPA()
+		if ref.RefKind == externalKind {
+			msg, err = ch.ScaleExternal(ref, desiredSize)
+			if err == nil {
+				break
+			}
+		} else if ref.ReplicasPath != "" {
+			msg, err = ch.ScalePathRef(ref, desiredSize)
+			if err == nil {
+				break
+			}
+		} else if ref.RefKind == "HorizontalPodAutoscaler" {
+			msg, err = ch.ScaleHPA(ref, desiredSize)
+			if err == nil {
+				break
+			}
+		} else if isKEDAScaledObject(ref) {
+			msg, err = ch.ScaleKEDA(ref, desiredSize)
+			if err == nil {
+				break
+			}
+		} else if isKnativeTarget(ref) {
+			msg, err = ch.ScaleKnative(ref, desiredSize)
 			if err == nil {
 				break
 			}
 		} else {
-			msg, err = ch.ScalePlainRef()
+			msg, err = ch.ScalePlainRef(ref, desiredSize)
 			if err == nil {
 				break
 			}
@@ -131,13 +370,17 @@ func (ch *CronJobHPA) Run() (msg string, err error) {
 	return msg, err
 }
 
-func (ch *CronJobHPA) ScaleHPA() (msg string, err error) {
+func (ch *CronJobHPA) ScaleHPA(ref *TargetRef, desiredSize int32) (msg string, err error) {
 	var scale *autoscalingapi.Scale
 	var targetGR schema.GroupResource
 
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return "", err
+	}
 	ctx := context.Background()
 	hpa := &autoscalingapi.HorizontalPodAutoscaler{}
-	err = ch.client.Get(ctx, types.NamespacedName{Namespace: ch.HPARef.Namespace, Name: ch.TargetRef.RefName}, hpa)
+	err = clients.client.Get(ctx, types.NamespacedName{Namespace: ref.RefNamespace, Name: ref.RefName}, hpa)
 
 	if err != nil {
 		return "", fmt.Errorf("Failed to get HorizontalPodAutoscaler Ref,because of %v", err)
@@ -155,7 +398,7 @@ func (ch *CronJobHPA) ScaleHPA() (msg string, err error) {
 		Group: targetGV.Group,
 	}
 
-	mappings, err := ch.mapper.RESTMappings(targetGK)
+	mappings, err := clients.mapper.RESTMappings(targetGK)
 	if err != nil {
 		return "", fmt.Errorf("Failed to create mapping,because of %v", err)
 	}
@@ -163,7 +406,7 @@ func (ch *CronJobHPA) ScaleHPA() (msg string, err error) {
 	found := false
 	for _, mapping := range mappings {
 		targetGR = mapping.Resource.GroupResource()
-		scale, err = ch.scaler.Scales(ch.TargetRef.RefNamespace).Get(context.Background(), targetGR, targetRef.Name, v1.GetOptions{})
+		scale, err = clients.scaler.Scales(ref.RefNamespace).Get(context.Background(), targetGR, targetRef.Name, v1.GetOptions{})
 		if err == nil {
 			found = true
 			break
@@ -171,64 +414,54 @@ func (ch *CronJobHPA) ScaleHPA() (msg string, err error) {
 	}
 
 	if found == false {
-		log.Errorf("failed to found source target %s %s in %s namespace", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace)
-		return "", fmt.Errorf("failed to found source target %s %s in %s namespace, err is %v", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace, err)
-	}
-
-	updateHPA := false
-
-	if ch.DesiredSize > hpa.Spec.MaxReplicas {
-		hpa.Spec.MaxReplicas = ch.DesiredSize
-		updateHPA = true
-	}
-
-	if ch.DesiredSize < *hpa.Spec.MinReplicas {
-		*hpa.Spec.MinReplicas = ch.DesiredSize
-		updateHPA = true
+		log.Errorf("failed to found source target %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace)
+		return "", fmt.Errorf("failed to found source target %s %s in %s namespace, err is %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
 	}
 
-	//
-	if hpa.Status.CurrentReplicas == *hpa.Spec.MinReplicas && ch.DesiredSize < hpa.Status.CurrentReplicas {
-		*hpa.Spec.MinReplicas = ch.DesiredSize
-		updateHPA = true
-	}
-
-	if hpa.Status.CurrentReplicas < ch.DesiredSize {
-		*hpa.Spec.MinReplicas = ch.DesiredSize
-		updateHPA = true
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
 	}
+	newMin, newMax := autoscalerBounds(minReplicas, hpa.Spec.MaxReplicas, hpa.Status.CurrentReplicas, desiredSize)
+	updateHPA := newMin != minReplicas || newMax != hpa.Spec.MaxReplicas
+	hpa.Spec.MinReplicas = &newMin
+	hpa.Spec.MaxReplicas = newMax
 
 	if updateHPA {
-		err = ch.client.Update(ctx, hpa)
+		err = clients.client.Update(ctx, hpa)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	if hpa.Status.CurrentReplicas >= ch.DesiredSize {
+	if hpa.Status.CurrentReplicas >= desiredSize {
 		// skip change replicas and exit
-		return fmt.Sprintf("Skip scale replicas because HPA %s current replicas:%d >= desired replicas:%d.", hpa.Name, scale.Spec.Replicas, ch.DesiredSize), nil
+		return fmt.Sprintf("Skip scale replicas because HPA %s current replicas:%d >= desired replicas:%d.", hpa.Name, scale.Spec.Replicas, desiredSize), nil
 	}
 
-	msg = fmt.Sprintf("current replicas:%d, desired replicas:%d.", scale.Spec.Replicas, ch.DesiredSize)
+	msg = fmt.Sprintf("current replicas:%d, desired replicas:%d.", scale.Spec.Replicas, desiredSize)
 
-	scale.Spec.Replicas = int32(ch.DesiredSize)
-	_, err = ch.scaler.Scales(ch.TargetRef.RefNamespace).Update(context.Background(), targetGR, scale, metav1.UpdateOptions{})
+	scale.Spec.Replicas = int32(desiredSize)
+	_, err = clients.scaler.Scales(ref.RefNamespace).Update(context.Background(), targetGR, scale, metav1.UpdateOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d, because of %v", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace, ch.DesiredSize, err)
+		return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d, because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, desiredSize, err)
 	}
 	return msg, nil
 }
 
-func (ch *CronJobHPA) ScalePlainRef() (msg string, err error) {
+func (ch *CronJobHPA) ScalePlainRef(ref *TargetRef, desiredSize int32) (msg string, err error) {
 	var scale *autoscalingapi.Scale
 	var targetGR schema.GroupResource
 
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return "", err
+	}
 	targetGK := schema.GroupKind{
-		Group: ch.TargetRef.RefGroup,
-		Kind:  ch.TargetRef.RefKind,
+		Group: ref.RefGroup,
+		Kind:  ref.RefKind,
 	}
-	mappings, err := ch.mapper.RESTMappings(targetGK)
+	mappings, err := clients.mapper.RESTMappings(targetGK)
 	if err != nil {
 		return "", fmt.Errorf("Failed to create create mapping,because of %v", err)
 	}
@@ -236,25 +469,25 @@ func (ch *CronJobHPA) ScalePlainRef() (msg string, err error) {
 	found := false
 	for _, mapping := range mappings {
 		targetGR = mapping.Resource.GroupResource()
-		scale, err = ch.scaler.Scales(ch.TargetRef.RefNamespace).Get(context.Background(), targetGR, ch.TargetRef.RefName, v1.GetOptions{})
+		scale, err = clients.scaler.Scales(ref.RefNamespace).Get(context.Background(), targetGR, ref.RefName, v1.GetOptions{})
 		if err == nil {
 			found = true
-			log.Infof("%s %s in namespace %s has been scaled successfully. job: %s replicas: %d", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace, ch.Name(), ch.DesiredSize)
+			log.Infof("%s %s in namespace %s has been scaled successfully. job: %s replicas: %d", ref.RefKind, ref.RefName, ref.RefNamespace, ch.Name(), desiredSize)
 			break
 		}
 	}
 
 	if found == false {
-		log.Errorf("failed to find source target %s %s in %s namespace", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace)
-		return "", fmt.Errorf("failed to find source target %s %s in %s namespace", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace)
+		log.Errorf("failed to find source target %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace)
+		return "", fmt.Errorf("failed to find source target %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace)
 	}
 
-	msg = fmt.Sprintf("current replicas:%d, desired replicas:%d.", scale.Spec.Replicas, ch.DesiredSize)
+	msg = fmt.Sprintf("current replicas:%d, desired replicas:%d.", scale.Spec.Replicas, desiredSize)
 
-	scale.Spec.Replicas = int32(ch.DesiredSize)
-	_, err = ch.scaler.Scales(ch.TargetRef.RefNamespace).Update(context.Background(), targetGR, scale, metav1.UpdateOptions{})
+	scale.Spec.Replicas = int32(desiredSize)
+	_, err = clients.scaler.Scales(ref.RefNamespace).Update(context.Background(), targetGR, scale, metav1.UpdateOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d, because of %v", ch.TargetRef.RefKind, ch.TargetRef.RefName, ch.TargetRef.RefNamespace, ch.DesiredSize, err)
+		return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d, because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, desiredSize, err)
 	}
 	return msg, nil
 }
@@ -270,36 +503,235 @@ func checkPlanValid(plan string) error {
 	return nil
 }
 
-func CronHPAJobFactory(instance *v1beta1.CronHorizontalPodAutoscaler, job v1beta1.Job, scaler scaleclient.ScalesGetter, mapper apimeta.RESTMapper, client client.Client) (CronJob, error) {
-	arr := strings.Split(instance.Spec.ScaleTargetRef.ApiVersion, "/")
-	group := arr[0]
-	version := arr[1]
+func newTargetRef(scaleTargetRef v1beta1.ScaleTargetRef, namespace string) (*TargetRef, error) {
+	gv, err := schema.ParseGroupVersion(scaleTargetRef.ApiVersion)
+	if err != nil {
+		return nil, err
+	}
 	ref := &TargetRef{
-		RefName:      instance.Spec.ScaleTargetRef.Name,
-		RefKind:      instance.Spec.ScaleTargetRef.Kind,
-		RefNamespace: instance.Namespace,
-		RefGroup:     group,
-		RefVersion:   version,
+		RefName:      scaleTargetRef.Name,
+		RefKind:      scaleTargetRef.Kind,
+		RefNamespace: namespace,
+		RefGroup:     gv.Group,
+		RefVersion:   gv.Version,
+		ReplicasPath: scaleTargetRef.ReplicasPath,
+	}
+	if err := setCluster(ref, scaleTargetRef.Cluster); err != nil {
+		return nil, err
 	}
-
 	if err := checkRefValid(ref); err != nil {
 		return nil, err
 	}
+	if ref.ReplicasPath != "" {
+		if _, err := parseJSONPointer(ref.ReplicasPath); err != nil {
+			return nil, err
+		}
+		if ref.RefKind == "HorizontalPodAutoscaler" {
+			return nil, errors.New("replicasPath could not be used with HorizontalPodAutoscaler")
+		}
+	}
+	return ref, nil
+}
+
+func CronHPAJobFactory(instance *v1beta1.CronHorizontalPodAutoscaler, job v1beta1.Job, scaler scaleclient.ScalesGetter, mapper apimeta.RESTMapper, client client.Client,
+	dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface, clusters *ClusterCache, identities *IdentityCache, freezes *FreezeGate, approvals *ApprovalQueue, readiness *ReadinessHistory, steps *ScaleDownStepper, rollouts *RolloutWaiter, inverses *InverseStore, capacity *CapacityCache, sizeSourceHosts *AllowedHosts, externalHosts *AllowedHosts) (CronJob, error) {
+	var (
+		ref          *TargetRef
+		distribution []*WeightedTargetRef
+		sleeper      *namespaceSleeper
+		sizeExpr     lib.Expr
+		patchType    types.PatchType
+		patchData    []byte
+		external     *v1beta1.ExternalTarget
+		err          error
+	)
+	switch job.Action {
+	case "", v1beta1.ScaleAction, v1beta1.SleepAction, v1beta1.WakeAction, v1beta1.PatchAction, v1beta1.RevertAction, v1beta1.VPAAction:
+	default:
+		return nil, fmt.Errorf("unknown action %s of job %s", job.Action, job.Name)
+	}
+	if err := identities.checkServiceAccount(instance.Spec.ServiceAccountName); err != nil {
+		return nil, err
+	}
+	if err := identities.checkClusters(specClusters(instance.Spec)); err != nil {
+		return nil, err
+	}
+	author, authorGroups, err := identities.authorOf(instance.Spec.ServiceAccountName, instance.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if (job.Patch != nil) != (job.Action == v1beta1.PatchAction) {
+		return nil, fmt.Errorf("patch of job %s should be set for and only for patch action", job.Name)
+	}
+	if (job.RevertOf != "") != (job.Action == v1beta1.RevertAction) {
+		return nil, fmt.Errorf("revertOf of job %s should be set for and only for revert action", job.Name)
+	}
+
+	if (job.VPA != nil) != (job.Action == v1beta1.VPAAction) {
+		return nil, fmt.Errorf("vpa of job %s should be set for and only for vpa action", job.Name)
+	}
+
+	if job.Action == v1beta1.VPAAction {
+		ref, err = newVPATarget(job.VPA, instance.Namespace, mapper)
+		if err != nil {
+			return nil, err
+		}
+	} else if job.Action == v1beta1.PatchAction {
+		patchType, patchData, err = parsePatch(job.Patch)
+		if err != nil {
+			return nil, err
+		}
+		target := instance.Spec.ScaleTargetRef
+		if job.Patch.Target != nil {
+			target = *job.Patch.Target
+		}
+		ref, err = newPatchTarget(target, instance.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		// the kinds of a remote cluster are discovered at fire time
+		if _, err := mapper.RESTMapping(schema.GroupKind{Group: ref.RefGroup, Kind: ref.RefKind}, ref.RefVersion); ref.Cluster == "" && err != nil {
+			return nil, fmt.Errorf("failed to find resource of patch target %s,because of %v", target.Kind, err)
+		}
+	} else if job.Action == v1beta1.RevertAction {
+		// the target is known from the inverse patch in status at fire time
+		ref = &TargetRef{
+			RefName:      job.RevertOf,
+			RefNamespace: instance.Namespace,
+			RefKind:      "Revert",
+		}
+	} else if isSleepAction(job.Action) {
+		// the sleep and wake action take care of the whole namespace
+		ref = &TargetRef{
+			RefName:      instance.Namespace,
+			RefNamespace: instance.Namespace,
+			RefKind:      "Namespace",
+			RefVersion:   "v1",
+		}
+		sleepDynamicClient, sleepScaler := dynamicClient, scaler
+		if sa := instance.Spec.ServiceAccountName; sa != "" || author != "" {
+			clients, err := identities.clientsOf(instance.Namespace, sa, author, authorGroups)
+			if err != nil {
+				return nil, fmt.Errorf("failed to impersonate the identity of the job,because of %v", err)
+			}
+			sleepDynamicClient, sleepScaler = clients.dynamicClient, clients.scaler
+		}
+		sleeper = newNamespaceSleeper(instance.Namespace, instance.Spec.Sleep, discoveryClient, sleepDynamicClient, sleepScaler)
+	} else if instance.Spec.External != nil {
+		if instance.Spec.Distribution != nil {
+			return nil, errors.New("external and distribution could not be set at the same time")
+		}
+		ref, err = newExternalTarget(instance.Spec.External, instance.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !externalHosts.allowedAddress(instance.Spec.External.Address) {
+			return nil, fmt.Errorf("address %s of external is not allowed by the controller, see --externalScalerHosts", instance.Spec.External.Address)
+		}
+		external = instance.Spec.External
+	} else if instance.Spec.Distribution != nil {
+		distribution, err = newDistribution(instance.Spec.Distribution, instance.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		ref = distribution[0].TargetRef
+	} else {
+		ref, err = newTargetRef(instance.Spec.ScaleTargetRef, instance.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if job.TargetSizeFrom != nil {
+		if !isScaleAction(job.Action) || distribution != nil || job.TargetSizeExpr != "" {
+			return nil, fmt.Errorf("targetSizeFrom of job %s could not be used with targetSizeExpr, distribution or actions other than scale", job.Name)
+		}
+		if err := checkTargetSizeSource(job.TargetSizeFrom, sizeSourceHosts); err != nil {
+			return nil, err
+		}
+	}
+	if job.TargetSizeExpr != "" {
+		if !isScaleAction(job.Action) || distribution != nil {
+			return nil, fmt.Errorf("targetSizeExpr of job %s could not be used with distribution or actions other than scale", job.Name)
+		}
+		sizeExpr, err = parseTargetSizeExpr(job.TargetSizeExpr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := checkPlanValid(job.Schedule); err != nil {
 		return nil, err
 	}
+	if err := checkPreflightPolicy(instance.Spec.Preflight); err != nil {
+		return nil, err
+	}
+	if err := checkScaleDownPreference(instance.Spec.ScaleDownPreference); err != nil {
+		return nil, err
+	}
+	if err := checkPrewarm(job, distribution, external); err != nil {
+		return nil, err
+	}
+	if err := checkPrepull(job, distribution, external); err != nil {
+		return nil, err
+	}
+	if err := checkReadyBy(job, distribution, external); err != nil {
+		return nil, err
+	}
+	if err := checkWaitForRollout(instance.Spec.WaitForRollout, distribution, external); err != nil {
+		return nil, err
+	}
+	if job.ReadyBy && readiness != nil {
+		readiness.seed(targetKey(ref), instance.Status.ReadyDurations)
+	}
 	return &CronJobHPA{
-		id:           uuid.Must(uuid.NewV4(), nil).String(),
-		TargetRef:    ref,
-		HPARef:       instance,
-		name:         job.Name,
-		Plan:         job.Schedule,
-		DesiredSize:  job.TargetSize,
-		RunOnce:      job.RunOnce,
-		scaler:       scaler,
-		mapper:       mapper,
-		excludeDates: instance.Spec.ExcludeDates,
-		client:       client,
+		id:              uuid.Must(uuid.NewV4(), nil).String(),
+		TargetRef:       ref,
+		Distribution:    distribution,
+		HPARef:          instance,
+		name:            job.Name,
+		Plan:            job.Schedule,
+		DesiredSize:     job.TargetSize,
+		RunOnce:         job.RunOnce,
+		Action:          job.Action,
+		scaler:          scaler,
+		mapper:          mapper,
+		excludeDates:    instance.Spec.ExcludeDates,
+		client:          client,
+		sleeper:         sleeper,
+		TargetSizeExpr:  job.TargetSizeExpr,
+		sizeExpr:        sizeExpr,
+		TargetSizeFrom:  job.TargetSizeFrom,
+		dynamicClient:   dynamicClient,
+		patchType:       patchType,
+		patchData:       patchData,
+		storeInverse:    job.Patch != nil && job.Patch.StoreInverse,
+		inverses:        inverses,
+		sizeSourceHosts: sizeSourceHosts,
+		revertOf:        job.RevertOf,
+		vpa:             job.VPA,
+		external:        external,
+		externalHosts:   externalHosts,
+		clusters:        clusters,
+		serviceAccount:  instance.Spec.ServiceAccountName,
+		author:          author,
+		authorGroups:    authorGroups,
+		identities:      identities,
+		freezes:         freezes,
+		approval:        instance.Spec.Approval,
+		approvals:       approvals,
+		preflightPolicy: instance.Spec.Preflight,
+		capacity:        capacity,
+		prewarm:         job.Prewarm,
+		prepull:         job.PrepullImages,
+		readyBy:         job.ReadyBy,
+		readiness:       readiness,
+		pdbPolicy:       instance.Spec.PDB,
+		steps:           steps,
+
+		scaleDownPreference: instance.Spec.ScaleDownPreference,
+		waitForRollout:      instance.Spec.WaitForRollout,
+		rollouts:            rollouts,
 	}, nil
 }
 
@@ -11,7 +11,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
@@ -19,6 +21,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	log "k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
 	"sync"
 	"time"
 )
@@ -43,7 +46,30 @@ type CronManager struct {
 	cronExecutor  CronExecutor
 	mapper        meta.RESTMapper
 	scaler        scale.ScalesGetter
+	dynamicClient dynamic.Interface
+	discovery     discovery.DiscoveryInterface
 	eventRecorder record.EventRecorder
+	clusters      *ClusterCache
+	identities    *IdentityCache
+	freezes       *FreezeGate
+	approvals     *ApprovalQueue
+	readiness     *ReadinessHistory
+	steps         *ScaleDownStepper
+	rollouts      *RolloutWaiter
+	inverses      *InverseStore
+	capacity      *CapacityCache
+	// allowed hosts of the http sources of targetSizeFrom
+	sizeSourceHosts *AllowedHosts
+	// allowed hosts of the notifyURL of approval
+	notifyHosts *AllowedHosts
+	// allowed addresses of the external scalers
+	externalHosts *AllowedHosts
+}
+
+// cronHPAObject is either a CronHorizontalPodAutoscaler or a ClusterCronHorizontalPodAutoscaler.
+type cronHPAObject interface {
+	runtime.Object
+	metav1.Object
 }
 
 func (cm *CronManager) createOrUpdate(j CronJob) error {
@@ -55,18 +81,19 @@ func (cm *CronManager) createOrUpdate(j CronJob) error {
 			return fmt.Errorf("Failed to add job to cronExecutor,because of %v", err)
 		}
 		cm.jobQueue[j.ID()] = j
-		log.Infof("cronHPA job %s of cronHPA %s in %s created, %d active jobs exist", j.Name(), j.CronHPAMeta().Name, j.CronHPAMeta().Namespace,
+		log.Infof("cronHPA job %s of cronHPA %s in %s created, %d active jobs exist", j.Name(), j.CronHPAMeta().GetName(), j.CronHPAMeta().GetNamespace(),
 			len(cm.jobQueue))
 	} else {
 		job := cm.jobQueue[j.ID()]
 		if ok := job.Equals(j); !ok {
 			err := cm.cronExecutor.Update(j)
 			if err != nil {
-				return fmt.Errorf("failed to update job %s of cronHPA %s in %s to cronExecutor, because of %v", job.Name(), job.CronHPAMeta().Name, job.CronHPAMeta().Namespace, err)
+				return fmt.Errorf("failed to update job %s of cronHPA %s in %s to cronExecutor, because of %v", job.Name(), job.CronHPAMeta().GetName(), job.CronHPAMeta().GetNamespace(), err)
 			}
+			cm.stopJob(job)
 			//update job queue
 			cm.jobQueue[j.ID()] = j
-			log.Infof("cronHPA job %s of cronHPA %s in %s updated, %d active jobs exist", j.Name(), j.CronHPAMeta().Name, j.CronHPAMeta().Namespace, len(cm.jobQueue))
+			log.Infof("cronHPA job %s of cronHPA %s in %s updated, %d active jobs exist", j.Name(), j.CronHPAMeta().GetName(), j.CronHPAMeta().GetNamespace(), len(cm.jobQueue))
 		} else {
 			return &NoNeedUpdate{}
 		}
@@ -82,13 +109,67 @@ func (cm *CronManager) delete(id string) error {
 		if err != nil {
 			return fmt.Errorf("Failed to remove job from cronExecutor,because of %v", err)
 		}
+		cm.stopJob(j)
 		delete(cm.jobQueue, id)
-		log.Infof("Remove cronHPA job %s of cronHPA %s in %s from jobQueue,%d active jobs left", j.Name(), j.CronHPAMeta().Name, j.CronHPAMeta().Namespace, len(cm.jobQueue))
+		log.Infof("Remove cronHPA job %s of cronHPA %s in %s from jobQueue,%d active jobs left", j.Name(), j.CronHPAMeta().GetName(), j.CronHPAMeta().GetNamespace(), len(cm.jobQueue))
 	}
 	return nil
 }
 
+// stopJob stops the work the removed or replaced job left running in the background, so that it doesn't change
+// the targets any more.
+func (cm *CronManager) stopJob(j CronJob) {
+	if ch, ok := j.(*CronJobHPA); ok {
+		cm.steps.stopJob(ch)
+		cm.rollouts.stopJob(ch)
+	}
+}
+
+// RequireServiceAccount refuses the jobs of the cronHPAs without serviceAccountName.
+func (cm *CronManager) RequireServiceAccount(required bool) {
+	cm.identities.Lock()
+	cm.identities.required = required
+	cm.identities.Unlock()
+}
+
+// ImpersonateAuthors makes the jobs of the cronHPAs without serviceAccountName impersonate the authors recorded by
+// the webhook, the cronHPAs without the author are refused.
+func (cm *CronManager) ImpersonateAuthors(enabled bool) {
+	cm.identities.Lock()
+	cm.identities.impersonateAuthors = enabled
+	cm.identities.Unlock()
+}
+
+// SetPauseConfigMap sets the ConfigMap of the global pause of all jobs.
+func (cm *CronManager) SetPauseConfigMap(namespace, name string) {
+	cm.freezes.SetPauseConfigMap(namespace, name)
+}
+
+// SetSizeSourceHosts sets the hosts the http sources of targetSizeFrom are allowed to request.
+func (cm *CronManager) SetSizeSourceHosts(hosts []string) {
+	cm.sizeSourceHosts.Set(hosts)
+}
+
+// SetApprovalNotifyHosts sets the hosts the notifyURL of approval is allowed to post to.
+func (cm *CronManager) SetApprovalNotifyHosts(hosts []string) {
+	cm.notifyHosts.Set(hosts)
+}
+
+// SetExternalScalerHosts sets the hosts the external targets are allowed to dial.
+func (cm *CronManager) SetExternalScalerHosts(hosts []string) {
+	cm.externalHosts.Set(hosts)
+}
+
+// SetInversePatchConfigMap sets the ConfigMap keeping the inverse patches of the patch and vpa jobs.
+func (cm *CronManager) SetInversePatchConfigMap(namespace, name string) {
+	cm.inverses.SetConfigMap(namespace, name)
+}
+
 func (cm *CronManager) JobResultHandler(js *cron.JobResult) {
+	if job, ok := js.Ref.(*ClusterCronJobHPA); ok {
+		cm.clusterJobResultHandler(job, js)
+		return
+	}
 	job := js.Ref.(*CronJobHPA)
 	cronHpa := js.Ref.(*CronJobHPA).HPARef
 	instance := &autoscalingv1beta1.CronHorizontalPodAutoscaler{}
@@ -104,33 +185,38 @@ func (cm *CronManager) JobResultHandler(js *cron.JobResult) {
 
 	deepCopy := instance.DeepCopy()
 
-	var (
-		state     autoscalingv1beta1.JobState
-		message   string
-		eventType string
-	)
+	state, message, eventType := jobResultState(job, js)
 
-	err := js.Error
-	if err != nil {
-		state = autoscalingv1beta1.Failed
-		message = fmt.Sprintf("cron hpa failed to execute, because of %v", err)
-		eventType = v1.EventTypeWarning
-	} else {
-		state = autoscalingv1beta1.Succeed
-		message = fmt.Sprintf("cron hpa job %s executed successfully. %s", job.name, js.Msg)
-		eventType = v1.EventTypeNormal
+	condition := autoscalingv1beta1.Condition{
+		Name:           job.Name(),
+		JobId:          job.ID(),
+		RunOnce:        job.RunOnce,
+		Schedule:       job.SchedulePlan(),
+		TargetSize:     job.DesiredSize,
+		LastProbeTime:  metav1.Time{Time: time.Now()},
+		State:          state,
+		Message:        message,
+		Distribution:   job.DistributionStatus(),
+		TargetSizeExpr: job.TargetSizeExpr,
+		EvaluatedSize:  job.EvaluatedSize(),
+		SizeSource:     job.SizeSource(),
+		InversePatch:   job.InversePatch(),
+		Preflight:      job.PreflightStatus(),
+		Prepull:        job.PrepullStatus(),
+		ReadyBy:        job.ReadyByStatus(),
+		PDBClamps:      job.PDBClampStatus(),
+	}
+	if awaiting, ok := js.Error.(*AwaitingApproval); ok {
+		condition.ApprovalDeadline = &metav1.Time{Time: awaiting.Deadline}
+	}
+	if deferred, ok := js.Error.(*ScaleDeferred); ok {
+		condition.DeferredUntil = &metav1.Time{Time: deferred.Deadline}
 	}
 
-	condition := autoscalingv1beta1.Condition{
-		Name:          job.Name(),
-		JobId:         job.ID(),
-		RunOnce:       job.RunOnce,
-		Schedule:      job.SchedulePlan(),
-		TargetSize:    job.DesiredSize,
-		LastProbeTime: metav1.Time{Time: time.Now()},
-		State:         state,
-		Message:       message,
+	if sleepStatus := job.SleepStatus(); sleepStatus != nil {
+		instance.Status.Sleep = sleepStatus
 	}
+	instance.Status.Clusters = cm.clusterStatuses(instance, job)
 
 	conditions := instance.Status.Conditions
 
@@ -138,6 +224,10 @@ func (cm *CronManager) JobResultHandler(js *cron.JobResult) {
 	for index, c := range conditions {
 		if c.JobId == job.ID() || c.Name == job.Name() {
 			found = true
+			if condition.InversePatch == nil {
+				// keep the inverse of the last successful patch
+				condition.InversePatch = c.InversePatch
+			}
 			instance.Status.Conditions[index] = condition
 		}
 	}
@@ -146,19 +236,161 @@ func (cm *CronManager) JobResultHandler(js *cron.JobResult) {
 		instance.Status.Conditions = append(instance.Status.Conditions, condition)
 	}
 
-	err = cm.updateCronHPAStatusWithRetry(instance, deepCopy, job.name)
+	err := cm.updateCronHPAStatusWithRetry(instance, deepCopy, job.name)
 	if err != nil {
 		if _, ok := err.(*NoNeedUpdate); ok {
 			log.Warning("No need to update cronHPA, because it is deleted before")
 			return
 		}
 		cm.eventRecorder.Event(instance, v1.EventTypeWarning, "Failed", fmt.Sprintf("Failed to update cronhpa status: %v", err))
+	} else {
+		reason := string(state)
+		if isPolicyViolation(js.Error) {
+			reason = "PolicyViolation"
+		}
+		cm.eventRecorder.Event(instance, eventType, reason, message)
+		for _, p := range condition.Preflight {
+			if p.Decision == preflightWarned || p.Decision == preflightCapped {
+				cm.eventRecorder.Event(instance, v1.EventTypeWarning, "Preflight"+p.Decision, fmt.Sprintf("%s %s: %s", p.Kind, p.Name, p.Message))
+			}
+		}
+		for _, c := range condition.PDBClamps {
+			if c.AllowedReplicas > c.RequestedReplicas {
+				cm.eventRecorder.Event(instance, v1.EventTypeWarning, "ScaleDownClamped", fmt.Sprintf("%s %s: %s", c.Kind, c.Name, c.Message))
+			}
+		}
+	}
+	if awaiting, ok := js.Error.(*AwaitingApproval); ok && job.approval != nil && job.approval.NotifyURL != "" {
+		go notifyApproval(job.approval.NotifyURL, cm.notifyHosts, job, awaiting)
+	}
+}
+
+// approve approves the jobs in the approve annotation which await approval and removes the annotations.
+// The approved jobs are run by runApproved after the annotations are removed.
+func (cm *CronManager) approve(instance *autoscalingv1beta1.CronHorizontalPodAutoscaler) ([]*CronJobHPA, string) {
+	approvedBy := instance.Annotations[ApprovedByAnnotation]
+	jobs := make([]*CronJobHPA, 0)
+	for _, name := range ApprovedJobs(instance.Annotations) {
+		job, ok := cm.approvals.approve(instance.Namespace, instance.Name, name, approvedBy)
+		if !ok {
+			log.Warningf("Skip approval of job %s of cronHPA %s in %s namespace, because it doesn't await approval", name, instance.Name, instance.Namespace)
+			cm.eventRecorder.Event(instance, v1.EventTypeWarning, "ApprovalIgnored", fmt.Sprintf("job %s doesn't await approval", name))
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	delete(instance.Annotations, ApproveAnnotation)
+	delete(instance.Annotations, ApprovedByAnnotation)
+	return jobs, approvedBy
+}
+
+func (cm *CronManager) runApproved(jobs []*CronJobHPA, approvedBy string) {
+	for _, job := range jobs {
+		// run the latest version of the job
+		cm.Lock()
+		if current, ok := cm.jobQueue[job.ID()].(*CronJobHPA); ok {
+			job = current
+		}
+		cm.Unlock()
+		go func(job *CronJobHPA) {
+			msg, err := job.Run()
+			if approvedBy != "" {
+				msg = fmt.Sprintf("approved by %s. %s", approvedBy, msg)
+			}
+			cm.JobResultHandler(&cron.JobResult{JobId: job.ID(), Ref: job, Msg: msg, Error: err})
+		}(job)
+	}
+}
+
+// clusterStatuses updates the health of the clusters used by the job and drops the ones not in spec any more.
+func (cm *CronManager) clusterStatuses(instance *autoscalingv1beta1.CronHorizontalPodAutoscaler, job *CronJobHPA) []autoscalingv1beta1.ClusterStatus {
+	inSpec := specClusters(instance.Spec)
+	statuses := make([]autoscalingv1beta1.ClusterStatus, 0)
+	for _, s := range instance.Status.Clusters {
+		if containsString(inSpec, s.Name) && !containsString(job.Clusters(), s.Name) {
+			statuses = append(statuses, s)
+		}
+	}
+	for _, name := range job.Clusters() {
+		if s, ok := cm.clusters.Status(instance.Namespace, name); ok && containsString(inSpec, name) {
+			statuses = append(statuses, s)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func jobResultState(job CronJob, js *cron.JobResult) (state autoscalingv1beta1.JobState, message string, eventType string) {
+	switch e := js.Error.(type) {
+	case *JobFrozen:
+		return autoscalingv1beta1.Frozen, fmt.Sprintf("cron hpa job %s skipped, %v", job.Name(), e), v1.EventTypeNormal
+	case *AwaitingApproval:
+		return autoscalingv1beta1.AwaitingApproval, fmt.Sprintf("cron hpa job %s is %v. add it to %s annotation to approve", job.Name(), e, ApproveAnnotation), v1.EventTypeWarning
+	case *ApprovalExpired:
+		return autoscalingv1beta1.Expired, fmt.Sprintf("cron hpa job %s is expired, %v", job.Name(), e), v1.EventTypeWarning
+	case *ScaleDeferred:
+		return autoscalingv1beta1.Deferred, fmt.Sprintf("cron hpa job %s is %v", job.Name(), e), v1.EventTypeNormal
+	}
+	if js.Error != nil {
+		return autoscalingv1beta1.Failed, fmt.Sprintf("cron hpa failed to execute, because of %v", js.Error), v1.EventTypeWarning
+	}
+	return autoscalingv1beta1.Succeed, fmt.Sprintf("cron hpa job %s executed successfully. %s", job.Name(), js.Msg), v1.EventTypeNormal
+}
+
+func (cm *CronManager) clusterJobResultHandler(job *ClusterCronJobHPA, js *cron.JobResult) {
+	cronHpa := job.HPARef
+	instance := &autoscalingv1beta1.ClusterCronHorizontalPodAutoscaler{}
+	e := cm.client.Get(context.TODO(), types.NamespacedName{Name: cronHpa.Name}, instance)
+	if e != nil {
+		log.Errorf("Failed to fetch cronHPA job %s of clusterCronHPA %s,because of %v", job.Name(), cronHpa.Name, e)
+		return
+	}
+
+	deepCopy := instance.DeepCopy()
+	state, message, eventType := jobResultState(job, js)
+	condition := autoscalingv1beta1.ClusterCondition{
+		Condition: autoscalingv1beta1.Condition{
+			Name:          job.Name(),
+			JobId:         job.ID(),
+			RunOnce:       job.RunOnce,
+			Schedule:      job.SchedulePlan(),
+			TargetSize:    job.DesiredSize,
+			LastProbeTime: metav1.Time{Time: time.Now()},
+			State:         state,
+			Message:       message,
+		},
+		Namespaces: job.NamespaceSummaries(),
+	}
+
+	found := false
+	for index, c := range instance.Status.Conditions {
+		if c.JobId == job.ID() || c.Name == job.Name() {
+			found = true
+			instance.Status.Conditions[index] = condition
+		}
+	}
+	if !found {
+		instance.Status.Conditions = append(instance.Status.Conditions, condition)
+	}
+
+	err := cm.updateCronHPAStatusWithRetry(instance, deepCopy, job.name)
+	if err != nil {
+		if _, ok := err.(*NoNeedUpdate); ok {
+			log.Warning("No need to update clusterCronHPA, because it is deleted before")
+			return
+		}
+		cm.eventRecorder.Event(instance, v1.EventTypeWarning, "Failed", fmt.Sprintf("Failed to update cronhpa status: %v", err))
 	} else {
 		cm.eventRecorder.Event(instance, eventType, string(state), message)
 	}
 }
 
-func (cm *CronManager) updateCronHPAStatusWithRetry(instance *autoscalingv1beta1.CronHorizontalPodAutoscaler, deepCopy *autoscalingv1beta1.CronHorizontalPodAutoscaler, jobName string) error {
+func (cm *CronManager) updateCronHPAStatusWithRetry(instance cronHPAObject, deepCopy cronHPAObject, jobName string) error {
 	var err error
 	if instance == nil {
 		log.Warning("Failed to patch cronHPA, because instance is deleted")
@@ -178,7 +410,7 @@ func (cm *CronManager) updateCronHPAStatusWithRetry(instance *autoscalingv1beta1
 		break
 	}
 	if err != nil {
-		log.Errorf("Failed to update cronHPA job %s of cronHPA %s in %s after %d times, because of %v", jobName, instance.Name, instance.Namespace, MaxRetryTimes, err)
+		log.Errorf("Failed to update cronHPA job %s of cronHPA %s in %s after %d times, because of %v", jobName, instance.GetName(), instance.GetNamespace(), MaxRetryTimes, err)
 	}
 	return err
 }
@@ -186,6 +418,8 @@ func (cm *CronManager) updateCronHPAStatusWithRetry(instance *autoscalingv1beta1
 func (cm *CronManager) Run(stopChan chan struct{}) {
 	cm.cronExecutor.Run()
 	cm.gcLoop()
+	cm.replayLoop()
+	cm.prewarmLoop()
 	<-stopChan
 	cm.cronExecutor.Stop()
 }
@@ -204,6 +438,36 @@ func (cm *CronManager) gcLoop() {
 	}()
 }
 
+// replayLoop runs the jobs missed during the freezes which have ended.
+func (cm *CronManager) replayLoop() {
+	ticker := time.NewTicker(freezeReplayInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				cm.replayMissedJobs()
+			}
+		}
+	}()
+}
+
+func (cm *CronManager) replayMissedJobs() {
+	for _, job := range cm.freezes.takeMissed() {
+		cm.Lock()
+		current, ok := cm.jobQueue[job.ID()]
+		cm.Unlock()
+		// the job is removed since it's missed
+		if !ok {
+			continue
+		}
+		job = current
+		hpa := job.CronHPAMeta()
+		log.Infof("Replay job %s of cronHPA %s in %s missed during freeze", job.Name(), hpa.GetName(), hpa.GetNamespace())
+		msg, err := job.Run()
+		cm.JobResultHandler(&cron.JobResult{JobId: job.ID(), Ref: job, Msg: "replayed after freeze. " + msg, Error: err})
+	}
+}
+
 // GC will collect all jobs which ref is not exists and recycle.
 func (cm *CronManager) GC() {
 	log.Infof("Start GC")
@@ -223,16 +487,13 @@ func (cm *CronManager) GC() {
 	KubeExpiredJobsInCronEngineTotal.Set(0)
 
 	for _, job := range m {
-		hpa := job.(*CronJobHPA).HPARef
+		hpa := job.CronHPAMeta()
 		found, reason := cm.cronExecutor.FindJob(job)
 		if !found {
 			if reason == JobTimeOut {
-				instance := &autoscalingv1beta1.CronHorizontalPodAutoscaler{}
-				if err := cm.client.Get(context.Background(), types.NamespacedName{
-					Namespace: hpa.Namespace,
-					Name:      hpa.Name,
-				}, instance); err != nil {
-					log.Errorf("Failed to run time out job %s  due to failed to get cronHPA %s in %s namespace,err: %v", job.Name(), hpa.Name, hpa.Namespace, err)
+				instance, _, err := cm.fetchCronHPA(job)
+				if err != nil {
+					log.Errorf("Failed to run time out job %s  due to failed to get cronHPA %s in %s namespace,err: %v", job.Name(), hpa.GetName(), hpa.GetNamespace(), err)
 					continue
 				}
 				cm.eventRecorder.Event(instance, v1.EventTypeWarning, "OutOfDate", fmt.Sprintf("rerun out of date job: %s", job.Name()))
@@ -241,7 +502,7 @@ func (cm *CronManager) GC() {
 				}
 			}
 
-			log.Warningf("Failed to find job %s of cronHPA %s in %s in cron engine and resubmit the job.", job.Name(), hpa.Name, hpa.Namespace)
+			log.Warningf("Failed to find job %s of cronHPA %s in %s in cron engine and resubmit the job.", job.Name(), hpa.GetName(), hpa.GetNamespace())
 			cm.cronExecutor.AddJob(job)
 
 			// metrics update
@@ -251,16 +512,13 @@ func (cm *CronManager) GC() {
 			KubeSubmittedJobsInCronEngineTotal.Add(1)
 			continue
 		} else {
-			instance := &autoscalingv1beta1.CronHorizontalPodAutoscaler{}
-			if err := cm.client.Get(context.Background(), types.NamespacedName{
-				Namespace: hpa.Namespace,
-				Name:      hpa.Name,
-			}, instance); err != nil {
+			_, conditions, err := cm.fetchCronHPA(job)
+			if err != nil {
 				if errors.IsNotFound(err) {
-					log.Infof("remove job %s of cronHPA %s in %s namespace", job.Name(), hpa.Name, hpa.Namespace)
+					log.Infof("remove job %s of cronHPA %s in %s namespace", job.Name(), hpa.GetName(), hpa.GetNamespace())
 					err := cm.cronExecutor.RemoveJob(job)
 					if err != nil {
-						log.Errorf("Failed to gc job %s of cronHPA %s in %s namespace", job.Name(), hpa.Name, hpa.Namespace)
+						log.Errorf("Failed to gc job %s of cronHPA %s in %s namespace", job.Name(), hpa.GetName(), hpa.GetNamespace())
 						continue
 					}
 					cm.delete(job.ID())
@@ -273,7 +531,6 @@ func (cm *CronManager) GC() {
 				// metrics update
 				// ignore other errors
 			}
-			conditions := instance.Status.Conditions
 			for _, c := range conditions {
 				if c.JobId != job.ID() {
 					continue
@@ -301,6 +558,28 @@ func (cm *CronManager) GC() {
 	log.V(2).Infof("Current active jobs: %d, clean up %d jobs.", left, current-left)
 }
 
+// fetchCronHPA gets the latest cronHPA or clusterCronHPA which the job belongs to.
+func (cm *CronManager) fetchCronHPA(job CronJob) (cronHPAObject, []autoscalingv1beta1.Condition, error) {
+	meta := job.CronHPAMeta()
+	key := types.NamespacedName{Namespace: meta.GetNamespace(), Name: meta.GetName()}
+	if _, ok := job.(*ClusterCronJobHPA); ok {
+		instance := &autoscalingv1beta1.ClusterCronHorizontalPodAutoscaler{}
+		if err := cm.client.Get(context.Background(), key, instance); err != nil {
+			return nil, nil, err
+		}
+		conditions := make([]autoscalingv1beta1.Condition, 0, len(instance.Status.Conditions))
+		for _, c := range instance.Status.Conditions {
+			conditions = append(conditions, c.Condition)
+		}
+		return instance, conditions, nil
+	}
+	instance := &autoscalingv1beta1.CronHorizontalPodAutoscaler{}
+	if err := cm.client.Get(context.Background(), key, instance); err != nil {
+		return nil, nil, err
+	}
+	return instance, instance.Status.Conditions, nil
+}
+
 func NewCronManager(cfg *rest.Config, client client.Client, recorder record.EventRecorder) *CronManager {
 	cm := &CronManager{
 		cfg:           cfg,
@@ -309,6 +588,9 @@ func NewCronManager(cfg *rest.Config, client client.Client, recorder record.Even
 		eventRecorder: recorder,
 	}
 
+	// build dynamic client before the scale client which overrides the GroupVersion of config
+	cm.dynamicClient = dynamic.NewForConfigOrDie(cm.cfg)
+	cm.clusters = NewClusterCache()
 	hpaClient := clientset.NewForConfigOrDie(cm.cfg)
 	discoveryClient := clientset.NewForConfigOrDie(cm.cfg)
 	resources, err := restmapper.GetAPIGroupResources(discoveryClient)
@@ -326,6 +608,18 @@ func NewCronManager(cfg *rest.Config, client client.Client, recorder record.Even
 
 	cm.mapper = restMapper
 	cm.scaler = scaleClient
+	cm.discovery = hpaClient.Discovery()
+	cm.identities = NewIdentityCache(cm.cfg, restMapper, cm.discovery)
+	cm.freezes = NewFreezeGate(client, cm.dynamicClient)
+	cm.approvals = NewApprovalQueue(cm.JobResultHandler)
+	cm.readiness = NewReadinessHistory(cm.recordReadyDurations)
+	cm.steps = NewScaleDownStepper(cm.JobResultHandler)
+	cm.rollouts = NewRolloutWaiter(cm.JobResultHandler)
+	cm.inverses = NewInverseStore(cm.dynamicClient)
+	cm.capacity = NewCapacityCache()
+	cm.sizeSourceHosts = NewAllowedHosts()
+	cm.notifyHosts = NewAllowedHosts()
+	cm.externalHosts = NewAllowedHosts()
 
 	cm.cronExecutor = NewCronHPAExecutor(nil, cm.JobResultHandler)
 	return cm
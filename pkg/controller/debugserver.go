@@ -60,8 +60,8 @@ func (ws *WebServer) handleIndexController(w http.ResponseWriter, r *http.Reques
 		d.Items = append(d.Items, Item{
 			Id:        job.ID(),
 			Name:      job.Name(),
-			CronHPA:   job.CronHPAMeta().Name,
-			Namespace: job.CronHPAMeta().Namespace,
+			CronHPA:   job.CronHPAMeta().GetName(),
+			Namespace: job.CronHPAMeta().GetNamespace(),
 			Pre:       e.Prev.String(),
 			Next:      e.Next.String(),
 		})
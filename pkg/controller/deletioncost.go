@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// pods with the lower cost are removed first by the ReplicaSet controller.
+	PodDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+	// id of the job which set the pod-deletion-cost of the pod, the costs without it are set by others and kept.
+	DeletionCostByAnnotation = "cronhpa.alibabacloud.com/pod-deletion-cost-by"
+
+	zoneLabel       = "topology.kubernetes.io/zone"
+	legacyZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+	// the annotations are removed after the removed pods terminate, or after the timeout.
+	deletionCostCleanupTimeout = 5 * time.Minute
+	deletionCostRemoveFirst    = -100
+	deletionCostKeep           = 100
+)
+
+func checkScaleDownPreference(preference *v1beta1.ScaleDownPreference) error {
+	if preference == nil {
+		return nil
+	}
+	switch preference.Strategy {
+	case v1beta1.ScaleDownNewest, v1beta1.ScaleDownZoneBalance:
+		return nil
+	case v1beta1.ScaleDownNodeLabel:
+		if preference.NodeLabel == "" || len(preference.Values) == 0 {
+			return fmt.Errorf("nodeLabel and values of scaleDownPreference should be set for NodeLabel strategy")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown strategy %s of scaleDownPreference", preference.Strategy)
+}
+
+// preferScaleDown annotates the pods of the target with pod-deletion-cost before a scale-down, so the ReplicaSet removes
+// them in the order of the preference. The pods whose cost is set by users or other controllers are skipped. It
+// returns the function removing the annotations, nil if no pod is annotated. The preference doesn't stop the
+// scale-down if the pods could not be annotated.
+func (ch *CronJobHPA) preferScaleDown(ref *TargetRef, size int32) func() {
+	if ch.scaleDownPreference == nil || ref.ReplicasPath != "" || ref.RefGroup != "apps" ||
+		(ref.RefKind != "Deployment" && ref.RefKind != "ReplicaSet") {
+		return nil
+	}
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	current, err := env.currentReplicas()
+	if err != nil || size >= current {
+		return nil
+	}
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		log.Warningf("Skip scaleDownPreference of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return nil
+	}
+	pods, err := ch.podsOf(clients.dynamicClient, ref)
+	if err != nil {
+		log.Warningf("Skip scaleDownPreference of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return nil
+	}
+	nodes := make(map[string]map[string]string)
+	if ch.scaleDownPreference.Strategy != v1beta1.ScaleDownNewest {
+		list, err := clients.dynamicClient.Resource(nodeResource).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			log.Warningf("Skip scaleDownPreference of %s %s in %s namespace,because of failed to list nodes %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+			return nil
+		}
+		for _, node := range list.Items {
+			nodes[node.GetName()] = node.GetLabels()
+		}
+	}
+
+	costs := deletionCosts(ch.scaleDownPreference, pods, nodes)
+	resource := clients.dynamicClient.Resource(podResource).Namespace(ref.RefNamespace)
+	// the costs set by this job by pod name
+	annotated := make(map[string]string)
+	for _, pod := range pods {
+		if !deletionCostOwned(pod.Annotations) {
+			continue
+		}
+		cost := strconv.Itoa(costs[pod.Name])
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q,%q:%q}}}`, PodDeletionCostAnnotation, cost, DeletionCostByAnnotation, ch.ID())
+		if _, err := resource.Patch(context.Background(), pod.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			log.Warningf("Failed to annotate pod %s in %s namespace with pod-deletion-cost,because of %v", pod.Name, ref.RefNamespace, err)
+			continue
+		}
+		annotated[pod.Name] = cost
+	}
+	log.Infof("Annotated %d pods of %s %s in %s namespace with pod-deletion-cost by %s strategy", len(annotated), ref.RefKind, ref.RefName, ref.RefNamespace, ch.scaleDownPreference.Strategy)
+	if len(annotated) == 0 {
+		return nil
+	}
+	return func() {
+		deadline := time.Now().Add(deletionCostCleanupTimeout)
+		for time.Now().Before(deadline) {
+			if terminated, err := ch.podsTerminated(env, size); err == nil && terminated {
+				break
+			}
+			time.Sleep(stepInterval)
+		}
+		for name, cost := range annotated {
+			pod, err := resource.Get(context.Background(), name, metav1.GetOptions{})
+			if err != nil {
+				if !errors.IsNotFound(err) {
+					log.Warningf("Failed to remove pod-deletion-cost of pod %s in %s namespace,because of %v", name, ref.RefNamespace, err)
+				}
+				continue
+			}
+			patch := deletionCostCleanup(pod, cost, ch.ID())
+			if patch == nil {
+				continue
+			}
+			if _, err := resource.Patch(context.Background(), name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !errors.IsNotFound(err) {
+				log.Warningf("Failed to remove pod-deletion-cost of pod %s in %s namespace,because of %v", name, ref.RefNamespace, err)
+			}
+		}
+	}
+}
+
+// deletionCostOwned returns whether the pod-deletion-cost of the pod could be set by the controller, which is true if
+// the pod has no cost or the cost is set by a job of the controller.
+func deletionCostOwned(annotations map[string]string) bool {
+	_, found := annotations[PodDeletionCostAnnotation]
+	return !found || annotations[DeletionCostByAnnotation] != ""
+}
+
+// deletionCostCleanup returns the patch restoring the pod annotated by the job with the cost, nil if nothing is left
+// to restore. The pods had no cost of others before, so the annotations are removed, but a cost changed since then
+// is kept. The patch fails on a conflict if the pod changes after it's read.
+func deletionCostCleanup(pod *unstructured.Unstructured, cost, id string) []byte {
+	annotations := pod.GetAnnotations()
+	if annotations[DeletionCostByAnnotation] != id {
+		return nil
+	}
+	removed := map[string]interface{}{DeletionCostByAnnotation: nil}
+	if annotations[PodDeletionCostAnnotation] == cost {
+		removed[PodDeletionCostAnnotation] = nil
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": pod.GetResourceVersion(),
+			"annotations":     removed,
+		},
+	})
+	return patch
+}
+
+// podsOf returns the pods selected by the target which are not terminating.
+func (ch *CronJobHPA) podsOf(dynamicClient dynamic.Interface, ref *TargetRef) ([]*v1.Pod, error) {
+	resource, err := ch.resourceOf(ref)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s,because of %v", ref.RefKind, ref.RefName, err)
+	}
+	data, found, _ := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if !found {
+		return nil, fmt.Errorf("selector of %s %s is not found", ref.RefKind, ref.RefName)
+	}
+	selector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(data, selector); err != nil {
+		return nil, err
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := dynamicClient.Resource(podResource).Namespace(ref.RefNamespace).List(context.Background(), metav1.ListOptions{LabelSelector: s.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods,because of %v", err)
+	}
+	pods := make([]*v1.Pod, 0)
+	for _, item := range list.Items {
+		if item.GetDeletionTimestamp() != nil {
+			continue
+		}
+		pod := &v1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, pod); err != nil {
+			return nil, err
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// deletionCosts returns the pod-deletion-cost of every pod, nodes are the labels of the nodes by name.
+func deletionCosts(preference *v1beta1.ScaleDownPreference, pods []*v1.Pod, nodes map[string]map[string]string) map[string]int {
+	costs := make(map[string]int, len(pods))
+	// newest first
+	sorted := append([]*v1.Pod{}, pods...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CreationTimestamp.Equal(&sorted[j].CreationTimestamp) {
+			return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	switch preference.Strategy {
+	case v1beta1.ScaleDownNewest:
+		for i, pod := range sorted {
+			costs[pod.Name] = i
+		}
+	case v1beta1.ScaleDownNodeLabel:
+		removeFirst := make(map[string]bool)
+		for _, v := range preference.Values {
+			removeFirst[v] = true
+		}
+		for _, pod := range sorted {
+			value, ok := nodes[pod.Spec.NodeName][preference.NodeLabel]
+			if ok && removeFirst[value] {
+				costs[pod.Name] = deletionCostRemoveFirst
+			} else {
+				costs[pod.Name] = deletionCostKeep
+			}
+		}
+	case v1beta1.ScaleDownZoneBalance:
+		// remove the newest pod of the zone having the most pods one by one
+		zones := make(map[string][]*v1.Pod)
+		for _, pod := range sorted {
+			labels := nodes[pod.Spec.NodeName]
+			zone, ok := labels[zoneLabel]
+			if !ok {
+				zone = labels[legacyZoneLabel]
+			}
+			zones[zone] = append(zones[zone], pod)
+		}
+		for i := 0; i < len(sorted); i++ {
+			largest, found := "", false
+			for zone, zonePods := range zones {
+				if !found || len(zonePods) > len(zones[largest]) || (len(zonePods) == len(zones[largest]) && zone < largest) {
+					largest, found = zone, true
+				}
+			}
+			costs[zones[largest][0].Name] = i
+			if zones[largest] = zones[largest][1:]; len(zones[largest]) == 0 {
+				delete(zones, largest)
+			}
+		}
+	}
+	return costs
+}
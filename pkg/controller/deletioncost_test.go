@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeletionCosts(t *testing.T) {
+	nodes := map[string]map[string]string{
+		"n1": {zoneLabel: "a", "pool": "spot"},
+		"n2": {zoneLabel: "a", "pool": "on-demand"},
+		"n3": {zoneLabel: "b"},
+		"n4": {legacyZoneLabel: "b"},
+	}
+	created := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	pods := make([]*v1.Pod, 0)
+	// listed in creation order, n5 has no labels
+	for i, p := range [][2]string{{"a1", "n1"}, {"a2", "n2"}, {"a3", "n1"}, {"b1", "n3"}, {"b2", "n4"}, {"x1", "n5"}} {
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: p[0], CreationTimestamp: metav1.NewTime(created.Add(time.Duration(i) * time.Minute))},
+			Spec:       v1.PodSpec{NodeName: p[1]},
+		})
+	}
+
+	cases := []struct {
+		name       string
+		preference v1beta1.ScaleDownPreference
+		costs      map[string]int
+	}{
+		{
+			name:       "newest",
+			preference: v1beta1.ScaleDownPreference{Strategy: v1beta1.ScaleDownNewest},
+			costs:      map[string]int{"x1": 0, "b2": 1, "b1": 2, "a3": 3, "a2": 4, "a1": 5},
+		},
+		{
+			name:       "node label",
+			preference: v1beta1.ScaleDownPreference{Strategy: v1beta1.ScaleDownNodeLabel, NodeLabel: "pool", Values: []string{"spot"}},
+			costs: map[string]int{"a1": deletionCostRemoveFirst, "a3": deletionCostRemoveFirst, "a2": deletionCostKeep,
+				"b1": deletionCostKeep, "b2": deletionCostKeep, "x1": deletionCostKeep},
+		},
+		{
+			// the ties of the zone sizes go to the smaller zone name, the pods without zone are in the "" zone
+			name:       "zone balance",
+			preference: v1beta1.ScaleDownPreference{Strategy: v1beta1.ScaleDownZoneBalance},
+			costs:      map[string]int{"a3": 0, "a2": 1, "b2": 2, "x1": 3, "a1": 4, "b1": 5},
+		},
+	}
+	for _, c := range cases {
+		costs := deletionCosts(&c.preference, pods, nodes)
+		if !reflect.DeepEqual(costs, c.costs) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.costs, costs)
+		}
+	}
+}
+
+func TestDeletionCostOwned(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		owned       bool
+	}{
+		{name: "no cost", annotations: map[string]string{"team": "web"}, owned: true},
+		{name: "cost of the controller", annotations: map[string]string{PodDeletionCostAnnotation: "3", DeletionCostByAnnotation: "job-1"}, owned: true},
+		{name: "cost of others", annotations: map[string]string{PodDeletionCostAnnotation: "-1000"}},
+	}
+	for _, c := range cases {
+		if owned := deletionCostOwned(c.annotations); owned != c.owned {
+			t.Errorf("%s: expected %v, got %v", c.name, c.owned, owned)
+		}
+	}
+}
+
+func TestDeletionCostCleanup(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations string
+		patch       string
+	}{
+		{
+			name:        "cost of the job",
+			annotations: `{"controller.kubernetes.io/pod-deletion-cost":"3","cronhpa.alibabacloud.com/pod-deletion-cost-by":"job-1"}`,
+			patch:       `{"metadata":{"resourceVersion":"42","annotations":{"controller.kubernetes.io/pod-deletion-cost":null,"cronhpa.alibabacloud.com/pod-deletion-cost-by":null}}}`,
+		},
+		{
+			name:        "cost changed since",
+			annotations: `{"controller.kubernetes.io/pod-deletion-cost":"-1000","cronhpa.alibabacloud.com/pod-deletion-cost-by":"job-1"}`,
+			patch:       `{"metadata":{"resourceVersion":"42","annotations":{"cronhpa.alibabacloud.com/pod-deletion-cost-by":null}}}`,
+		},
+		{
+			name:        "cost of another job",
+			annotations: `{"controller.kubernetes.io/pod-deletion-cost":"3","cronhpa.alibabacloud.com/pod-deletion-cost-by":"job-2"}`,
+		},
+		{
+			name:        "cost removed since",
+			annotations: `{}`,
+		},
+	}
+	for _, c := range cases {
+		pod := unstructuredOf(t, `{"metadata":{"name":"web-1","resourceVersion":"42","annotations":`+c.annotations+`}}`)
+		patch := deletionCostCleanup(pod, "3", "job-1")
+		if c.patch == "" {
+			if patch != nil {
+				t.Errorf("%s: expected no patch, got %s", c.name, patch)
+			}
+			continue
+		}
+		if !jsonEqual(t, string(patch), c.patch) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.patch, patch)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"sort"
+	"strings"
+)
+
+// WeightedTargetRef is one target of a distributed job.
+type WeightedTargetRef struct {
+	*TargetRef
+	Weight int32
+}
+
+func newDistribution(distribution *v1beta1.Distribution, namespace string) ([]*WeightedTargetRef, error) {
+	if len(distribution.Targets) == 0 {
+		return nil, errors.New("distribution should contain at least one target")
+	}
+
+	refs := make([]*WeightedTargetRef, 0, len(distribution.Targets))
+	usePercentage := distribution.Targets[0].Percentage != 0
+	var percentages int32
+	for _, target := range distribution.Targets {
+		ref, err := newTargetRef(target.ScaleTargetRef, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid distribution target %s %s,because of %v", target.Kind, target.Name, err)
+		}
+		if target.Weight < 0 || target.Percentage < 0 {
+			return nil, fmt.Errorf("weight and percentage of distribution target %s %s could not be negative", target.Kind, target.Name)
+		}
+		if target.Weight != 0 && target.Percentage != 0 {
+			return nil, fmt.Errorf("distribution target %s %s could not specify both weight and percentage", target.Kind, target.Name)
+		}
+		if usePercentage != (target.Percentage != 0) {
+			return nil, errors.New("all targets of a distribution should use either weight or percentage")
+		}
+		weight := target.Weight
+		if usePercentage {
+			weight = target.Percentage
+			percentages += target.Percentage
+		}
+		refs = append(refs, &WeightedTargetRef{TargetRef: ref, Weight: weight})
+	}
+
+	if usePercentage && percentages != 100 {
+		return nil, fmt.Errorf("percentages of distribution targets should sum up to 100 but got %d", percentages)
+	}
+	var weights int32
+	for _, ref := range refs {
+		weights += ref.Weight
+	}
+	if weights == 0 {
+		return nil, errors.New("weights of distribution targets could not be all zero")
+	}
+	return refs, nil
+}
+
+// splitTargetSize splits total across weights by the largest remainder method.
+// Remainders are handed out by descending fraction and then by the order of the targets,
+// so the same input always gets the same result.
+func splitTargetSize(total int32, weights []int32) []int32 {
+	sizes := make([]int32, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += int64(w)
+	}
+	if sum == 0 {
+		return sizes
+	}
+
+	remainders := make([]int64, len(weights))
+	var assigned int32
+	for i, w := range weights {
+		share := int64(total) * int64(w)
+		sizes[i] = int32(share / sum)
+		remainders[i] = share % sum
+		assigned += sizes[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; assigned < total; i++ {
+		sizes[order[i%len(order)]]++
+		assigned++
+	}
+	return sizes
+}
+
+func distributionToString(refs []*WeightedTargetRef) string {
+	arr := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		arr = append(arr, fmt.Sprintf("%s=%d", ref.toString(), ref.Weight))
+	}
+	return strings.Join(arr, ",")
+}
+
+func (ch *CronJobHPA) targetSizes() []int32 {
+	weights := make([]int32, 0, len(ch.Distribution))
+	for _, ref := range ch.Distribution {
+		weights = append(weights, ref.Weight)
+	}
+	return splitTargetSize(ch.DesiredSize, weights)
+}
+
+// DistributionStatus returns the computed size of every target of the job.
+func (ch *CronJobHPA) DistributionStatus() []v1beta1.TargetSizeStatus {
+	if len(ch.Distribution) == 0 {
+		return nil
+	}
+	sizes := ch.targetSizes()
+	status := make([]v1beta1.TargetSizeStatus, 0, len(sizes))
+	for i, ref := range ch.Distribution {
+		status = append(status, v1beta1.TargetSizeStatus{
+			ScaleTargetRef: v1beta1.ScaleTargetRef{
+				ApiVersion: fmt.Sprintf("%s/%s", ref.RefGroup, ref.RefVersion),
+				Kind:       ref.RefKind,
+				Name:       ref.RefName,
+			},
+			TargetSize: sizes[i],
+		})
+	}
+	return status
+}
+
+// runDistribution scales every target to its share. A failed target doesn't stop the others.
+func (ch *CronJobHPA) runDistribution() (msg string, err error) {
+	sizes := ch.targetSizes()
+	refs := make([]*TargetRef, 0, len(ch.Distribution))
+	for _, ref := range ch.Distribution {
+		refs = append(refs, ref.TargetRef)
+	}
+	if err := ch.requireApproval(refs, sizes); err != nil {
+		return "", err
+	}
+	msgs := make([]string, 0, len(sizes))
+	errs := make([]string, 0)
+	for i, ref := range ch.Distribution {
+		m, e := ch.scaleWithRetry(ref.TargetRef, sizes[i])
+		if e != nil {
+			errs = append(errs, e.Error())
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("%s %s: %s", ref.RefKind, ref.RefName, m))
+	}
+	if len(errs) != 0 {
+		return strings.Join(msgs, " "), fmt.Errorf("failed to scale %d of %d distribution targets: %s", len(errs), len(sizes), strings.Join(errs, "; "))
+	}
+	return strings.Join(msgs, " "), nil
+}
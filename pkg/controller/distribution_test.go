@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitTargetSize(t *testing.T) {
+	cases := []struct {
+		name    string
+		total   int32
+		weights []int32
+		sizes   []int32
+	}{
+		{name: "even", total: 10, weights: []int32{1, 1}, sizes: []int32{5, 5}},
+		{name: "weighted", total: 10, weights: []int32{3, 1}, sizes: []int32{8, 2}},
+		{name: "largest remainder first", total: 10, weights: []int32{1, 2}, sizes: []int32{3, 7}},
+		{name: "ties by order", total: 10, weights: []int32{1, 1, 1}, sizes: []int32{4, 3, 3}},
+		{name: "zero weight", total: 7, weights: []int32{0, 1}, sizes: []int32{0, 7}},
+		{name: "all zero weights", total: 7, weights: []int32{0, 0}, sizes: []int32{0, 0}},
+		{name: "zero total", total: 0, weights: []int32{2, 3}, sizes: []int32{0, 0}},
+		{name: "single target", total: 9, weights: []int32{5}, sizes: []int32{9}},
+	}
+	for _, c := range cases {
+		sizes := splitTargetSize(c.total, c.weights)
+		if !reflect.DeepEqual(sizes, c.sizes) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.sizes, sizes)
+		}
+	}
+}
+
+func TestSplitTargetSizeSum(t *testing.T) {
+	weights := []int32{7, 3, 11, 5}
+	for total := int32(0); total < 100; total++ {
+		var sum int32
+		for _, size := range splitTargetSize(total, weights) {
+			sum += size
+		}
+		if sum != total {
+			t.Errorf("sizes of %d sum up to %d", total, sum)
+		}
+	}
+}
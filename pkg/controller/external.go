@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/externalscaler"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	log "k8s.io/klog/v2"
+	"net"
+	"time"
+)
+
+const (
+	externalKind           = "External"
+	defaultExternalTimeout = 10 * time.Second
+)
+
+var secretResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// newExternalTarget keeps the address of the scaler in RefGroup so that a new address recreates the job.
+func newExternalTarget(external *v1beta1.ExternalTarget, namespace string) (*TargetRef, error) {
+	if external.Name == "" {
+		return nil, errors.New("name of external could not be empty")
+	}
+	if _, _, err := net.SplitHostPort(external.Address); err != nil {
+		return nil, fmt.Errorf("invalid address %q of external,because of %v", external.Address, err)
+	}
+	if external.TimeoutSeconds < 0 {
+		return nil, errors.New("timeoutSeconds of external could not be negative")
+	}
+	return &TargetRef{
+		RefName:      external.Name,
+		RefNamespace: namespace,
+		RefKind:      externalKind,
+		RefGroup:     external.Address,
+	}, nil
+}
+
+func (ch *CronJobHPA) dialExternal() (*externalscaler.Client, error) {
+	if !ch.externalHosts.allowedAddress(ch.external.Address) {
+		return nil, fmt.Errorf("address %s is not allowed by --externalScalerHosts", ch.external.Address)
+	}
+	timeout := defaultExternalTimeout
+	if ch.external.TimeoutSeconds > 0 {
+		timeout = time.Duration(ch.external.TimeoutSeconds) * time.Second
+	}
+	var tlsConfig *tls.Config
+	if ch.external.TLS != nil {
+		var err error
+		tlsConfig, err = ch.externalTLSConfig(ch.external.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return externalscaler.Dial(ch.external.Address, tlsConfig, timeout)
+}
+
+// externalTLSConfig reads ca.crt, tls.crt and tls.key from the Secret in the namespace of the cronHPA.
+func (ch *CronJobHPA) externalTLSConfig(spec *v1beta1.ExternalTLS) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+	if spec.SecretName == "" {
+		return config, nil
+	}
+	reader, err := ch.namespaceClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := reader.Resource(secretResource).Namespace(ch.HPARef.Namespace).Get(context.Background(), spec.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tls secret %s,because of %v", spec.SecretName, err)
+	}
+	data, _, err := unstructured.NestedStringMap(secret.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	decoded := make(map[string][]byte)
+	for k, v := range data {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in tls secret %s,because of %v", k, spec.SecretName, err)
+		}
+		decoded[k] = b
+	}
+	if ca, ok := decoded["ca.crt"]; ok {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificate found in ca.crt of tls secret %s", spec.SecretName)
+		}
+		config.RootCAs = pool
+	}
+	if crt, ok := decoded["tls.crt"]; ok {
+		cert, err := tls.X509KeyPair(crt, decoded["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in tls secret %s,because of %v", spec.SecretName, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (ch *CronJobHPA) externalRequest(ref *TargetRef) *externalscaler.TargetRequest {
+	return &externalscaler.TargetRequest{
+		Name:      ref.RefName,
+		Namespace: ref.RefNamespace,
+		Metadata:  ch.external.Metadata,
+	}
+}
+
+// ScaleExternal bounds the desired replicas to the ones described by the scaler and sets them.
+func (ch *CronJobHPA) ScaleExternal(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	c, err := ch.dialExternal()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect external scaler %s,because of %v", ch.external.Address, err)
+	}
+	defer c.Close()
+
+	desc, err := c.Describe(ch.externalRequest(ref))
+	if err != nil {
+		return "", fmt.Errorf("failed to describe external target %s,because of %v", ref.RefName, err)
+	}
+	current, err := c.GetCurrent(ch.externalRequest(ref))
+	if err != nil {
+		return "", fmt.Errorf("failed to get replicas of external target %s,because of %v", ref.RefName, err)
+	}
+
+	size := desiredSize
+	if size < desc.MinReplicas {
+		size = desc.MinReplicas
+	}
+	if desc.MaxReplicas > 0 && size > desc.MaxReplicas {
+		size = desc.MaxReplicas
+	}
+	resp, err := c.SetDesired(&externalscaler.SetDesiredRequest{
+		Name:      ref.RefName,
+		Namespace: ref.RefNamespace,
+		Metadata:  ch.external.Metadata,
+		Replicas:  size,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to scale external target %s to %d,because of %v", ref.RefName, size, err)
+	}
+	log.Infof("External target %s of %s in namespace %s has been scaled successfully. job: %s replicas: %d", ref.RefName, ch.external.Address, ref.RefNamespace, ch.Name(), resp.Replicas)
+
+	msg = fmt.Sprintf("current replicas:%d, desired replicas:%d.", current.Replicas, desiredSize)
+	if size != desiredSize {
+		msg += fmt.Sprintf(" desired replicas is bounded to %d by %s [%d, %d].", size, describeKind(desc), desc.MinReplicas, desc.MaxReplicas)
+	}
+	if resp.Replicas != size {
+		msg += fmt.Sprintf(" external scaler accepted %d replicas.", resp.Replicas)
+	}
+	if resp.Message != "" {
+		msg += " " + resp.Message
+	}
+	return msg, nil
+}
+
+func (ch *CronJobHPA) externalReplicas(ref *TargetRef) (int32, error) {
+	c, err := ch.dialExternal()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect external scaler %s,because of %v", ch.external.Address, err)
+	}
+	defer c.Close()
+	current, err := c.GetCurrent(ch.externalRequest(ref))
+	if err != nil {
+		return 0, err
+	}
+	return current.Replicas, nil
+}
+
+func describeKind(desc *externalscaler.DescribeResponse) string {
+	if desc.Kind == "" {
+		return "external target"
+	}
+	return desc.Kind
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/externalscaler"
+	"strings"
+	"testing"
+)
+
+func TestScaleExternal(t *testing.T) {
+	server := externalscaler.NewFakeServer()
+	address, err := server.Start()
+	if err != nil {
+		t.Fatalf("failed to start external scaler: %v", err)
+	}
+	defer server.Stop()
+	hosts := NewAllowedHosts()
+	hosts.Set([]string{address})
+
+	cases := []struct {
+		name     string
+		target   string
+		desired  int32
+		replicas int32
+		msg      string
+		address  string
+		err      bool
+	}{
+		{name: "desired", target: "pool", desired: 5, replicas: 5, msg: "current replicas:3, desired replicas:5."},
+		{name: "bounded to max", target: "pool", desired: 20, replicas: 10, msg: "desired replicas is bounded to 10 by Fake [2, 10]."},
+		{name: "bounded to min", target: "pool", desired: 1, replicas: 2, msg: "desired replicas is bounded to 2 by Fake [2, 10]."},
+		{name: "unknown target", target: "gpu-pool", desired: 5, err: true},
+		{name: "address not allowed", target: "pool", desired: 5, address: "127.0.0.1:1", err: true},
+	}
+	for _, c := range cases {
+		server.SetTarget("default", "pool", externalscaler.FakeTarget{Replicas: 3, MinReplicas: 2, MaxReplicas: 10})
+		external := &v1beta1.ExternalTarget{Address: address, Name: c.target}
+		if c.address != "" {
+			external.Address = c.address
+		}
+		ref, err := newExternalTarget(external, "default")
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		ch := &CronJobHPA{name: "scale-up", external: external, externalHosts: hosts}
+		msg, err := ch.ScaleExternal(ref, c.desired)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !strings.Contains(msg, c.msg) {
+			t.Errorf("%s: expected message containing %q, got %q", c.name, c.msg, msg)
+		}
+		if replicas, err := ch.externalReplicas(ref); err != nil || replicas != c.replicas {
+			t.Errorf("%s: expected %d replicas, got %d %v", c.name, c.replicas, replicas, err)
+		}
+	}
+}
+
+func TestNewExternalTarget(t *testing.T) {
+	cases := []struct {
+		name     string
+		external v1beta1.ExternalTarget
+		address  string
+		err      bool
+	}{
+		{name: "valid", external: v1beta1.ExternalTarget{Address: "scaler.kube-system.svc:9090", Name: "pool"}},
+		{name: "no name", external: v1beta1.ExternalTarget{Address: "scaler.kube-system.svc:9090"}, err: true},
+		{name: "no port", external: v1beta1.ExternalTarget{Address: "scaler.kube-system.svc", Name: "pool"}, err: true},
+		{name: "negative timeout", external: v1beta1.ExternalTarget{Address: "scaler:9090", Name: "pool", TimeoutSeconds: -1}, err: true},
+	}
+	for _, c := range cases {
+		ref, err := newExternalTarget(&c.external, "default")
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if ref.RefKind != externalKind || ref.RefName != c.external.Name || ref.RefGroup != c.external.Address {
+			t.Errorf("%s: unexpected target %+v", c.name, ref)
+		}
+	}
+}
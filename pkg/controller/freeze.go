@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// keys of the global pause ConfigMap
+	pausedKey      = "paused"
+	pauseReasonKey = "reason"
+	pauseReplayKey = "replayMissedJobs"
+	// the missed jobs are replayed within the interval after the freeze ends.
+	freezeReplayInterval = 30 * time.Second
+)
+
+// JobFrozen is the result of a job skipped by a CronHPAFreeze or the global pause.
+type JobFrozen struct {
+	// CronHPAFreeze or ConfigMap which froze the job
+	By     string
+	Reason string
+	replay bool
+}
+
+func (f *JobFrozen) Error() string {
+	if f.Reason == "" {
+		return fmt.Sprintf("frozen by %s", f.By)
+	}
+	return fmt.Sprintf("frozen by %s, %s", f.By, f.Reason)
+}
+
+// FreezeGate decides whether the jobs are frozen, and keeps the last job missed by every cronHPA
+// during a freeze which replays the missed jobs.
+type FreezeGate struct {
+	sync.Mutex
+	client        client.Client
+	dynamicClient dynamic.Interface
+	// ConfigMap of the global pause, disabled if the name is empty.
+	pauseNamespace string
+	pauseName      string
+	missed         map[string]CronJob
+}
+
+func NewFreezeGate(client client.Client, dynamicClient dynamic.Interface) *FreezeGate {
+	return &FreezeGate{
+		client:        client,
+		dynamicClient: dynamicClient,
+		missed:        make(map[string]CronJob),
+	}
+}
+
+// SetPauseConfigMap sets the ConfigMap of the global pause.
+func (g *FreezeGate) SetPauseConfigMap(namespace, name string) {
+	g.Lock()
+	defer g.Unlock()
+	g.pauseNamespace = namespace
+	g.pauseName = name
+}
+
+// paused reads the global pause. The jobs keep running if the ConfigMap could not be read.
+func (g *FreezeGate) paused() *JobFrozen {
+	g.Lock()
+	namespace, name := g.pauseNamespace, g.pauseName
+	g.Unlock()
+	if name == "" {
+		return nil
+	}
+	cm, err := g.dynamicClient.Resource(configMapResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Warningf("Failed to get pause configmap %s/%s,because of %v", namespace, name, err)
+		}
+		return nil
+	}
+	data, _, err := unstructured.NestedStringMap(cm.Object, "data")
+	if err != nil || data[pausedKey] != "true" {
+		return nil
+	}
+	return &JobFrozen{
+		By:     fmt.Sprintf("ConfigMap %s/%s", namespace, name),
+		Reason: data[pauseReasonKey],
+		replay: data[pauseReplayKey] == "true",
+	}
+}
+
+// frozen returns the global pause or the first active CronHPAFreeze matching the namespace and the labels
+// of the cronHPA, the namespace is empty for a clusterCronHPA. The CronHPAFreezes are not checked if the
+// CRD is not installed.
+func (g *FreezeGate) frozen(namespace string, set labels.Set) (*JobFrozen, error) {
+	if g == nil {
+		return nil, nil
+	}
+	if f := g.paused(); f != nil {
+		return f, nil
+	}
+	ctx := context.Background()
+	list := &v1beta1.CronHPAFreezeList{}
+	if err := g.client.List(ctx, list); err != nil {
+		if apimeta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list CronHPAFreezes,because of %v", err)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+	var nsLabels labels.Set
+	now := time.Now()
+	for _, f := range list.Items {
+		if !freezeActive(f.Spec, now) {
+			continue
+		}
+		if f.Spec.NamespaceSelector != nil {
+			// a clusterCronHPA checks them in every namespace
+			if namespace == "" {
+				continue
+			}
+			if nsLabels == nil {
+				ns := &v1.Namespace{}
+				if err := g.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+					return nil, fmt.Errorf("failed to get namespace %s,because of %v", namespace, err)
+				}
+				nsLabels = labels.Set(ns.Labels)
+			}
+			selector, err := metav1.LabelSelectorAsSelector(f.Spec.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespaceSelector of CronHPAFreeze %s,because of %v", f.Name, err)
+			}
+			if !selector.Matches(nsLabels) {
+				continue
+			}
+		}
+		selector, err := labelSelectorOrEverything(f.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of CronHPAFreeze %s,because of %v", f.Name, err)
+		}
+		if selector.Matches(set) {
+			return &JobFrozen{By: fmt.Sprintf("CronHPAFreeze %s", f.Name), Reason: f.Spec.Reason, replay: f.Spec.ReplayMissedJobs}, nil
+		}
+	}
+	return nil, nil
+}
+
+func freezeActive(spec v1beta1.CronHPAFreezeSpec, now time.Time) bool {
+	if spec.Start != nil && now.Before(spec.Start.Time) {
+		return false
+	}
+	if spec.End != nil && !now.Before(spec.End.Time) {
+		return false
+	}
+	return true
+}
+
+func cronHPAKey(job CronJob) string {
+	meta := job.CronHPAMeta()
+	return meta.GetNamespace() + "/" + meta.GetName()
+}
+
+// check returns JobFrozen if the job is frozen and keeps it for the replay. A job running unfrozen
+// drops the missed job of its cronHPA, which is older.
+func (g *FreezeGate) check(job CronJob, namespace string, set labels.Set) error {
+	if g == nil {
+		return nil
+	}
+	f, err := g.frozen(namespace, set)
+	if err != nil {
+		// a broken freeze doesn't stop the scaling
+		log.Errorf("Failed to check freezes of job %s,because of %v", job.Name(), err)
+		return nil
+	}
+	g.Lock()
+	defer g.Unlock()
+	if f == nil {
+		delete(g.missed, cronHPAKey(job))
+		return nil
+	}
+	if f.replay {
+		g.missed[cronHPAKey(job)] = job
+	}
+	return f
+}
+
+// takeMissed returns the missed jobs whose cronHPAs are not frozen any more and forgets them.
+func (g *FreezeGate) takeMissed() []CronJob {
+	g.Lock()
+	missed := make(map[string]CronJob, len(g.missed))
+	for k, j := range g.missed {
+		missed[k] = j
+	}
+	g.Unlock()
+
+	jobs := make([]CronJob, 0)
+	for key, job := range missed {
+		meta := job.CronHPAMeta()
+		f, err := g.frozen(meta.GetNamespace(), labels.Set(meta.GetLabels()))
+		if err != nil || f != nil {
+			continue
+		}
+		g.Lock()
+		// the job may be replaced or dropped by a later run
+		if g.missed[key] == job {
+			delete(g.missed, key)
+			jobs = append(jobs, job)
+		}
+		g.Unlock()
+	}
+	return jobs
+}
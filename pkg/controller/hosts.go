@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRedirects = 10
+
+// AllowedHosts is the allow-list of the hosts the controller sends requests to on behalf of the cronHPAs, such as
+// the http sources of targetSizeFrom. The requests are sent from the network of the controller, so the hosts are
+// refused unless they are allowed.
+type AllowedHosts struct {
+	sync.Mutex
+	hosts []string
+}
+
+func NewAllowedHosts() *AllowedHosts {
+	return &AllowedHosts{}
+}
+
+// Set replaces the allowed hosts, an entry is a host, a host:port or * for any host.
+func (h *AllowedHosts) Set(hosts []string) {
+	h.Lock()
+	defer h.Unlock()
+	h.hosts = hosts
+}
+
+func (h *AllowedHosts) allowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return h.allowedAddress(u.Host)
+}
+
+// allowedAddress checks a host or host:port.
+func (h *AllowedHosts) allowedAddress(address string) bool {
+	if h == nil || address == "" {
+		return false
+	}
+	hostname := address
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		hostname = host
+	}
+	h.Lock()
+	defer h.Unlock()
+	for _, host := range h.hosts {
+		if host == "*" || strings.EqualFold(host, address) || strings.EqualFold(host, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpClient returns a client following the redirects only to the allowed hosts.
+func (h *AllowedHosts) httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if !h.allowed(req.URL) {
+				return fmt.Errorf("redirect to host %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
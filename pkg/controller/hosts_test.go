@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	hosts := NewAllowedHosts()
+	hosts.Set([]string{"chatops.example.com", "metrics.monitoring.svc:8080"})
+	cases := []struct {
+		url     string
+		allowed bool
+	}{
+		{url: "https://chatops.example.com/approvals", allowed: true},
+		{url: "https://ChatOps.example.com:8443/approvals", allowed: true},
+		{url: "http://metrics.monitoring.svc:8080/size", allowed: true},
+		{url: "http://metrics.monitoring.svc:9090/size"},
+		{url: "http://metrics.monitoring.svc/size"},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "file:///etc/passwd"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.url, err)
+		}
+		if allowed := hosts.allowed(u); allowed != c.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", c.url, c.allowed, allowed)
+		}
+	}
+
+	var none *AllowedHosts
+	if u, _ := url.Parse("https://chatops.example.com"); none.allowed(u) {
+		t.Errorf("expected nothing allowed without hosts")
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"fmt"
+	scalelib "github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/lib"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/scale"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"sync"
+)
+
+const (
+	// user who changed the spec of the cronHPA the last time and its groups, recorded by the webhook.
+	AuthorAnnotation       = "cronhpa.alibabacloud.com/author"
+	AuthorGroupsAnnotation = "cronhpa.alibabacloud.com/author-groups"
+)
+
+// IdentityCache builds the clients impersonating the ServiceAccounts or the authors of the cronHPAs,
+// so the api server enforces the RBAC of the namespace on the jobs.
+type IdentityCache struct {
+	sync.Mutex
+	cfg       *rest.Config
+	mapper    apimeta.RESTMapper
+	discovery discovery.DiscoveryInterface
+	clients   map[string]*targetClients
+	// jobs without serviceAccountName are refused if required.
+	required bool
+	// jobs without serviceAccountName impersonate the author recorded by the webhook.
+	impersonateAuthors bool
+}
+
+func NewIdentityCache(cfg *rest.Config, mapper apimeta.RESTMapper, discovery discovery.DiscoveryInterface) *IdentityCache {
+	return &IdentityCache{
+		cfg:       cfg,
+		mapper:    mapper,
+		discovery: discovery,
+		clients:   make(map[string]*targetClients),
+	}
+}
+
+// checkServiceAccount validates the serviceAccountName of the cronHPA.
+func (c *IdentityCache) checkServiceAccount(name string) error {
+	if name == "" {
+		if c != nil && c.isRequired() {
+			return fmt.Errorf("serviceAccountName is required by the controller")
+		}
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return fmt.Errorf("invalid serviceAccountName %s,because of %s", name, strings.Join(errs, ","))
+	}
+	if c == nil {
+		return fmt.Errorf("serviceAccountName is not supported")
+	}
+	return nil
+}
+
+// checkClusters refuses the remote clusters if the jobs are required to impersonate, the changes in a remote cluster
+// are done with the identity of its kubeconfig.
+func (c *IdentityCache) checkClusters(clusters []string) error {
+	if len(clusters) != 0 && c != nil && c.isRequired() {
+		return fmt.Errorf("remote cluster %s could not be used, because serviceAccountName is required by the controller and it could not be impersonated in remote clusters", clusters[0])
+	}
+	return nil
+}
+
+// checkClusterCronHPA refuses the jobs of a clusterCronHPA if the jobs are required to impersonate, they change the
+// targets in all the selected namespaces with the identity of the controller.
+func (c *IdentityCache) checkClusterCronHPA() error {
+	if c != nil && c.isRequired() {
+		return fmt.Errorf("ClusterCronHorizontalPodAutoscaler could not be used, because serviceAccountName is required by the controller and the jobs of a ClusterCronHorizontalPodAutoscaler run with the identity of the controller")
+	}
+	return nil
+}
+
+func (c *IdentityCache) isRequired() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.required
+}
+
+// authorOf returns the author of the cronHPA and its groups when the jobs without serviceAccountName impersonate it.
+// The annotations are only trusted with the webhook, which overwrites them on every change.
+func (c *IdentityCache) authorOf(serviceAccount string, annotations map[string]string) (string, []string, error) {
+	if serviceAccount != "" || c == nil {
+		return "", nil, nil
+	}
+	c.Lock()
+	impersonate := c.impersonateAuthors
+	c.Unlock()
+	if !impersonate {
+		return "", nil, nil
+	}
+	author := annotations[AuthorAnnotation]
+	if author == "" {
+		return "", nil, fmt.Errorf("%s annotation is required by the controller, the cronHPA should be created or changed with the webhook", AuthorAnnotation)
+	}
+	var groups []string
+	if g := annotations[AuthorGroupsAnnotation]; g != "" {
+		groups = strings.Split(g, ",")
+	}
+	return author, groups, nil
+}
+
+// clientsOf returns the clients impersonating the ServiceAccount, or the author if serviceAccount is empty. It
+// returns nil if both are empty, the controller clients are used then.
+func (c *IdentityCache) clientsOf(namespace, serviceAccount, author string, groups []string) (*targetClients, error) {
+	if serviceAccount != "" {
+		return c.Get(namespace, serviceAccount)
+	}
+	if author != "" {
+		return c.GetUser(author, groups)
+	}
+	return nil, nil
+}
+
+// Get returns the clients impersonating the ServiceAccount, they share the mappings of the controller.
+func (c *IdentityCache) Get(namespace, name string) (*targetClients, error) {
+	return c.get(namespace+"/"+name, rest.ImpersonationConfig{UserName: fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)})
+}
+
+// GetUser returns the clients impersonating the user with the groups.
+func (c *IdentityCache) GetUser(user string, groups []string) (*targetClients, error) {
+	return c.get("user:"+user+"@"+strings.Join(groups, ","), rest.ImpersonationConfig{UserName: user, Groups: groups})
+}
+
+func (c *IdentityCache) get(key string, impersonate rest.ImpersonationConfig) (*targetClients, error) {
+	c.Lock()
+	defer c.Unlock()
+	if clients, ok := c.clients[key]; ok {
+		return clients, nil
+	}
+
+	cfg := rest.CopyConfig(c.cfg)
+	cfg.Impersonate = impersonate
+	// build dynamic client before the scale client which overrides the GroupVersion of config
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scaler, err := scalelib.NewForConfig(rest.CopyConfig(cfg), c.mapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(c.discovery))
+	if err != nil {
+		return nil, err
+	}
+	cl, err := client.New(rest.CopyConfig(cfg), client.Options{Scheme: scheme.Scheme, Mapper: c.mapper})
+	if err != nil {
+		return nil, err
+	}
+	clients := &targetClients{
+		scaler:        scaler,
+		mapper:        c.mapper,
+		client:        cl,
+		dynamicClient: dynamicClient,
+	}
+	c.clients[key] = clients
+	return clients, nil
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestCheckClusterCronHPA(t *testing.T) {
+	cases := []struct {
+		name       string
+		identities *IdentityCache
+		refused    bool
+	}{
+		{name: "no identity cache"},
+		{name: "service account not required", identities: &IdentityCache{}},
+		{name: "service account required", identities: &IdentityCache{required: true}, refused: true},
+	}
+	for _, c := range cases {
+		err := c.identities.checkClusterCronHPA()
+		if c.refused && err == nil {
+			t.Errorf("%s: expected the clusterCronHPA refused, got no error", c.name)
+		}
+		if !c.refused && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"hash/fnv"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"strings"
+	"sync"
+)
+
+// the ConfigMap is updated again when it's changed by another job at the same time.
+const maxInverseConflicts = 5
+
+// storedInverse is the inverse patch of a job and the uid of its cronHPA, so a cronHPA recreated with the same
+// name doesn't get the inverse patches of the deleted one.
+type storedInverse struct {
+	UID     string               `json:"uid"`
+	Job     string               `json:"job"`
+	Inverse v1beta1.InversePatch `json:"inverse"`
+}
+
+// InverseStore keeps the inverse patches of the patch and vpa jobs in a ConfigMap of the controller. The revert jobs
+// apply them with the permissions of the controller, so they're not read from status, which could be written by
+// anyone who could update the cronHPA.
+type InverseStore struct {
+	sync.Mutex
+	dynamicClient dynamic.Interface
+	namespace     string
+	name          string
+}
+
+func NewInverseStore(dynamicClient dynamic.Interface) *InverseStore {
+	return &InverseStore{dynamicClient: dynamicClient}
+}
+
+// SetConfigMap sets the ConfigMap of the inverse patches.
+func (s *InverseStore) SetConfigMap(namespace, name string) {
+	s.Lock()
+	defer s.Unlock()
+	s.namespace, s.name = namespace, name
+}
+
+// inverseKey is a key of the ConfigMap, the names of the namespace and the cronHPA don't contain '_'.
+func inverseKey(namespace, name, job string) string {
+	h := fnv.New32a()
+	h.Write([]byte(job))
+	return fmt.Sprintf("%s_%s_%x", namespace, name, h.Sum32())
+}
+
+func (s *InverseStore) configMap() (dynamic.ResourceInterface, string, error) {
+	if s == nil {
+		return nil, "", fmt.Errorf("inverse patches are not supported")
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.name == "" {
+		return nil, "", fmt.Errorf("ConfigMap of the inverse patches is not set")
+	}
+	return s.dynamicClient.Resource(configMapResource).Namespace(s.namespace), s.name, nil
+}
+
+// update changes the data of the ConfigMap by fn, the ConfigMap is created if it's not found.
+func (s *InverseStore) update(fn func(data map[string]interface{}) bool) error {
+	resource, name, err := s.configMap()
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		cm, err := resource.Get(context.Background(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			data := make(map[string]interface{})
+			if !fn(data) {
+				return nil
+			}
+			cm = &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": name},
+				"data":       data,
+			}}
+			_, err = resource.Create(context.Background(), cm, metav1.CreateOptions{})
+		} else if err == nil {
+			data, _, _ := unstructured.NestedMap(cm.Object, "data")
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			if !fn(data) {
+				return nil
+			}
+			cm.Object["data"] = data
+			_, err = resource.Update(context.Background(), cm, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			return nil
+		}
+		if (!errors.IsConflict(err) && !errors.IsAlreadyExists(err)) || i >= maxInverseConflicts {
+			return fmt.Errorf("failed to update ConfigMap %s of the inverse patches,because of %v", name, err)
+		}
+	}
+}
+
+func (s *InverseStore) save(instance metav1.Object, job string, inverse *v1beta1.InversePatch) error {
+	value, err := json.Marshal(storedInverse{UID: string(instance.GetUID()), Job: job, Inverse: *inverse})
+	if err != nil {
+		return err
+	}
+	return s.update(func(data map[string]interface{}) bool {
+		data[inverseKey(instance.GetNamespace(), instance.GetName(), job)] = string(value)
+		return true
+	})
+}
+
+// load returns the inverse patch stored by the job of the cronHPA, nil if it's not stored.
+func (s *InverseStore) load(instance metav1.Object, job string) (*v1beta1.InversePatch, error) {
+	resource, name, err := s.configMap()
+	if err != nil {
+		return nil, err
+	}
+	cm, err := resource.Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s of the inverse patches,because of %v", name, err)
+	}
+	value, found, _ := unstructured.NestedString(cm.Object, "data", inverseKey(instance.GetNamespace(), instance.GetName(), job))
+	if !found {
+		return nil, nil
+	}
+	stored := storedInverse{}
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid inverse patch of job %s,because of %v", job, err)
+	}
+	if stored.UID != string(instance.GetUID()) || stored.Job != job {
+		return nil, nil
+	}
+	return &stored.Inverse, nil
+}
+
+// forget removes the inverse patches of a deleted cronHPA.
+func (s *InverseStore) forget(namespace, name string) {
+	if _, _, err := s.configMap(); err != nil {
+		return
+	}
+	prefix := namespace + "_" + name + "_"
+	err := s.update(func(data map[string]interface{}) bool {
+		changed := false
+		for key := range data {
+			if strings.HasPrefix(key, prefix) {
+				delete(data, key)
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		log.Warningf("Failed to remove the inverse patches of cronHPA %s in %s namespace,because of %v", name, namespace, err)
+	}
+}
@@ -0,0 +1,430 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+	"time"
+)
+
+// newPatchTarget converts the target of a patch, objects of the core group are allowed.
+func newPatchTarget(target v1beta1.ScaleTargetRef, namespace string) (*TargetRef, error) {
+	gv, err := schema.ParseGroupVersion(target.ApiVersion)
+	if err != nil {
+		return nil, err
+	}
+	if gv.Version == "" || target.Kind == "" || target.Name == "" {
+		return nil, errors.New("apiVersion, kind and name of the patch target could not be empty")
+	}
+	ref := &TargetRef{
+		RefName:      target.Name,
+		RefNamespace: namespace,
+		RefKind:      target.Kind,
+		RefGroup:     gv.Group,
+		RefVersion:   gv.Version,
+	}
+	if err := setCluster(ref, target.Cluster); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+func scaleTargetRefOf(ref *TargetRef) v1beta1.ScaleTargetRef {
+	return v1beta1.ScaleTargetRef{
+		ApiVersion: schema.GroupVersion{Group: ref.RefGroup, Version: ref.RefVersion}.String(),
+		Kind:       ref.RefKind,
+		Name:       ref.RefName,
+		Cluster:    clusterRefOf(ref),
+	}
+}
+
+// parsePatch converts the patch to JSON and checks it matches the type.
+func parsePatch(spec *v1beta1.PatchSpec) (types.PatchType, []byte, error) {
+	data, err := yaml.YAMLToJSON([]byte(spec.Patch))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid patch,because of %v", err)
+	}
+	switch spec.Type {
+	case "", v1beta1.StrategicMergePatch, v1beta1.MergePatch:
+		obj := make(map[string]interface{})
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return "", nil, fmt.Errorf("invalid %s patch, it should be an object", spec.Type)
+		}
+		if spec.Type == v1beta1.MergePatch {
+			return types.MergePatchType, data, nil
+		}
+		return types.StrategicMergePatchType, data, nil
+	case v1beta1.JSONPatch:
+		if _, err := jsonpatch.DecodePatch(data); err != nil {
+			return "", nil, fmt.Errorf("invalid json patch,because of %v", err)
+		}
+		return types.JSONPatchType, data, nil
+	}
+	return "", nil, fmt.Errorf("unknown patch type %s", spec.Type)
+}
+
+// listMergeKeys are the keys matching the elements of the lists of objects, such as the containers of a pod template
+// and the containerPolicies of a VerticalPodAutoscaler, so that the inverse only restores the elements changed by
+// the patch.
+var listMergeKeys = []string{"name", "containerName"}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// inverseJSONPatch returns a json patch restoring the spec, labels and annotations of patched to original. Only the
+// fields changed by the patch are restored, and the patch tests they still have the patched values, so the revert
+// fails rather than rolling back the changes made after the patch. It's empty if nothing changed.
+func inverseJSONPatch(original, patched *unstructured.Unstructured) (string, error) {
+	tests, changes, err := inverseOperations("", restorableFields(patched), restorableFields(original))
+	if err != nil || len(changes) == 0 {
+		return "", err
+	}
+	data, err := json.Marshal(append(tests, changes...))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// inverseOperations returns the operations testing the patched values at path and restoring the original ones.
+// The changes inside the elements of a list come before the removal of its elements, which shifts the indexes.
+func inverseOperations(path string, patched, original interface{}) (tests, changes []jsonPatchOperation, err error) {
+	if equality.Semantic.DeepEqual(patched, original) {
+		return nil, nil, nil
+	}
+	add := func(ops []jsonPatchOperation, op, path string, value interface{}, withValue bool) ([]jsonPatchOperation, error) {
+		operation := jsonPatchOperation{Op: op, Path: path}
+		if withValue {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			operation.Value = data
+		}
+		return append(ops, operation), nil
+	}
+	merge := func(t, c []jsonPatchOperation, e error) error {
+		tests, changes = append(tests, t...), append(changes, c...)
+		return e
+	}
+
+	switch p := patched.(type) {
+	case map[string]interface{}:
+		o, ok := original.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(p)+len(o))
+		for k := range p {
+			keys = append(keys, k)
+		}
+		for k := range o {
+			if _, ok := p[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapeJSONPointer(k)
+			pv, inPatched := p[k]
+			ov, inOriginal := o[k]
+			switch {
+			case inPatched && inOriginal:
+				err = merge(inverseOperations(child, pv, ov))
+			case inPatched:
+				if tests, err = add(tests, "test", child, pv, true); err == nil {
+					changes, err = add(changes, "remove", child, nil, false)
+				}
+			default:
+				changes, err = add(changes, "add", child, ov, true)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return tests, changes, nil
+	case []interface{}:
+		o, ok := original.([]interface{})
+		if !ok {
+			break
+		}
+		if key := listMergeKey(p, o); key != "" {
+			originalByKey := make(map[string]interface{}, len(o))
+			for _, e := range o {
+				originalByKey[e.(map[string]interface{})[key].(string)] = e
+			}
+			patchedKeys := make(map[string]bool, len(p))
+			added := make([]int, 0)
+			for i, e := range p {
+				k := e.(map[string]interface{})[key].(string)
+				patchedKeys[k] = true
+				child := fmt.Sprintf("%s/%d", path, i)
+				if oe, ok := originalByKey[k]; ok {
+					err = merge(inverseOperations(child, e, oe))
+				} else {
+					tests, err = add(tests, "test", child, e, true)
+					added = append(added, i)
+				}
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			for i := len(added) - 1; i >= 0; i-- {
+				changes, _ = add(changes, "remove", fmt.Sprintf("%s/%d", path, added[i]), nil, false)
+			}
+			for _, e := range o {
+				if !patchedKeys[e.(map[string]interface{})[key].(string)] {
+					if changes, err = add(changes, "add", path+"/-", e, true); err != nil {
+						return nil, nil, err
+					}
+				}
+			}
+			return tests, changes, nil
+		}
+		if len(p) == len(o) {
+			for i := range p {
+				if err := merge(inverseOperations(fmt.Sprintf("%s/%d", path, i), p[i], o[i])); err != nil {
+					return nil, nil, err
+				}
+			}
+			return tests, changes, nil
+		}
+	}
+	if tests, err = add(tests, "test", path, patched, true); err != nil {
+		return nil, nil, err
+	}
+	changes, err = add(changes, "replace", path, original, true)
+	return tests, changes, err
+}
+
+// listMergeKey returns the key of listMergeKeys which is a unique string of every element of both lists.
+func listMergeKey(lists ...[]interface{}) string {
+	for _, key := range listMergeKeys {
+		matched := true
+		for _, list := range lists {
+			seen := make(map[string]bool, len(list))
+			for _, e := range list {
+				m, ok := e.(map[string]interface{})
+				if !ok {
+					matched = false
+					break
+				}
+				k, ok := m[key].(string)
+				if !ok || seen[k] {
+					matched = false
+					break
+				}
+				seen[k] = true
+			}
+		}
+		if matched {
+			return key
+		}
+	}
+	return ""
+}
+
+func escapeJSONPointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// checkInverse applies the json patch inverse to obj locally, it fails if the fields patched have changed since.
+func checkInverse(obj *unstructured.Unstructured, inverse string) error {
+	patch, err := jsonpatch.DecodePatch([]byte(inverse))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	_, err = patch.Apply(data)
+	return err
+}
+
+// restorableFields drops the status and the metadata maintained by the api server.
+func restorableFields(obj *unstructured.Unstructured) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for k, v := range obj.Object {
+		if k == "status" || k == "metadata" {
+			continue
+		}
+		fields[k] = v
+	}
+	metadata := make(map[string]interface{})
+	for _, field := range []string{"labels", "annotations"} {
+		if m, found, _ := unstructured.NestedMap(obj.Object, "metadata", field); found {
+			metadata[field] = m
+		}
+	}
+	fields["metadata"] = metadata
+	return fields
+}
+
+func retryUntilTimeout(desc string, fn func() (string, error)) (msg string, err error) {
+	startTime := time.Now()
+	times := 0
+	for {
+		if startTime.Add(maxRetryTimeout).Before(time.Now()) {
+			return "", fmt.Errorf("failed to %s after retrying %d times and exit,because of %v", desc, times, err)
+		}
+		msg, err = fn()
+		if err == nil {
+			return msg, nil
+		}
+		time.Sleep(updateRetryInterval)
+		times = times + 1
+	}
+}
+
+func (ch *CronJobHPA) applyPatch(ref *TargetRef, patchType types.PatchType, data []byte, storeInverse bool) (string, error) {
+	resource, err := ch.resourceOf(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var original *unstructured.Unstructured
+	if storeInverse {
+		original, err = resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		}
+	}
+	patched, err := resource.Patch(context.Background(), ref.RefName, patchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to patch %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	msg := fmt.Sprintf("%s %s in %s namespace patched.", ref.RefKind, ref.RefName, ref.RefNamespace)
+	if !storeInverse {
+		return msg, nil
+	}
+
+	inverse, err := inverseJSONPatch(original, patched)
+	if err != nil {
+		// the object is patched already, so don't retry
+		log.Errorf("Failed to compute inverse patch of job %s on %s %s in %s namespace,because of %v", ch.name, ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return msg + " inverse patch is not stored.", nil
+	}
+	if inverse == "" {
+		// patched twice without revert, keep the inverse of the first patch
+		return msg + " nothing changed and the inverse patch is kept.", nil
+	}
+	inversePatch := &v1beta1.InversePatch{Target: scaleTargetRefOf(ref), Patch: inverse, Type: v1beta1.JSONPatch}
+	if err := ch.inverses.save(ch.HPARef, ch.name, inversePatch); err != nil {
+		log.Errorf("Failed to store inverse patch of job %s on %s %s in %s namespace,because of %v", ch.name, ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return msg + " inverse patch is not stored.", nil
+	}
+	ch.Lock()
+	ch.inversePatch = inversePatch
+	ch.Unlock()
+	return msg + " inverse patch is stored.", nil
+}
+
+func (ch *CronJobHPA) runPatch() (string, error) {
+	ref := ch.TargetRef
+	return retryUntilTimeout(fmt.Sprintf("patch %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace), func() (string, error) {
+		return ch.applyPatch(ref, ch.patchType, ch.patchData, ch.storeInverse)
+	})
+}
+
+// runRevert applies the inverse patch stored by the job of revertOf. The inverse is read from the InverseStore
+// rather than status, and only applied to the current target of the job.
+func (ch *CronJobHPA) runRevert() (string, error) {
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := ch.client.Get(context.Background(), types.NamespacedName{Namespace: ch.HPARef.Namespace, Name: ch.HPARef.Name}, instance); err != nil {
+		return "", fmt.Errorf("failed to get cronHPA %s,because of %v", ch.HPARef.Name, err)
+	}
+	target, err := ch.revertTarget(instance)
+	if err != nil {
+		return "", err
+	}
+	inverse, err := ch.inverses.load(instance, ch.revertOf)
+	if err != nil {
+		return "", err
+	}
+	if inverse == nil {
+		return "", fmt.Errorf("no inverse patch of job %s is stored, enable storeInverse of the job and wait for it to run", ch.revertOf)
+	}
+	if !equality.Semantic.DeepEqual(inverse.Target, scaleTargetRefOf(target)) {
+		return "", fmt.Errorf("inverse patch of job %s is stored for %s %s which is not the target of the job any more", ch.revertOf, inverse.Target.Kind, inverse.Target.Name)
+	}
+	ref := target
+	// the inverse patches stored before the json patches are merge patches
+	patchType := types.MergePatchType
+	if inverse.Type == v1beta1.JSONPatch {
+		patchType = types.JSONPatchType
+		resource, err := ch.resourceOf(ref)
+		if err != nil {
+			return "", err
+		}
+		obj, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		}
+		if err := checkInverse(obj, inverse.Patch); err != nil {
+			return "", fmt.Errorf("refuse to revert the patch of job %s, the fields it changed on %s %s have been changed since,because of %v", ch.revertOf, ref.RefKind, ref.RefName, err)
+		}
+	}
+	msg, err := retryUntilTimeout(fmt.Sprintf("revert %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace), func() (string, error) {
+		return ch.applyPatch(ref, patchType, []byte(inverse.Patch), false)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("patch of job %s reverted. %s", ch.revertOf, msg), nil
+}
+
+// revertTarget returns the current target of the patch or vpa job reverted, which stores its inverse patch.
+func (ch *CronJobHPA) revertTarget(instance *v1beta1.CronHorizontalPodAutoscaler) (*TargetRef, error) {
+	jobs, err := ResolveJobs(ch.client, instance)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.Name != ch.revertOf {
+			continue
+		}
+		switch {
+		case job.Action == v1beta1.PatchAction && job.Patch != nil && job.Patch.StoreInverse:
+			target := instance.Spec.ScaleTargetRef
+			if job.Patch.Target != nil {
+				target = *job.Patch.Target
+			}
+			return newPatchTarget(target, instance.Namespace)
+		case job.Action == v1beta1.VPAAction && job.VPA != nil:
+			return newVPATarget(job.VPA, instance.Namespace, ch.mapper)
+		}
+		break
+	}
+	return nil, fmt.Errorf("job %s is not a patch job with storeInverse or a vpa job", ch.revertOf)
+}
+
+// InversePatch returns the inverse of the last patch applied by the job.
+func (ch *CronJobHPA) InversePatch() *v1beta1.InversePatch {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.inversePatch
+}
+
+func isPatchAction(action v1beta1.JobAction) bool {
+	return action == v1beta1.PatchAction || action == v1beta1.RevertAction
+}
+
+func isScaleAction(action v1beta1.JobAction) bool {
+	return action == "" || action == v1beta1.ScaleAction
+}
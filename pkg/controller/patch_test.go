@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"encoding/json"
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInverseJSONPatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		original string
+		patched  string
+		// the object when it's reverted, patched if empty
+		current string
+		// the object after the revert, original if empty
+		restored string
+		inverse  string
+		conflict bool
+	}{
+		{
+			name:     "changed field",
+			original: `{"metadata":{"name":"web","resourceVersion":"1"},"spec":{"replicas":3,"paused":false}}`,
+			patched:  `{"metadata":{"name":"web","resourceVersion":"2"},"spec":{"replicas":3,"paused":true}}`,
+			inverse:  `[{"op":"test","path":"/spec/paused","value":true},{"op":"replace","path":"/spec/paused","value":false}]`,
+		},
+		{
+			name:     "added fields are removed",
+			original: `{"metadata":{"name":"web"},"spec":{"template":{"spec":{}}}}`,
+			patched:  `{"metadata":{"name":"web","labels":{"night":"true"}},"spec":{"template":{"spec":{"nodeSelector":{"spot":"true"}}}}}`,
+			inverse: `[{"op":"test","path":"/metadata/labels","value":{"night":"true"}},{"op":"test","path":"/spec/template/spec/nodeSelector","value":{"spot":"true"}},` +
+				`{"op":"remove","path":"/metadata/labels"},{"op":"remove","path":"/spec/template/spec/nodeSelector"}]`,
+		},
+		{
+			name:     "removed fields are added",
+			original: `{"metadata":{"name":"web","annotations":{"example.com/owner":"web"}},"spec":{"suspend":false}}`,
+			patched:  `{"metadata":{"name":"web","annotations":{}},"spec":{"suspend":false}}`,
+			inverse:  `[{"op":"add","path":"/metadata/annotations/example.com~1owner","value":"web"}]`,
+		},
+		{
+			name:     "status is ignored",
+			original: `{"metadata":{"name":"web"},"spec":{"suspend":false},"status":{"active":1}}`,
+			patched:  `{"metadata":{"name":"web"},"spec":{"suspend":false},"status":{"active":0}}`,
+			inverse:  ``,
+		},
+		{
+			name:     "containers reordered after the patch",
+			original: `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1","resources":{"limits":{"cpu":"1"}}},{"name":"log","image":"log:v1"}]}}}}`,
+			patched:  `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1","resources":{"limits":{"cpu":"4"}}},{"name":"log","image":"log:v1"}]}}}}`,
+			current:  `{"spec":{"template":{"spec":{"containers":[{"name":"log","image":"log:v1"},{"name":"web","image":"web:v2","resources":{"limits":{"cpu":"4"}}}]}}}}`,
+			inverse: `[{"op":"test","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"4"},` +
+				`{"op":"replace","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"1"}]`,
+			// the reordered containers don't match the indexes of the patch any more
+			conflict: true,
+		},
+		{
+			name:     "image deployed after the patch is kept",
+			original: `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1","resources":{"limits":{"cpu":"1"}}}]}}}}`,
+			patched:  `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1","resources":{"limits":{"cpu":"4"}}}]}}}}`,
+			current:  `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v2","resources":{"limits":{"cpu":"4"}}}]}}}}`,
+			restored: `{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v2","resources":{"limits":{"cpu":"1"}}}]}}}}`,
+			inverse: `[{"op":"test","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"4"},` +
+				`{"op":"replace","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"1"}]`,
+		},
+		{
+			name:     "patched field changed after the patch",
+			original: `{"spec":{"template":{"spec":{"containers":[{"name":"web","resources":{"limits":{"cpu":"1"}}}]}}}}`,
+			patched:  `{"spec":{"template":{"spec":{"containers":[{"name":"web","resources":{"limits":{"cpu":"4"}}}]}}}}`,
+			current:  `{"spec":{"template":{"spec":{"containers":[{"name":"web","resources":{"limits":{"cpu":"2"}}}]}}}}`,
+			inverse: `[{"op":"test","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"4"},` +
+				`{"op":"replace","path":"/spec/template/spec/containers/0/resources/limits/cpu","value":"1"}]`,
+			conflict: true,
+		},
+		{
+			name:     "added and removed containers",
+			original: `{"spec":{"template":{"spec":{"containers":[{"name":"web"},{"name":"log"}]}}}}`,
+			patched:  `{"spec":{"template":{"spec":{"containers":[{"name":"proxy"},{"name":"web"},{"name":"debug"}]}}}}`,
+			restored: `{"spec":{"template":{"spec":{"containers":[{"name":"web"},{"name":"log"}]}}}}`,
+			inverse: `[{"op":"test","path":"/spec/template/spec/containers/0","value":{"name":"proxy"}},{"op":"test","path":"/spec/template/spec/containers/2","value":{"name":"debug"}},` +
+				`{"op":"remove","path":"/spec/template/spec/containers/2"},{"op":"remove","path":"/spec/template/spec/containers/0"},` +
+				`{"op":"add","path":"/spec/template/spec/containers/-","value":{"name":"log"}}]`,
+		},
+		{
+			name:     "list without merge key",
+			original: `{"spec":{"args":["--v=1"]}}`,
+			patched:  `{"spec":{"args":["--v=1","--debug"]}}`,
+			inverse:  `[{"op":"test","path":"/spec/args","value":["--v=1","--debug"]},{"op":"replace","path":"/spec/args","value":["--v=1"]}]`,
+		},
+	}
+	for _, c := range cases {
+		original, patched := unstructuredOf(t, c.original), unstructuredOf(t, c.patched)
+		inverse, err := inverseJSONPatch(original, patched)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if c.inverse == "" || inverse == "" {
+			if inverse != c.inverse {
+				t.Errorf("%s: expected inverse %q, got %q", c.name, c.inverse, inverse)
+			}
+			continue
+		}
+		if !jsonEqual(t, inverse, c.inverse) {
+			t.Errorf("%s: expected inverse %s, got %s", c.name, c.inverse, inverse)
+		}
+
+		current := patched
+		if c.current != "" {
+			current = unstructuredOf(t, c.current)
+		}
+		err = checkInverse(current, inverse)
+		if c.conflict {
+			if err == nil {
+				t.Errorf("%s: expected the revert to be refused", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		patch, _ := jsonpatch.DecodePatch([]byte(inverse))
+		data, _ := json.Marshal(current.Object)
+		restored, err := patch.Apply(data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		expected := original
+		if c.restored != "" {
+			expected = unstructuredOf(t, c.restored)
+		}
+		got := unstructuredOf(t, string(restored))
+		if !reflect.DeepEqual(got.Object["spec"], expected.Object["spec"]) || !reflect.DeepEqual(got.GetLabels(), expected.GetLabels()) ||
+			!reflect.DeepEqual(got.GetAnnotations(), expected.GetAnnotations()) {
+			t.Errorf("%s: expected restored %v, got %v", c.name, expected.Object, got.Object)
+		}
+	}
+}
+
+func TestInverseKey(t *testing.T) {
+	key := inverseKey("default", "web", "spot-at-night")
+	if !strings.HasPrefix(key, "default_web_") {
+		t.Errorf("unexpected key %s", key)
+	}
+	if key == inverseKey("default", "web", "batch-window") || key == inverseKey("default", "web-spot", "spot-at-night") {
+		t.Errorf("keys of different jobs should be different")
+	}
+	if key != inverseKey("default", "web", "spot-at-night") {
+		t.Errorf("key should be stable")
+	}
+}
+
+// unstructuredOf decodes the numbers to int64 like the api clients.
+func unstructuredOf(t *testing.T, data string) *unstructured.Unstructured {
+	obj := make(map[string]interface{})
+	if err := utiljson.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("invalid json %s: %v", data, err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func jsonEqual(t *testing.T, a, b string) bool {
+	var x, y interface{}
+	if err := json.Unmarshal([]byte(a), &x); err != nil {
+		t.Fatalf("invalid json %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &y); err != nil {
+		t.Fatalf("invalid json %s: %v", b, err)
+	}
+	return reflect.DeepEqual(x, y)
+}
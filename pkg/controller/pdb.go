@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/ringtail/go-cron"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stepInterval = 10 * time.Second
+	// a step-wise scale-down stops if it doesn't reach the target size within the timeout.
+	maxStepDuration = time.Hour
+)
+
+var (
+	pdbResource        = schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}
+	pdbResourceV1beta1 = schema.GroupVersionResource{Group: "policy", Version: "v1beta1", Resource: "poddisruptionbudgets"}
+)
+
+// pdbFloor returns the replicas the PodDisruptionBudgets matching the pods of the target require when it has the
+// current replicas, and the names of the budgets.
+func (ch *CronJobHPA) pdbFloor(env *targetSizeEnv, current int32) (int32, []string, error) {
+	ref := env.ref
+	template, err := ch.podTemplateOf(env)
+	if err != nil {
+		return 0, nil, err
+	}
+	dynamicClient := ch.dynamicClient
+	if ref.Cluster != "" {
+		clients, err := ch.clientsOf(ref)
+		if err != nil {
+			return 0, nil, err
+		}
+		dynamicClient = clients.dynamicClient
+	}
+	budgets, legacy, err := listPDBs(dynamicClient, ref.RefNamespace)
+	if err != nil {
+		return 0, nil, err
+	}
+	var floor int32
+	names := make([]string, 0)
+	podLabels := labels.Set(template.Labels)
+	for _, pdb := range budgets {
+		selector := &metav1.LabelSelector{}
+		data, found, _ := unstructured.NestedMap(pdb.Object, "spec", "selector")
+		// an empty selector of policy/v1beta1 selects no pods
+		if (!found || len(data) == 0) && legacy {
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(data, selector); err != nil {
+			return 0, nil, fmt.Errorf("invalid selector of poddisruptionbudget %s,because of %v", pdb.GetName(), err)
+		}
+		s, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid selector of poddisruptionbudget %s,because of %v", pdb.GetName(), err)
+		}
+		if !s.Matches(podLabels) {
+			continue
+		}
+		required, err := pdbRequired(pdb, current)
+		if err != nil {
+			return 0, nil, err
+		}
+		names = append(names, pdb.GetName())
+		if required > floor {
+			floor = required
+		}
+	}
+	return floor, names, nil
+}
+
+// listPDBs lists the budgets of policy/v1, or policy/v1beta1 in the clusters before 1.21.
+func listPDBs(dynamicClient dynamic.Interface, namespace string) ([]unstructured.Unstructured, bool, error) {
+	list, err := dynamicClient.Resource(pdbResource).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	legacy := false
+	if errors.IsNotFound(err) {
+		legacy = true
+		list, err = dynamicClient.Resource(pdbResourceV1beta1).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list poddisruptionbudgets in %s namespace,because of %v", namespace, err)
+	}
+	return list.Items, legacy, nil
+}
+
+// pdbRequired resolves minAvailable or maxUnavailable of the budget against the current replicas, the percents are
+// rounded up like the disruption controller.
+func pdbRequired(pdb unstructured.Unstructured, current int32) (int32, error) {
+	for _, field := range []string{"minAvailable", "maxUnavailable"} {
+		value, found, _ := unstructured.NestedFieldNoCopy(pdb.Object, "spec", field)
+		if !found || value == nil {
+			continue
+		}
+		var v intstr.IntOrString
+		switch t := value.(type) {
+		case int64:
+			v = intstr.FromInt(int(t))
+		case float64:
+			v = intstr.FromInt(int(t))
+		case string:
+			v = intstr.FromString(t)
+		default:
+			return 0, fmt.Errorf("invalid %s of poddisruptionbudget %s", field, pdb.GetName())
+		}
+		scaled, err := intstr.GetValueFromIntOrPercent(&v, int(current), true)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s of poddisruptionbudget %s,because of %v", field, pdb.GetName(), err)
+		}
+		if field == "maxUnavailable" {
+			scaled = int(current) - scaled
+		}
+		if scaled < 0 {
+			scaled = 0
+		}
+		return int32(scaled), nil
+	}
+	return 0, nil
+}
+
+// clampScaleDown returns the size a scale-down stops at to keep the replicas the budgets require. It returns
+// true if the scale-down continues in steps.
+func (ch *CronJobHPA) clampScaleDown(ref *TargetRef, size int32) (int32, string, bool, error) {
+	if ch.pdbPolicy == nil || ref.RefKind == externalKind {
+		return size, "", false, nil
+	}
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	current, err := env.currentReplicas()
+	if err != nil {
+		return size, "", false, fmt.Errorf("failed to get current replicas of %s %s for poddisruptionbudgets,because of %v", ref.RefKind, ref.RefName, err)
+	}
+	if size >= current {
+		return size, "", false, nil
+	}
+	// the scale-down is not done if the budgets could not be read
+	floor, names, err := ch.pdbFloor(env, current)
+	if err != nil {
+		return size, "", false, err
+	}
+	if len(names) == 0 {
+		return size, "", false, nil
+	}
+	status := v1beta1.PDBClampStatus{
+		ScaleTargetRef:       scaleTargetRefOf(ref),
+		CurrentReplicas:      current,
+		RequestedReplicas:    size,
+		AllowedReplicas:      size,
+		PodDisruptionBudgets: names,
+	}
+	if floor <= size {
+		ch.recordClamp(status)
+		return size, "", false, nil
+	}
+	if floor > current {
+		floor = current
+	}
+	status.AllowedReplicas = floor
+	status.Stepping = ch.pdbPolicy.StepWise && ch.steps != nil && floor < current
+	status.Message = fmt.Sprintf("poddisruptionbudgets %s require %d of %d replicas", strings.Join(names, ","), floor, current)
+	ch.recordClamp(status)
+	msg := fmt.Sprintf("scale-down of %s %s to %d is clamped to %d, %s.", ref.RefKind, ref.RefName, size, floor, status.Message)
+	return floor, msg, status.Stepping, nil
+}
+
+func (ch *CronJobHPA) recordClamp(status v1beta1.PDBClampStatus) {
+	ch.Lock()
+	defer ch.Unlock()
+	for i := range ch.pdbClamps {
+		if equality.Semantic.DeepEqual(ch.pdbClamps[i].ScaleTargetRef, status.ScaleTargetRef) {
+			ch.pdbClamps[i] = status
+			return
+		}
+	}
+	ch.pdbClamps = append(ch.pdbClamps, status)
+}
+
+// PDBClampStatus returns the clamps of the scale-downs of the last execution.
+func (ch *CronJobHPA) PDBClampStatus() []v1beta1.PDBClampStatus {
+	ch.Lock()
+	defer ch.Unlock()
+	return append([]v1beta1.PDBClampStatus(nil), ch.pdbClamps...)
+}
+
+// podsTerminated returns whether the pods of the target are no more than the replicas and none is terminating.
+func (ch *CronJobHPA) podsTerminated(env *targetSizeEnv, replicas int32) (bool, error) {
+	ref := env.ref
+	template, err := ch.podTemplateOf(env)
+	if err != nil {
+		return false, err
+	}
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return false, err
+	}
+	pods, err := clients.dynamicClient.Resource(podResource).Namespace(ref.RefNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(template.Labels).String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list pods of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	var running int32
+	for _, pod := range pods.Items {
+		if pod.GetDeletionTimestamp() != nil {
+			return false, nil
+		}
+		running++
+	}
+	return running <= replicas, nil
+}
+
+// ScaleDownStepper continues the clamped scale-downs in steps, one at most for every target. A job changing the
+// target or the removal of the job stops its stepping, and the result of a finished stepping is passed to the handler.
+type ScaleDownStepper struct {
+	sync.Mutex
+	running map[string]stepping
+	handler func(js *cron.JobResult)
+}
+
+type stepping struct {
+	job  *CronJobHPA
+	stop chan struct{}
+}
+
+func NewScaleDownStepper(handler func(js *cron.JobResult)) *ScaleDownStepper {
+	return &ScaleDownStepper{
+		running: make(map[string]stepping),
+		handler: handler,
+	}
+}
+
+func (s *ScaleDownStepper) start(job *CronJobHPA, ref *TargetRef, current, size int32) {
+	stop := make(chan struct{})
+	s.Lock()
+	if old, ok := s.running[targetKey(ref)]; ok {
+		close(old.stop)
+	}
+	s.running[targetKey(ref)] = stepping{job: job, stop: stop}
+	s.Unlock()
+	go s.run(job, ref, current, size, stop)
+}
+
+func (s *ScaleDownStepper) stop(ref *TargetRef) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if old, ok := s.running[targetKey(ref)]; ok {
+		close(old.stop)
+		delete(s.running, targetKey(ref))
+	}
+}
+
+// stopJob stops the steppings started by the job, which is removed or replaced.
+func (s *ScaleDownStepper) stopJob(job *CronJobHPA) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	for key, old := range s.running {
+		if old.job == job {
+			close(old.stop)
+			delete(s.running, key)
+		}
+	}
+}
+
+func (s *ScaleDownStepper) run(job *CronJobHPA, ref *TargetRef, current, size int32, stop chan struct{}) {
+	env := &targetSizeEnv{ch: job, ref: ref, values: make(map[string]float64)}
+	deadline := time.Now().Add(maxStepDuration)
+	steps := 1
+	var err error
+	msg := ""
+	for current > size {
+		select {
+		case <-stop:
+			log.Infof("Stop the step-wise scale-down of %s %s in %s namespace by job %s", ref.RefKind, ref.RefName, ref.RefNamespace, job.Name())
+			return
+		case <-time.After(stepInterval):
+		}
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("step-wise scale-down of %s %s stopped at %d replicas after %v", ref.RefKind, ref.RefName, current, maxStepDuration)
+			break
+		}
+		if f, e := job.freezes.frozen(job.HPARef.Namespace, labels.Set(job.HPARef.Labels)); e == nil && f != nil {
+			msg = fmt.Sprintf("step-wise scale-down of %s %s stopped at %d replicas, %v.", ref.RefKind, ref.RefName, current, f)
+			break
+		}
+		terminated, e := job.podsTerminated(env, current)
+		if e != nil || !terminated {
+			continue
+		}
+		floor, names, e := job.pdbFloor(env, current)
+		if e != nil {
+			log.Warningf("Failed to get poddisruptionbudgets of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, e)
+			continue
+		}
+		next := size
+		if floor > next {
+			next = floor
+		}
+		if next >= current {
+			msg = fmt.Sprintf("step-wise scale-down of %s %s stopped at %d replicas, poddisruptionbudgets %s require %d.", ref.RefKind, ref.RefName, current, strings.Join(names, ","), floor)
+			break
+		}
+		log.Infof("Scale %s %s in %s namespace down from %d to %d in step %d", ref.RefKind, ref.RefName, ref.RefNamespace, current, next, steps+1)
+		if _, err = job.retryScale(ref, next); err != nil {
+			break
+		}
+		current = next
+		steps++
+	}
+	if msg == "" && err == nil {
+		msg = fmt.Sprintf("scaled %s %s down to %d in %d steps.", ref.RefKind, ref.RefName, current, steps)
+	}
+
+	s.Lock()
+	if s.running[targetKey(ref)].stop != stop {
+		s.Unlock()
+		return
+	}
+	delete(s.running, targetKey(ref))
+	s.Unlock()
+	for _, c := range job.PDBClampStatus() {
+		if equality.Semantic.DeepEqual(c.ScaleTargetRef, scaleTargetRefOf(ref)) {
+			c.AllowedReplicas = current
+			c.Stepping = false
+			job.recordClamp(c)
+		}
+	}
+	if s.handler != nil {
+		s.handler(&cron.JobResult{JobId: job.ID(), Ref: job, Msg: msg, Error: err})
+	}
+}
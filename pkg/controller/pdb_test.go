@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestPDBRequired(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     string
+		current  int32
+		required int32
+		err      bool
+	}{
+		{name: "minAvailable", spec: `{"minAvailable":3}`, current: 10, required: 3},
+		{name: "minAvailable percent rounds up", spec: `{"minAvailable":"25%"}`, current: 10, required: 3},
+		{name: "maxUnavailable", spec: `{"maxUnavailable":2}`, current: 10, required: 8},
+		{name: "maxUnavailable percent rounds up", spec: `{"maxUnavailable":"15%"}`, current: 10, required: 8},
+		{name: "maxUnavailable more than current", spec: `{"maxUnavailable":5}`, current: 3, required: 0},
+		{name: "null minAvailable", spec: `{"minAvailable":null,"maxUnavailable":1}`, current: 4, required: 3},
+		{name: "no budget", spec: `{}`, current: 4, required: 0},
+		{name: "invalid percent", spec: `{"minAvailable":"many"}`, current: 4, err: true},
+		{name: "invalid type", spec: `{"minAvailable":true}`, current: 4, err: true},
+	}
+	for _, c := range cases {
+		pdb := unstructuredOf(t, `{"metadata":{"name":"web"},"spec":`+c.spec+`}`)
+		required, err := pdbRequired(*pdb, c.current)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if required != c.required {
+			t.Errorf("%s: expected %d, got %d", c.name, c.required, required)
+		}
+	}
+}
+
+func TestScaleDownStepperStopJob(t *testing.T) {
+	removed, other := &CronJobHPA{name: "scale-down"}, &CronJobHPA{name: "scale-down-night"}
+	s := NewScaleDownStepper(nil)
+	steppings := map[string]stepping{
+		"web": {job: removed, stop: make(chan struct{})},
+		"api": {job: removed, stop: make(chan struct{})},
+		"db":  {job: other, stop: make(chan struct{})},
+	}
+	for key, run := range steppings {
+		s.running[key] = run
+	}
+	s.stopJob(removed)
+	for key, run := range steppings {
+		stopped := false
+		select {
+		case <-run.stop:
+			stopped = true
+		default:
+		}
+		if _, running := s.running[key]; stopped != (run.job == removed) || running == stopped {
+			t.Errorf("%s: expected stopped %v, got stopped %v and running %v", key, run.job == removed, stopped, running)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/ringtail/go-cron"
+	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"time"
+)
+
+const (
+	// the schedules are checked against minJobIntervalSeconds in the window at admission time.
+	policyScheduleWindow = 7 * 24 * time.Hour
+	maxPolicyFiresPerJob = 2000
+)
+
+// PolicyViolation is the error of a cronHPA or a job forbidden by a CronHPAPolicy.
+type PolicyViolation struct {
+	Policy string
+	Reason string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("denied by CronHPAPolicy %s, %s", v.Policy, v.Reason)
+}
+
+func isPolicyViolation(err error) bool {
+	_, ok := err.(*PolicyViolation)
+	return ok
+}
+
+// policiesOf returns the policies selecting the namespace, nothing if the CronHPAPolicy CRD is not installed.
+func policiesOf(ctx context.Context, c client.Client, namespace string) ([]v1beta1.CronHPAPolicy, error) {
+	list := &v1beta1.CronHPAPolicyList{}
+	if err := c.List(ctx, list); err != nil {
+		if apimeta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list CronHPAPolicies,because of %v", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	ns := &v1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s,because of %v", namespace, err)
+	}
+	policies := make([]v1beta1.CronHPAPolicy, 0)
+	for _, p := range list.Items {
+		selector, err := labelSelectorOrEverything(p.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector of CronHPAPolicy %s,because of %v", p.Name, err)
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			policies = append(policies, p)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	return policies, nil
+}
+
+// cronHPATargets returns the targets scaled by the jobs of the cronHPA, nil if the spec is invalid.
+func cronHPATargets(instance *v1beta1.CronHorizontalPodAutoscaler) []*WeightedTargetRef {
+	if instance.Spec.External != nil {
+		ref, err := newExternalTarget(instance.Spec.External, instance.Namespace)
+		if err != nil {
+			return nil
+		}
+		return []*WeightedTargetRef{{TargetRef: ref, Weight: 1}}
+	}
+	if instance.Spec.Distribution != nil {
+		refs, err := newDistribution(instance.Spec.Distribution, instance.Namespace)
+		if err != nil {
+			return nil
+		}
+		return refs
+	}
+	ref, err := newTargetRef(instance.Spec.ScaleTargetRef, instance.Namespace)
+	if err != nil {
+		return nil
+	}
+	return []*WeightedTargetRef{{TargetRef: ref, Weight: 1}}
+}
+
+func targetKey(ref *TargetRef) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", ref.Cluster, ref.RefNamespace, ref.RefGroup, ref.RefKind, ref.RefName)
+}
+
+func targetsContain(refs []*WeightedTargetRef, ref *TargetRef) bool {
+	for _, r := range refs {
+		if targetKey(r.TargetRef) == targetKey(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// withResolvedJobs returns a copy of the cronHPA with the jobs of its profileRef in spec.jobs, so that the policies
+// check them like the jobs of the cronHPA. The cronHPA without profileRef is returned as is.
+func withResolvedJobs(c client.Client, instance *v1beta1.CronHorizontalPodAutoscaler) (*v1beta1.CronHorizontalPodAutoscaler, error) {
+	if instance.Spec.ProfileRef == nil {
+		return instance, nil
+	}
+	jobs, err := ResolveJobs(c, instance)
+	if err != nil {
+		return nil, err
+	}
+	resolved := instance.DeepCopy()
+	resolved.Spec.Jobs = jobs
+	resolved.Spec.ProfileRef = nil
+	return resolved, nil
+}
+
+// resolvedCronHPAs returns the cronHPAs with the jobs of their profiles. A cronHPA whose profile could not be resolved
+// has no jobs to check and is kept as is, it's still counted by scalesTargets.
+func resolvedCronHPAs(c client.Client, items []v1beta1.CronHorizontalPodAutoscaler) []*v1beta1.CronHorizontalPodAutoscaler {
+	cronHPAs := make([]*v1beta1.CronHorizontalPodAutoscaler, 0, len(items))
+	for i := range items {
+		resolved, err := withResolvedJobs(c, &items[i])
+		if err != nil {
+			resolved = &items[i]
+		}
+		cronHPAs = append(cronHPAs, resolved)
+	}
+	return cronHPAs
+}
+
+// scheduledReplicas returns the current replicas of the targets of the other cronHPAs scaling targets in the
+// namespace, every target counted once and the excluded targets not counted. The replicas are read with the identity
+// of the controller rather than from the status of the cronHPAs, which could be written by their authors. The
+// targets in remote clusters and the external targets count with their share of the largest targetSize.
+func (ch *CronJobHPA) scheduledReplicas(others []*v1beta1.CronHorizontalPodAutoscaler, excluded []*TargetRef) (int32, error) {
+	reader := &CronJobHPA{scaler: ch.scaler, mapper: ch.mapper, client: ch.client, dynamicClient: ch.dynamicClient}
+	counted := make(map[string]bool)
+	for _, ref := range excluded {
+		counted[targetKey(ref)] = true
+	}
+	var total int32
+	for _, other := range others {
+		if !scalesTargets(other) {
+			continue
+		}
+		targets := cronHPATargets(other)
+		weights := make([]int32, 0, len(targets))
+		for _, t := range targets {
+			weights = append(weights, t.Weight)
+		}
+		shares := splitTargetSize(peakTargetSize(other), weights)
+		for i, t := range targets {
+			if counted[targetKey(t.TargetRef)] {
+				continue
+			}
+			counted[targetKey(t.TargetRef)] = true
+			if t.Cluster != "" || t.RefKind == externalKind {
+				total += shares[i]
+				continue
+			}
+			env := &targetSizeEnv{ch: reader, ref: t.TargetRef, values: make(map[string]float64)}
+			replicas, err := env.currentReplicas()
+			if err != nil {
+				return 0, fmt.Errorf("failed to get replicas of %s %s of cronHPA %s,because of %v", t.RefKind, t.RefName, other.Name, err)
+			}
+			total += replicas
+		}
+	}
+	return total, nil
+}
+
+// scalesTargets returns whether the cronHPA has scale jobs, the jobs of an unresolved profile are assumed to scale.
+func scalesTargets(instance *v1beta1.CronHorizontalPodAutoscaler) bool {
+	if instance.Spec.ProfileRef != nil {
+		return true
+	}
+	for _, job := range instance.Spec.Jobs {
+		if isScaleAction(job.Action) {
+			return true
+		}
+	}
+	return false
+}
+
+// recentJobFire returns the latest fire time of the jobs on the target within the interval before now by their
+// schedules, other than the current run of the job itself, which is its own latest fire time until selfUntil. The
+// job runs before its schedule with readyBy, so selfUntil is later than now.
+func recentJobFire(cronHPAs []*v1beta1.CronHorizontalPodAutoscaler, self, selfJob string, ref *TargetRef, interval time.Duration, now, selfUntil time.Time) (jobFire, bool) {
+	var last jobFire
+	found := false
+	for _, cronHPA := range cronHPAs {
+		if !targetsContain(cronHPATargets(cronHPA), ref) {
+			continue
+		}
+		for _, job := range cronHPA.Spec.Jobs {
+			schedule, err := cron.Parse(job.Schedule)
+			if err != nil {
+				continue
+			}
+			isSelf, until := cronHPA.Name == self && job.Name == selfJob, now
+			if isSelf {
+				until = selfUntil
+			}
+			fires := make([]time.Time, 0)
+			for next := schedule.Next(now.Add(-interval)); !next.IsZero() && !next.After(until) && len(fires) < maxPolicyFiresPerJob; next = schedule.Next(next) {
+				fires = append(fires, next)
+			}
+			if isSelf && len(fires) != 0 {
+				fires = fires[:len(fires)-1]
+			}
+			if len(fires) != 0 && (!found || fires[len(fires)-1].After(last.at)) {
+				last = jobFire{at: fires[len(fires)-1], job: fmt.Sprintf("%s/%s", cronHPA.Name, job.Name)}
+				found = true
+			}
+		}
+	}
+	return last, found
+}
+
+// peakTargetSize is the largest targetSize of the scale jobs of the cronHPA.
+func peakTargetSize(instance *v1beta1.CronHorizontalPodAutoscaler) int32 {
+	var peak int32
+	for _, job := range instance.Spec.Jobs {
+		if isScaleAction(job.Action) && job.TargetSize > peak {
+			peak = job.TargetSize
+		}
+	}
+	return peak
+}
+
+func targetLabels(resource dynamic.NamespaceableResourceInterface, ref *TargetRef) (labels.Set, error) {
+	obj, err := resource.Namespace(ref.RefNamespace).Get(context.Background(), ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	return labels.Set(obj.GetLabels()), nil
+}
+
+func isCritical(policy v1beta1.CronHPAPolicy, set labels.Set) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.CriticalWorkloadSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid criticalWorkloadSelector of CronHPAPolicy %s,because of %v", policy.Name, err)
+	}
+	return selector.Matches(set), nil
+}
+
+// enforcePolicies checks the policies of the namespace right before the target is scaled to size.
+func (ch *CronJobHPA) enforcePolicies(ref *TargetRef, size int32) error {
+	// self is empty for a job of a clusterCronHPA, so all the cronHPAs of the namespace count
+	namespace, self := ch.policyNamespace, ""
+	if ch.HPARef != nil {
+		namespace, self = ch.HPARef.Namespace, ch.HPARef.Name
+	}
+	if namespace == "" || ch.client == nil {
+		return nil
+	}
+	ctx := context.Background()
+	policies, err := policiesOf(ctx, ch.client, namespace)
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+
+	var cronHPAs []*v1beta1.CronHorizontalPodAutoscaler
+	listCronHPAs := func() error {
+		if cronHPAs != nil {
+			return nil
+		}
+		list := &v1beta1.CronHorizontalPodAutoscalerList{}
+		if err := ch.client.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return fmt.Errorf("failed to list cronHPAs in %s namespace,because of %v", namespace, err)
+		}
+		cronHPAs = resolvedCronHPAs(ch.client, list.Items)
+		return nil
+	}
+	var set labels.Set
+
+	for _, p := range policies {
+		spec := p.Spec
+		if spec.MaxReplicasPerTarget != nil && size > *spec.MaxReplicasPerTarget {
+			return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("target size %d of %s %s is more than maxReplicasPerTarget %d", size, ref.RefKind, ref.RefName, *spec.MaxReplicasPerTarget)}
+		}
+		if spec.CriticalWorkloadSelector != nil && size == 0 && ref.RefKind != externalKind {
+			if set == nil {
+				resource, err := ch.resourceOf(ref)
+				if err != nil {
+					return err
+				}
+				obj, err := resource.Get(ctx, ref.RefName, metav1.GetOptions{})
+				if err != nil {
+					return fmt.Errorf("failed to get %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+				}
+				set = labels.Set(obj.GetLabels())
+			}
+			critical, err := isCritical(p, set)
+			if err != nil {
+				return err
+			}
+			if critical {
+				return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("%s %s is a critical workload and could not be scaled to 0", ref.RefKind, ref.RefName)}
+			}
+		}
+		if spec.MaxReplicasPerNamespace != nil {
+			if err := listCronHPAs(); err != nil {
+				return err
+			}
+			// the whole size of a distributed job counts
+			total, excluded := size, []*TargetRef{ref}
+			if len(ch.Distribution) != 0 {
+				total, excluded = ch.DesiredSize, excluded[:0]
+				for _, t := range ch.Distribution {
+					excluded = append(excluded, t.TargetRef)
+				}
+			}
+			others := make([]*v1beta1.CronHorizontalPodAutoscaler, 0, len(cronHPAs))
+			for _, other := range cronHPAs {
+				if other.Name != self {
+					others = append(others, other)
+				}
+			}
+			replicas, err := ch.scheduledReplicas(others, excluded)
+			if err != nil {
+				return err
+			}
+			total += replicas
+			if total > *spec.MaxReplicasPerNamespace {
+				return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("scheduled replicas %d in %s namespace would be more than maxReplicasPerNamespace %d", total, namespace, *spec.MaxReplicasPerNamespace)}
+			}
+		}
+		if spec.MinJobIntervalSeconds != nil {
+			if err := listCronHPAs(); err != nil {
+				return err
+			}
+			interval := time.Duration(*spec.MinJobIntervalSeconds) * time.Second
+			now, selfUntil := time.Now(), time.Now()
+			if ch.readyBy {
+				selfUntil = now.Add(ch.readyByLead())
+			}
+			if last, found := recentJobFire(cronHPAs, self, ch.name, ref, interval, now, selfUntil); found {
+				return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("job %s on %s %s is scheduled %v ago, less than minJobIntervalSeconds %d", last.job, ref.RefKind, ref.RefName, time.Since(last.at).Round(time.Second), *spec.MinJobIntervalSeconds)}
+			}
+		}
+	}
+	return nil
+}
+
+type jobFire struct {
+	at  time.Time
+	job string
+}
+
+// CheckPolicies checks the cronHPA against the policies of its namespace at admission time.
+// The sizes computed at fire time, such as targetSizeExpr and targetSizeFrom, are checked when the jobs run.
+// The jobs of profileRef are resolved and checked like the jobs of the cronHPA.
+func CheckPolicies(ctx context.Context, c client.Client, mapper apimeta.RESTMapper, dynamicClient dynamic.Interface, instance *v1beta1.CronHorizontalPodAutoscaler) error {
+	policies, err := policiesOf(ctx, c, instance.Namespace)
+	if err != nil || len(policies) == 0 {
+		return err
+	}
+	instance, err = withResolvedJobs(c, instance)
+	if err != nil {
+		return err
+	}
+	targets := cronHPATargets(instance)
+	if targets == nil {
+		// the invalid spec is reported by the controller
+		return nil
+	}
+	weights := make([]int32, 0, len(targets))
+	for _, t := range targets {
+		weights = append(weights, t.Weight)
+	}
+
+	cronHPAs := &v1beta1.CronHorizontalPodAutoscalerList{}
+	if err := c.List(ctx, cronHPAs, client.InNamespace(instance.Namespace)); err != nil {
+		return fmt.Errorf("failed to list cronHPAs in %s namespace,because of %v", instance.Namespace, err)
+	}
+	others := make([]*v1beta1.CronHorizontalPodAutoscaler, 0)
+	for _, other := range resolvedCronHPAs(c, cronHPAs.Items) {
+		if other.Name != instance.Name {
+			others = append(others, other)
+		}
+	}
+
+	labelsOf := make(map[string]labels.Set)
+	for _, p := range policies {
+		spec := p.Spec
+		for _, job := range instance.Spec.Jobs {
+			if !isScaleAction(job.Action) || job.TargetSizeExpr != "" || job.TargetSizeFrom != nil {
+				continue
+			}
+			for i, size := range splitTargetSize(job.TargetSize, weights) {
+				ref := targets[i].TargetRef
+				if spec.MaxReplicasPerTarget != nil && size > *spec.MaxReplicasPerTarget {
+					return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("job %s scales %s %s to %d, more than maxReplicasPerTarget %d", job.Name, ref.RefKind, ref.RefName, size, *spec.MaxReplicasPerTarget)}
+				}
+				// the targets in remote clusters are checked at fire time
+				if spec.CriticalWorkloadSelector == nil || size != 0 || ref.Cluster != "" || ref.RefKind == externalKind {
+					continue
+				}
+				set, ok := labelsOf[targetKey(ref)]
+				if !ok {
+					mapping, err := mapper.RESTMapping(schema.GroupKind{Group: ref.RefGroup, Kind: ref.RefKind}, ref.RefVersion)
+					if err != nil {
+						return fmt.Errorf("failed to find resource of %s %s,because of %v", ref.RefKind, ref.RefName, err)
+					}
+					set, err = targetLabels(dynamicClient.Resource(mapping.Resource), ref)
+					if err != nil {
+						return err
+					}
+					labelsOf[targetKey(ref)] = set
+				}
+				critical, err := isCritical(p, set)
+				if err != nil {
+					return err
+				}
+				if critical {
+					return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("job %s scales %s %s to 0, which is a critical workload", job.Name, ref.RefKind, ref.RefName)}
+				}
+			}
+		}
+
+		if spec.MaxReplicasPerNamespace != nil {
+			total := peakTargetSize(instance)
+			for _, other := range others {
+				total += peakTargetSize(other)
+			}
+			if total > *spec.MaxReplicasPerNamespace {
+				return &PolicyViolation{Policy: p.Name, Reason: fmt.Sprintf("the largest target sizes of the cronHPAs in %s namespace sum up to %d, more than maxReplicasPerNamespace %d", instance.Namespace, total, *spec.MaxReplicasPerNamespace)}
+			}
+		}
+
+		if spec.MinJobIntervalSeconds != nil {
+			interval := time.Duration(*spec.MinJobIntervalSeconds) * time.Second
+			for _, t := range targets {
+				if err := checkJobInterval(p.Name, interval, instance, others, t.TargetRef); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkJobInterval checks the fire times of the jobs of the cronHPAs on the same target in the next week.
+func checkJobInterval(policy string, interval time.Duration, instance *v1beta1.CronHorizontalPodAutoscaler, others []*v1beta1.CronHorizontalPodAutoscaler, ref *TargetRef) error {
+	now := time.Now()
+	fires := make([]jobFire, 0)
+	for _, cronHPA := range append([]*v1beta1.CronHorizontalPodAutoscaler{instance}, others...) {
+		if cronHPA != instance && !targetsContain(cronHPATargets(cronHPA), ref) {
+			continue
+		}
+		for _, job := range cronHPA.Spec.Jobs {
+			schedule, err := cron.Parse(job.Schedule)
+			if err != nil {
+				continue
+			}
+			name := fmt.Sprintf("%s/%s", cronHPA.Name, job.Name)
+			next := now
+			for i := 0; i < maxPolicyFiresPerJob; i++ {
+				next = schedule.Next(next)
+				if next.IsZero() || next.Sub(now) > policyScheduleWindow {
+					break
+				}
+				fires = append(fires, jobFire{at: next, job: name})
+			}
+		}
+	}
+	sort.SliceStable(fires, func(i, j int) bool {
+		return fires[i].at.Before(fires[j].at)
+	})
+	for i := 1; i < len(fires); i++ {
+		if d := fires[i].at.Sub(fires[i-1].at); d < interval {
+			return &PolicyViolation{Policy: policy, Reason: fmt.Sprintf("jobs %s and %s on %s %s run %v apart at %s, less than minJobIntervalSeconds %d",
+				fires[i-1].job, fires[i].job, ref.RefKind, ref.RefName, d, fires[i].at.Format(time.RFC3339), int64(interval/time.Second))}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"testing"
+	"time"
+)
+
+// objectClient is a client which gets and lists its objects regardless of the namespace, the other calls panic.
+type objectClient struct {
+	client.Client
+	objects []runtime.Object
+}
+
+func (c *objectClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	for _, o := range c.objects {
+		accessor, _ := apimeta.Accessor(o)
+		if reflect.TypeOf(o) == reflect.TypeOf(obj) && accessor.GetName() == key.Name && accessor.GetNamespace() == key.Namespace {
+			reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(o.DeepCopyObject()).Elem())
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *objectClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	items := make([]runtime.Object, 0)
+	for _, o := range c.objects {
+		switch list.(type) {
+		case *v1beta1.CronHPAPolicyList:
+			if _, ok := o.(*v1beta1.CronHPAPolicy); ok {
+				items = append(items, o.DeepCopyObject())
+			}
+		case *v1beta1.CronHorizontalPodAutoscalerList:
+			if _, ok := o.(*v1beta1.CronHorizontalPodAutoscaler); ok {
+				items = append(items, o.DeepCopyObject())
+			}
+		}
+	}
+	return apimeta.SetList(list, items)
+}
+
+// testCronHPA returns a cronHPA on the Deployment with a job for every schedule.
+func testCronHPA(name, deployment string, schedules ...string) *v1beta1.CronHorizontalPodAutoscaler {
+	instance := &v1beta1.CronHorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1beta1.CronHorizontalPodAutoscalerSpec{
+			ScaleTargetRef: v1beta1.ScaleTargetRef{ApiVersion: "apps/v1", Kind: "Deployment", Name: deployment},
+		},
+	}
+	for i, schedule := range schedules {
+		instance.Spec.Jobs = append(instance.Spec.Jobs, v1beta1.Job{Name: fmt.Sprintf("job-%d", i), Schedule: schedule, TargetSize: 1})
+	}
+	return instance
+}
+
+func TestCheckJobInterval(t *testing.T) {
+	ref := &TargetRef{RefName: "web", RefNamespace: "default", RefKind: "Deployment", RefGroup: "apps", RefVersion: "v1"}
+	cases := []struct {
+		name      string
+		instance  *v1beta1.CronHorizontalPodAutoscaler
+		others    []*v1beta1.CronHorizontalPodAutoscaler
+		violation bool
+	}{
+		{name: "apart", instance: testCronHPA("web", "web", "0 0 9 * * *", "0 30 9 * * *")},
+		{name: "jobs of the cronHPA too close", instance: testCronHPA("web", "web", "0 0 9 * * *", "0 5 9 * * *"), violation: true},
+		{name: "job too frequent", instance: testCronHPA("web", "web", "0 */5 * * * *"), violation: true},
+		{
+			name:      "job of another cronHPA on the target",
+			instance:  testCronHPA("web", "web", "0 0 9 * * *"),
+			others:    []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web-peak", "web", "0 3 9 * * *")},
+			violation: true,
+		},
+		{
+			name:     "job of another cronHPA on another target",
+			instance: testCronHPA("web", "web", "0 0 9 * * *"),
+			others:   []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("api", "api", "0 3 9 * * *")},
+		},
+	}
+	for _, c := range cases {
+		err := checkJobInterval("interval", 10*time.Minute, c.instance, c.others, ref)
+		if c.violation {
+			if _, ok := err.(*PolicyViolation); !ok {
+				t.Errorf("%s: expected violation, got %v", c.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestRecentJobFire(t *testing.T) {
+	ref := &TargetRef{RefName: "web", RefNamespace: "default", RefKind: "Deployment", RefGroup: "apps", RefVersion: "v1"}
+	at := func(h, m, s int) time.Time {
+		return time.Date(2026, 10, 19, h, m, s, 0, time.Local)
+	}
+	cases := []struct {
+		name      string
+		cronHPAs  []*v1beta1.CronHorizontalPodAutoscaler
+		now       time.Time
+		selfUntil time.Time
+		job       string
+	}{
+		{
+			name:     "current run of the job",
+			cronHPAs: []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 0 9 * * *")},
+			now:      at(9, 0, 10),
+		},
+		{
+			name:     "previous run of the job",
+			cronHPAs: []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 */2 * * * *")},
+			now:      at(9, 0, 10),
+			job:      "web/job-0",
+		},
+		{
+			name:     "job of another cronHPA",
+			cronHPAs: []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 0 9 * * *"), testCronHPA("web-peak", "web", "0 55 8 * * *")},
+			now:      at(9, 0, 10),
+			job:      "web-peak/job-0",
+		},
+		{
+			name:     "job out of the interval",
+			cronHPAs: []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 0 9 * * *"), testCronHPA("web-peak", "web", "0 45 8 * * *")},
+			now:      at(9, 0, 10),
+		},
+		{
+			name:     "job on another target",
+			cronHPAs: []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 0 9 * * *"), testCronHPA("api", "api", "0 55 8 * * *")},
+			now:      at(9, 0, 10),
+		},
+		{
+			name:      "job running before its schedule",
+			cronHPAs:  []*v1beta1.CronHorizontalPodAutoscaler{testCronHPA("web", "web", "0 0,50 8,9 * * *")},
+			now:       at(8, 58, 0),
+			selfUntil: at(9, 0, 0),
+			job:       "web/job-0",
+		},
+	}
+	for _, c := range cases {
+		selfUntil := c.selfUntil
+		if selfUntil.IsZero() {
+			selfUntil = c.now
+		}
+		last, found := recentJobFire(c.cronHPAs, "web", "job-0", ref, 10*time.Minute, c.now, selfUntil)
+		if found != (c.job != "") || (found && last.job != c.job) {
+			t.Errorf("%s: expected job %q, got %q found %v", c.name, c.job, last.job, found)
+		}
+	}
+}
+
+// profileCronHPA returns a cronHPA on the Deployment with the jobs of the business-hours profile.
+func profileCronHPA(name, deployment string) *v1beta1.CronHorizontalPodAutoscaler {
+	instance := testCronHPA(name, deployment)
+	instance.Spec.ProfileRef = &v1beta1.ProfileRef{Name: "business-hours"}
+	return instance
+}
+
+func TestCheckPoliciesProfile(t *testing.T) {
+	limit := func(n int32) *int32 {
+		return &n
+	}
+	cases := []struct {
+		name      string
+		policy    v1beta1.CronHPAPolicySpec
+		instance  *v1beta1.CronHorizontalPodAutoscaler
+		others    []*v1beta1.CronHorizontalPodAutoscaler
+		violation bool
+	}{
+		{
+			name:      "maxReplicasPerTarget of the profile jobs",
+			policy:    v1beta1.CronHPAPolicySpec{MaxReplicasPerTarget: limit(5)},
+			instance:  profileCronHPA("web", "web"),
+			violation: true,
+		},
+		{
+			name:     "profile jobs within maxReplicasPerTarget",
+			policy:   v1beta1.CronHPAPolicySpec{MaxReplicasPerTarget: limit(10)},
+			instance: profileCronHPA("web", "web"),
+		},
+		{
+			name:      "maxReplicasPerNamespace with the profile jobs of another cronHPA",
+			policy:    v1beta1.CronHPAPolicySpec{MaxReplicasPerNamespace: limit(10)},
+			instance:  testCronHPA("api", "api", "0 0 9 * * *"),
+			others:    []*v1beta1.CronHorizontalPodAutoscaler{profileCronHPA("web", "web")},
+			violation: true,
+		},
+		{
+			name:      "minJobIntervalSeconds with the profile jobs of another cronHPA",
+			policy:    v1beta1.CronHPAPolicySpec{MinJobIntervalSeconds: limit(600)},
+			instance:  testCronHPA("web-peak", "web", "0 5 9 * * *"),
+			others:    []*v1beta1.CronHorizontalPodAutoscaler{profileCronHPA("web", "web")},
+			violation: true,
+		},
+	}
+	for _, c := range cases {
+		profile := testProfile()
+		profile.Namespace = "default"
+		objects := []runtime.Object{
+			profile,
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			&v1beta1.CronHPAPolicy{ObjectMeta: metav1.ObjectMeta{Name: "guardrails"}, Spec: c.policy},
+		}
+		for _, other := range c.others {
+			objects = append(objects, other)
+		}
+		err := CheckPolicies(context.Background(), &objectClient{objects: objects}, nil, nil, c.instance)
+		if c.violation {
+			if !isPolicyViolation(err) {
+				t.Errorf("%s: expected violation, got %v", c.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"strings"
+)
+
+const (
+	preflightPassed  = "Passed"
+	preflightWarned  = "Warned"
+	preflightCapped  = "Capped"
+	preflightAborted = "Aborted"
+	preflightSkipped = "Skipped"
+)
+
+var (
+	nodeResource          = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	podResource           = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	resourceQuotaResource = schema.GroupVersionResource{Version: "v1", Resource: "resourcequotas"}
+)
+
+func checkPreflightPolicy(policy *v1beta1.PreflightPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch policy.Action {
+	case "", v1beta1.PreflightWarn, v1beta1.PreflightCap, v1beta1.PreflightAbort:
+		return nil
+	}
+	return fmt.Errorf("unknown preflight action %s", policy.Action)
+}
+
+// preflight checks the extra pods of a scale-up fit into the ResourceQuotas of the namespace and the free
+// capacity of the schedulable nodes, and returns the size to scale to. A failed check doesn't stop the scaling.
+func (ch *CronJobHPA) preflight(ref *TargetRef, size int32) (int32, string, error) {
+	if ch.preflightPolicy == nil || ref.RefKind == externalKind {
+		return size, "", nil
+	}
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	current, err := env.currentReplicas()
+	if err != nil {
+		log.Warningf("Skip preflight of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return size, "", nil
+	}
+	if size <= current {
+		return size, "", nil
+	}
+
+	status := v1beta1.PreflightStatus{
+		ScaleTargetRef:    scaleTargetRefOf(ref),
+		CurrentReplicas:   current,
+		RequestedReplicas: size,
+		AllowedReplicas:   size,
+	}
+	if err := ch.checkCapacity(env, &status); err != nil {
+		log.Warningf("Skip preflight of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		status.Decision = preflightSkipped
+		status.Message = err.Error()
+		ch.recordPreflight(status)
+		return size, "", nil
+	}
+
+	if status.AllowedReplicas >= size {
+		status.Decision = preflightPassed
+		ch.recordPreflight(status)
+		return size, "", nil
+	}
+	msg := fmt.Sprintf("preflight: only %d of %d replicas of %s %s fit, %s.", status.AllowedReplicas, size, ref.RefKind, ref.RefName, status.Message)
+	switch ch.preflightPolicy.Action {
+	case v1beta1.PreflightCap:
+		status.Decision = preflightCapped
+		ch.recordPreflight(status)
+		return status.AllowedReplicas, msg + fmt.Sprintf(" capped to %d.", status.AllowedReplicas), nil
+	case v1beta1.PreflightAbort:
+		status.Decision = preflightAborted
+		ch.recordPreflight(status)
+		return size, "", errors.New(msg + " aborted")
+	default:
+		status.Decision = preflightWarned
+		ch.recordPreflight(status)
+		return size, msg, nil
+	}
+}
+
+// checkCapacity computes the replicas of the target which fit into the quotas and the nodes.
+func (ch *CronJobHPA) checkCapacity(env *targetSizeEnv, status *v1beta1.PreflightStatus) error {
+	ref := env.ref
+	template, err := ch.podTemplateOf(env)
+	if err != nil {
+		return err
+	}
+	requests, limits := podRequests(&template.Spec)
+	extra := status.RequestedReplicas - status.CurrentReplicas
+	extraCPU, extraMemory := requests.Cpu().DeepCopy(), requests.Memory().DeepCopy()
+	extraCPU.SetMilli(extraCPU.MilliValue() * int64(extra))
+	extraMemory.Set(extraMemory.Value() * int64(extra))
+	status.ExtraCPU, status.ExtraMemory = extraCPU.String(), extraMemory.String()
+
+	// the capacity is read with the identity of the controller, even if the jobs impersonate a ServiceAccount
+	dynamicClient := ch.dynamicClient
+	if ref.Cluster != "" {
+		clients, err := ch.clientsOf(ref)
+		if err != nil {
+			return err
+		}
+		dynamicClient = clients.dynamicClient
+	}
+
+	allowed := extra
+	details := make([]string, 0)
+	quotaAllows, err := quotaAllows(dynamicClient, ref.RefNamespace, &template.Spec, requests, limits)
+	if err != nil {
+		return err
+	}
+	if quotaAllows != nil {
+		status.QuotaAllows = quotaAllows
+		details = append(details, fmt.Sprintf("quota allows %d more pods", *quotaAllows))
+		if *quotaAllows < allowed {
+			allowed = *quotaAllows
+		}
+	}
+	if !ch.preflightPolicy.SkipNodeCapacity {
+		capacityKey := ""
+		if ref.Cluster != "" {
+			capacityKey = ch.HPARef.Namespace + "/" + ref.Cluster + "/" + ref.ClusterKey
+		}
+		nodes, pods, err := ch.capacity.Get(capacityKey, dynamicClient)
+		if err != nil {
+			return err
+		}
+		// the balloon pods of the job give their capacity to the pods of the scale-up
+		nodesAllow, err := nodesAllow(nodes, pods, &template.Spec, requests, ch.ownsBalloon)
+		if err != nil {
+			return err
+		}
+		status.NodesAllow = &nodesAllow
+		details = append(details, fmt.Sprintf("nodes allow %d more pods", nodesAllow))
+		if nodesAllow < allowed {
+			allowed = nodesAllow
+		}
+	}
+	status.AllowedReplicas = status.CurrentReplicas + allowed
+	status.Message = fmt.Sprintf("%d extra pods request cpu %s and memory %s, %s", extra, status.ExtraCPU, status.ExtraMemory, strings.Join(details, " and "))
+	return nil
+}
+
+// workloadOf returns the workload scaled by the target, which is the target itself unless it's a HPA or a KEDA ScaledObject.
+func (ch *CronJobHPA) workloadOf(env *targetSizeEnv) (*TargetRef, error) {
+	ref := env.ref
+	workload := ref
+	switch {
+	case ref.RefKind == "HorizontalPodAutoscaler":
+		hpa, err := env.getHPA()
+		if err != nil {
+			return nil, err
+		}
+		target := hpa.Spec.ScaleTargetRef
+		workload, err = newTargetRef(v1beta1.ScaleTargetRef{ApiVersion: target.APIVersion, Kind: target.Kind, Name: target.Name}, ref.RefNamespace)
+		if err != nil {
+			return nil, err
+		}
+		workload.Cluster, workload.ClusterKey = ref.Cluster, ref.ClusterKey
+	case isKEDAScaledObject(ref):
+		obj, err := env.getObject()
+		if err != nil {
+			return nil, err
+		}
+		workload, err = kedaScaleTargetRef(obj, ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return workload, nil
+}
+
+// podTemplateOf returns the pod template of the workload scaled by the target.
+func (ch *CronJobHPA) podTemplateOf(env *targetSizeEnv) (*v1.PodTemplateSpec, error) {
+	workload, err := ch.workloadOf(env)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := ch.resourceOf(workload)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := resource.Get(context.Background(), workload.RefName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s in %s namespace,because of %v", workload.RefKind, workload.RefName, workload.RefNamespace, err)
+	}
+	data, found, err := unstructured.NestedMap(obj.Object, "spec", "template")
+	if err != nil || !found {
+		return nil, fmt.Errorf("pod template of %s %s is not found", workload.RefKind, workload.RefName)
+	}
+	template := &v1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(data, template); err != nil {
+		return nil, fmt.Errorf("invalid pod template of %s %s,because of %v", workload.RefKind, workload.RefName, err)
+	}
+	return template, nil
+}
+
+// podRequests returns the requests and limits of a pod, the larger one of the containers and any init container.
+func podRequests(spec *v1.PodSpec) (v1.ResourceList, v1.ResourceList) {
+	requests, limits := v1.ResourceList{}, v1.ResourceList{}
+	for _, c := range spec.Containers {
+		addResources(requests, c.Resources.Requests)
+		addResources(limits, c.Resources.Limits)
+	}
+	for _, c := range spec.InitContainers {
+		maxResources(requests, c.Resources.Requests)
+		maxResources(limits, c.Resources.Limits)
+	}
+	addResources(requests, spec.Overhead)
+	addResources(limits, spec.Overhead)
+	return requests, limits
+}
+
+func addResources(list, add v1.ResourceList) {
+	for name, q := range add {
+		if v, ok := list[name]; ok {
+			v.Add(q)
+			list[name] = v
+		} else {
+			list[name] = q.DeepCopy()
+		}
+	}
+}
+
+func maxResources(list, other v1.ResourceList) {
+	for name, q := range other {
+		if v, ok := list[name]; !ok || q.Cmp(v) > 0 {
+			list[name] = q.DeepCopy()
+		}
+	}
+}
+
+// fits returns how many times the usage fits into the free quantity.
+func fits(free, usage resource.Quantity) int32 {
+	if usage.MilliValue() <= 0 {
+		return -1
+	}
+	n := free.MilliValue() / usage.MilliValue()
+	if n < 0 {
+		return 0
+	}
+	if n > int64(^uint32(0)>>1) {
+		return int32(^uint32(0) >> 1)
+	}
+	return int32(n)
+}
+
+// quotaAllows returns the pods allowed by the ResourceQuotas of the namespace whose scopes match the pod,
+// nil if there is no such quota.
+func quotaAllows(dynamicClient dynamic.Interface, namespace string, spec *v1.PodSpec, requests, limits v1.ResourceList) (*int32, error) {
+	list, err := dynamicClient.Resource(resourceQuotaResource).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resourcequotas in %s namespace,because of %v", namespace, err)
+	}
+	perPod := v1.ResourceList{
+		v1.ResourcePods:           resource.MustParse("1"),
+		v1.ResourceCPU:            *requests.Cpu(),
+		v1.ResourceRequestsCPU:    *requests.Cpu(),
+		v1.ResourceMemory:         *requests.Memory(),
+		v1.ResourceRequestsMemory: *requests.Memory(),
+		v1.ResourceLimitsCPU:      *limits.Cpu(),
+		v1.ResourceLimitsMemory:   *limits.Memory(),
+	}
+	var allowed *int32
+	for _, item := range list.Items {
+		quota := &v1.ResourceQuota{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, quota); err != nil {
+			return nil, err
+		}
+		if !quotaMatches(quota, spec) {
+			continue
+		}
+		for name, hard := range quota.Status.Hard {
+			usage, ok := perPod[name]
+			if !ok {
+				continue
+			}
+			free := hard.DeepCopy()
+			free.Sub(quota.Status.Used[name])
+			n := fits(free, usage)
+			if n >= 0 && (allowed == nil || n < *allowed) {
+				allowed = &n
+			}
+		}
+	}
+	return allowed, nil
+}
+
+// quotaMatches returns whether the pod is counted by the quota, which is the case if it matches all the scopes of the quota.
+func quotaMatches(quota *v1.ResourceQuota, spec *v1.PodSpec) bool {
+	requirements := make([]v1.ScopedResourceSelectorRequirement, 0)
+	for _, scope := range quota.Spec.Scopes {
+		requirements = append(requirements, v1.ScopedResourceSelectorRequirement{ScopeName: scope, Operator: v1.ScopeSelectorOpExists})
+	}
+	if quota.Spec.ScopeSelector != nil {
+		requirements = append(requirements, quota.Spec.ScopeSelector.MatchExpressions...)
+	}
+	for _, requirement := range requirements {
+		if !scopeMatches(requirement, spec) {
+			return false
+		}
+	}
+	return true
+}
+
+func scopeMatches(requirement v1.ScopedResourceSelectorRequirement, spec *v1.PodSpec) bool {
+	switch requirement.ScopeName {
+	case v1.ResourceQuotaScopeTerminating:
+		return spec.ActiveDeadlineSeconds != nil
+	case v1.ResourceQuotaScopeNotTerminating:
+		return spec.ActiveDeadlineSeconds == nil
+	case v1.ResourceQuotaScopeBestEffort:
+		return podBestEffort(spec)
+	case v1.ResourceQuotaScopeNotBestEffort:
+		return !podBestEffort(spec)
+	case v1.ResourceQuotaScopePriorityClass:
+		switch requirement.Operator {
+		case v1.ScopeSelectorOpIn:
+			return containsString(requirement.Values, spec.PriorityClassName)
+		case v1.ScopeSelectorOpNotIn:
+			return !containsString(requirement.Values, spec.PriorityClassName)
+		case v1.ScopeSelectorOpExists:
+			return spec.PriorityClassName != ""
+		case v1.ScopeSelectorOpDoesNotExist:
+			return spec.PriorityClassName == ""
+		}
+	}
+	// the quotas with unknown scopes are considered to count the pod
+	return true
+}
+
+// podBestEffort returns whether the pod is of the BestEffort QoS class, no container requests or limits cpu or memory.
+func podBestEffort(spec *v1.PodSpec) bool {
+	containers := append(append([]v1.Container{}, spec.Containers...), spec.InitContainers...)
+	for _, c := range containers {
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			if q, ok := c.Resources.Requests[name]; ok && !q.IsZero() {
+				return false
+			}
+			if q, ok := c.Resources.Limits[name]; ok && !q.IsZero() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// nodesAllow returns the pods fitting into the free capacity of the schedulable nodes matching the nodeSelector,
+// the required node affinity and the tolerations of the pod. The pods excluded don't use the capacity of their nodes.
+func nodesAllow(nodes, pods []*unstructured.Unstructured, spec *v1.PodSpec, requests v1.ResourceList, excluded func(pod *v1.Pod) bool) (int32, error) {
+	used := make(map[string]v1.ResourceList)
+	for _, item := range pods {
+		nodeName, _, _ := unstructured.NestedString(item.Object, "spec", "nodeName")
+		if nodeName == "" {
+			continue
+		}
+		pod := &v1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, pod); err != nil {
+			return 0, err
+		}
+		if excluded != nil && excluded(pod) {
+			continue
+		}
+		podRequested, _ := podRequests(&pod.Spec)
+		podRequested[v1.ResourcePods] = resource.MustParse("1")
+		if _, ok := used[nodeName]; !ok {
+			used[nodeName] = v1.ResourceList{}
+		}
+		addResources(used[nodeName], podRequested)
+	}
+
+	var allowed int32
+	for _, item := range nodes {
+		node := &v1.Node{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, node); err != nil {
+			return 0, err
+		}
+		if !nodeSchedulable(node, spec) || !nodeMatches(node, spec) {
+			continue
+		}
+		n := int32(-1)
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourcePods} {
+			usage := requests[name]
+			if name == v1.ResourcePods {
+				usage = resource.MustParse("1")
+			}
+			free := node.Status.Allocatable[name].DeepCopy()
+			free.Sub(used[node.Name][name])
+			if f := fits(free, usage); f >= 0 && (n < 0 || f < n) {
+				n = f
+			}
+		}
+		if n > 0 {
+			allowed += n
+		}
+	}
+	return allowed, nil
+}
+
+// nodeMatches returns whether the node matches the nodeSelector and one of the terms of the required node affinity of the pod.
+func nodeMatches(node *v1.Node, spec *v1.PodSpec) bool {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	affinity := spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		// an empty term matches no node
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		matchLabels, err := nodeSelectorOf(term.MatchExpressions)
+		if err != nil {
+			continue
+		}
+		// metadata.name is the only field supported by matchFields
+		matchFields, err := nodeSelectorOf(term.MatchFields)
+		if err != nil {
+			continue
+		}
+		if matchLabels.Matches(labels.Set(node.Labels)) && matchFields.Matches(labels.Set{"metadata.name": node.Name}) {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeSelectorOf(requirements []v1.NodeSelectorRequirement) (labels.Selector, error) {
+	selector := labels.NewSelector()
+	for _, r := range requirements {
+		var op selection.Operator
+		switch r.Operator {
+		case v1.NodeSelectorOpIn:
+			op = selection.In
+		case v1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case v1.NodeSelectorOpExists:
+			op = selection.Exists
+		case v1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case v1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case v1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return nil, fmt.Errorf("unknown node selector operator %s", r.Operator)
+		}
+		requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*requirement)
+	}
+	return selector, nil
+}
+
+func nodeSchedulable(node *v1.Node, spec *v1.PodSpec) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	ready := false
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady && c.Status == v1.ConditionTrue {
+			ready = true
+		}
+	}
+	if !ready {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range spec.Tolerations {
+			if spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+func (ch *CronJobHPA) recordPreflight(status v1beta1.PreflightStatus) {
+	ch.Lock()
+	defer ch.Unlock()
+	ch.preflights = append(ch.preflights, status)
+}
+
+// PreflightStatus returns the preflight of the scale-ups of the last execution.
+func (ch *CronJobHPA) PreflightStatus() []v1beta1.PreflightStatus {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.preflights
+}
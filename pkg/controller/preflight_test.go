@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"testing"
+)
+
+// listClient is a dynamic client which only lists the objects of its resources, the other calls panic.
+type listClient struct {
+	dynamic.Interface
+	items map[string][]unstructured.Unstructured
+}
+
+func (c *listClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &listResource{items: c.items[gvr.Resource]}
+}
+
+type listResource struct {
+	dynamic.NamespaceableResourceInterface
+	items []unstructured.Unstructured
+}
+
+func (r *listResource) Namespace(string) dynamic.ResourceInterface {
+	return r
+}
+
+func (r *listResource) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return &unstructured.UnstructuredList{Items: r.items}, nil
+}
+
+func TestFits(t *testing.T) {
+	cases := []struct {
+		name  string
+		free  string
+		usage string
+		n     int32
+	}{
+		{name: "cpu", free: "1", usage: "250m", n: 4},
+		{name: "rounds down", free: "1Gi", usage: "300Mi", n: 3},
+		{name: "no usage", free: "1", usage: "0", n: -1},
+		{name: "overused", free: "-1", usage: "100m", n: 0},
+		{name: "too many", free: "1P", usage: "1m", n: int32(^uint32(0) >> 1)},
+	}
+	for _, c := range cases {
+		if n := fits(resource.MustParse(c.free), resource.MustParse(c.usage)); n != c.n {
+			t.Errorf("%s: expected %d, got %d", c.name, c.n, n)
+		}
+	}
+}
+
+func TestQuotaAllows(t *testing.T) {
+	requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("512Mi")}
+	limits := v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}
+	cases := []struct {
+		name          string
+		quotas        []string
+		spec          string
+		priorityClass string
+		allowed       int32
+		none          bool
+	}{
+		{name: "no quota", none: true},
+		{name: "pods", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`}, allowed: 3},
+		{name: "requests", quotas: []string{`{"hard":{"requests.cpu":"4","memory":"8Gi"},"used":{"requests.cpu":"3","memory":"6Gi"}}`}, allowed: 4},
+		{name: "limits", quotas: []string{`{"hard":{"limits.cpu":"4"},"used":{"limits.cpu":"3"}}`}, allowed: 2},
+		{name: "smallest of the quotas", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"2"}}`, `{"hard":{"cpu":"2"},"used":{"cpu":"1"}}`}, allowed: 4},
+		{name: "overused", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"12"}}`}, allowed: 0},
+		{name: "unlimited resources", quotas: []string{`{"hard":{"limits.memory":"1Gi","services":"1"},"used":{"services":"1"}}`}, none: true},
+		{name: "scopes matching", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`}, spec: `{"scopes":["NotBestEffort","NotTerminating"]}`, allowed: 3},
+		{name: "best effort scope", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`}, spec: `{"scopes":["BestEffort"]}`, none: true},
+		{name: "terminating scope", quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`}, spec: `{"scopes":["Terminating"]}`, none: true},
+		{
+			name:   "other priority class",
+			quotas: []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`},
+			spec:   `{"scopeSelector":{"matchExpressions":[{"scopeName":"PriorityClass","operator":"In","values":["high"]}]}}`,
+			none:   true,
+		},
+		{
+			name:          "priority class",
+			quotas:        []string{`{"hard":{"pods":"10"},"used":{"pods":"7"}}`},
+			spec:          `{"scopeSelector":{"matchExpressions":[{"scopeName":"PriorityClass","operator":"In","values":["high"]}]}}`,
+			priorityClass: "high",
+			allowed:       3,
+		},
+	}
+	for _, c := range cases {
+		spec := c.spec
+		if spec == "" {
+			spec = "{}"
+		}
+		items := make([]unstructured.Unstructured, 0)
+		for _, status := range c.quotas {
+			items = append(items, *unstructuredOf(t, `{"metadata":{"name":"quota"},"spec":`+spec+`,"status":`+status+`}`))
+		}
+		pod := &v1.PodSpec{
+			PriorityClassName: c.priorityClass,
+			Containers:        []v1.Container{{Name: "app", Resources: v1.ResourceRequirements{Requests: requests, Limits: limits}}},
+		}
+		allowed, err := quotaAllows(&listClient{items: map[string][]unstructured.Unstructured{"resourcequotas": items}}, "default", pod, requests, limits)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if c.none {
+			if allowed != nil {
+				t.Errorf("%s: expected no limit, got %d", c.name, *allowed)
+			}
+			continue
+		}
+		if allowed == nil || *allowed != c.allowed {
+			t.Errorf("%s: expected %d, got %v", c.name, c.allowed, allowed)
+		}
+	}
+}
+
+func TestNodesAllow(t *testing.T) {
+	requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")}
+	node := func(name, labels string) *unstructured.Unstructured {
+		return unstructuredOf(t, `{"metadata":{"name":"`+name+`","labels":`+labels+`},
+			"status":{"allocatable":{"cpu":"4","memory":"8Gi","pods":"110"},"conditions":[{"type":"Ready","status":"True"}]}}`)
+	}
+	nodes := []*unstructured.Unstructured{
+		node("node-a", `{"zone":"a","gpu":"true"}`),
+		node("node-b", `{"zone":"b"}`),
+	}
+	pod := func(node, annotations string) *unstructured.Unstructured {
+		return unstructuredOf(t, `{"metadata":{"name":"pod","labels":{"`+BalloonLabel+`":"uid"},"annotations":`+annotations+`},
+			"spec":{"nodeName":"`+node+`","containers":[{"name":"app","resources":{"requests":{"cpu":"2"}}}]}}`)
+	}
+	job := &CronJobHPA{name: "scale-up", HPARef: &v1beta1.CronHorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{UID: "uid"}}}
+	cases := []struct {
+		name    string
+		spec    string
+		pods    []*unstructured.Unstructured
+		allowed int32
+	}{
+		{name: "all nodes", spec: `{}`, allowed: 8},
+		{name: "used capacity", spec: `{}`, pods: []*unstructured.Unstructured{pod("node-a", `{}`)}, allowed: 6},
+		{name: "balloon of the job", spec: `{}`, pods: []*unstructured.Unstructured{pod("node-a", `{"`+BalloonJobAnnotation+`":"scale-up"}`)}, allowed: 8},
+		{name: "balloon of another job", spec: `{}`, pods: []*unstructured.Unstructured{pod("node-a", `{"`+BalloonJobAnnotation+`":"other"}`)}, allowed: 6},
+		{name: "node selector", spec: `{"nodeSelector":{"zone":"b"}}`, allowed: 4},
+		{
+			name:    "required node affinity",
+			spec:    `{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"gpu","operator":"Exists"}]}]}}}}`,
+			allowed: 4,
+		},
+		{
+			name:    "one of the terms",
+			spec:    `{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"zone","operator":"In","values":["c"]}]},{"matchFields":[{"key":"metadata.name","operator":"In","values":["node-b"]}]}]}}}}`,
+			allowed: 4,
+		},
+		{
+			name:    "no node matching",
+			spec:    `{"affinity":{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"zone","operator":"NotIn","values":["a","b"]}]}]}}}}`,
+			allowed: 0,
+		},
+		{
+			name:    "preferred node affinity",
+			spec:    `{"affinity":{"nodeAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":[{"weight":1,"preference":{"matchExpressions":[{"key":"gpu","operator":"Exists"}]}}]}}}`,
+			allowed: 8,
+		},
+	}
+	for _, c := range cases {
+		spec := &v1.PodSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredOf(t, c.spec).Object, spec); err != nil {
+			t.Fatalf("%s: invalid pod spec %v", c.name, err)
+		}
+		allowed, err := nodesAllow(nodes, c.pods, spec, requests, job.ownsBalloon)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if allowed != c.allowed {
+			t.Errorf("%s: expected %d, got %d", c.name, c.allowed, allowed)
+		}
+	}
+}
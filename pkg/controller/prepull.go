@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"hash/fnv"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"time"
+)
+
+const (
+	// uid of the cronHPA owning the pre-pull DaemonSet.
+	PrepullLabel = "cronhpa.alibabacloud.com/prepull"
+	// hash of the name of the job the DaemonSet is created for.
+	PrepullJobLabel = "cronhpa.alibabacloud.com/prepull-job"
+
+	// image whose busybox binary keeps the pullers running, it's not configurable since the DaemonSet runs on
+	// every candidate node.
+	prepullHelperImage = "busybox:1.36"
+	prepullBinDir      = "/prepull"
+)
+
+var daemonSetResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
+
+func checkPrepull(job v1beta1.Job, distribution []*WeightedTargetRef, external *v1beta1.ExternalTarget) error {
+	if job.PrepullImages == nil {
+		return nil
+	}
+	if !isScaleAction(job.Action) || distribution != nil || external != nil {
+		return fmt.Errorf("prepullImages of job %s could not be used with distribution, external or actions other than scale", job.Name)
+	}
+	if job.PrepullImages.LeadSeconds <= 0 {
+		return fmt.Errorf("leadSeconds of prepullImages of job %s should be positive", job.Name)
+	}
+	return nil
+}
+
+func (ch *CronJobHPA) prepullLabels() labels.Set {
+	h := fnv.New32a()
+	h.Write([]byte(ch.name))
+	return labels.Set{PrepullLabel: string(ch.HPARef.UID), PrepullJobLabel: fmt.Sprintf("%08x", h.Sum32())}
+}
+
+// prepullDue returns whether the images of the job firing at next should be pulled now.
+func (ch *CronJobHPA) prepullDue(next time.Time) bool {
+	if ch.prepull == nil || next.IsZero() {
+		return false
+	}
+	left := time.Until(next)
+	if left <= 0 || left > time.Duration(ch.prepull.LeadSeconds)*time.Second {
+		return false
+	}
+	ch.Lock()
+	defer ch.Unlock()
+	return !ch.prepulledFor.Equal(next)
+}
+
+// startPrepull creates the DaemonSet pulling the images of the job firing at next.
+func (ch *CronJobHPA) startPrepull(next time.Time) error {
+	ch.Lock()
+	ch.prepulledFor = next
+	ch.Unlock()
+	if skip, _ := IsTodayOff(ch.excludeDates); skip {
+		return nil
+	}
+	if f, err := ch.freezes.frozen(ch.HPARef.Namespace, labels.Set(ch.HPARef.Labels)); err == nil && f != nil {
+		return nil
+	}
+
+	ref := ch.TargetRef
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	template, err := ch.podTemplateOf(env)
+	if err != nil {
+		return err
+	}
+	ds, images := ch.prepullDaemonSet(&template.Spec)
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ds)
+	if err != nil {
+		return err
+	}
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return err
+	}
+	// the DaemonSet left by a previous fire time is replaced
+	ch.cleanupPrepull()
+	created, err := clients.dynamicClient.Resource(daemonSetResource).Namespace(ref.RefNamespace).Create(context.Background(), &unstructured.Unstructured{Object: data}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create prepull daemonset in %s namespace,because of %v", ref.RefNamespace, err)
+	}
+	ch.Lock()
+	ch.prepullStatus = &v1beta1.PrepullStatus{
+		DaemonSet: created.GetName(),
+		Images:    images,
+		StartTime: metav1.Time{Time: time.Now()},
+	}
+	ch.Unlock()
+	return nil
+}
+
+// prepullDaemonSet returns a DaemonSet running a container of every image of the pod template, kept running by the
+// sleep of the busybox binary copied by the helper, so the images without a shell could be pulled too.
+func (ch *CronJobHPA) prepullDaemonSet(spec *v1.PodSpec) (*appsv1.DaemonSet, []string) {
+	name := ch.HPARef.Name
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	resources := v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1m"), v1.ResourceMemory: resource.MustParse("8Mi")},
+		Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("10m"), v1.ResourceMemory: resource.MustParse("16Mi")},
+	}
+	mounts := []v1.VolumeMount{{Name: "prepull", MountPath: prepullBinDir}}
+
+	images := make([]string, 0)
+	containers := make([]v1.Container, 0)
+	seen := make(map[string]bool)
+	for _, c := range append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...) {
+		if c.Image == "" || seen[c.Image] {
+			continue
+		}
+		seen[c.Image] = true
+		images = append(images, c.Image)
+		containers = append(containers, v1.Container{
+			Name:            fmt.Sprintf("pull-%d", len(containers)),
+			Image:           c.Image,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Command:         []string{prepullBinDir + "/sleep", "2147483647"},
+			Resources:       resources,
+			VolumeMounts:    mounts,
+		})
+	}
+
+	var affinity *v1.Affinity
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		affinity = &v1.Affinity{NodeAffinity: spec.Affinity.NodeAffinity}
+	}
+	var gracePeriod int64
+	automount := false
+	selector := ch.prepullLabels()
+	ds := &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + "-prepull-",
+			Labels:       selector,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: selector},
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{{
+						Name:         "helper",
+						Image:        prepullHelperImage,
+						Command:      []string{"cp", "/bin/busybox", prepullBinDir + "/sleep"},
+						Resources:    resources,
+						VolumeMounts: mounts,
+					}},
+					Containers:                    containers,
+					Volumes:                       []v1.Volume{{Name: "prepull", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}},
+					NodeSelector:                  spec.NodeSelector,
+					Affinity:                      affinity,
+					Tolerations:                   spec.Tolerations,
+					ImagePullSecrets:              spec.ImagePullSecrets,
+					TerminationGracePeriodSeconds: &gracePeriod,
+					AutomountServiceAccountToken:  &automount,
+				},
+			},
+		},
+	}
+	// the DaemonSet is collected with the cronHPA in the same cluster
+	if ch.TargetRef.Cluster == "" {
+		ds.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: v1beta1.SchemeGroupVersion.String(),
+			Kind:       "CronHorizontalPodAutoscaler",
+			Name:       ch.HPARef.Name,
+			UID:        ch.HPARef.UID,
+		}}
+	}
+	return ds, images
+}
+
+// refreshPrepull updates the nodes which have pulled the images, it returns true if the progress changed.
+func (ch *CronJobHPA) refreshPrepull() (bool, error) {
+	ch.Lock()
+	status := ch.prepullStatus
+	ch.Unlock()
+	if status == nil || status.CleanedUp {
+		return false, nil
+	}
+	ref := ch.TargetRef
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return false, err
+	}
+	ds, err := clients.dynamicClient.Resource(daemonSetResource).Namespace(ref.RefNamespace).Get(context.Background(), status.DaemonSet, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get prepull daemonset %s in %s namespace,because of %v", status.DaemonSet, ref.RefNamespace, err)
+	}
+	desired, _, _ := unstructured.NestedInt64(ds.Object, "status", "desiredNumberScheduled")
+	pods, err := clients.dynamicClient.Resource(podResource).Namespace(ref.RefNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: ch.prepullLabels().String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list prepull pods in %s namespace,because of %v", ref.RefNamespace, err)
+	}
+	var pulled int32
+	for _, item := range pods.Items {
+		pod := &v1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, pod); err != nil {
+			return false, err
+		}
+		if imagesPulled(pod) {
+			pulled++
+		}
+	}
+
+	ch.Lock()
+	defer ch.Unlock()
+	if ch.prepullStatus != status || (status.DesiredNodes == int32(desired) && status.PulledNodes == pulled) {
+		return false, nil
+	}
+	updated := status.DeepCopy()
+	updated.DesiredNodes = int32(desired)
+	updated.PulledNodes = pulled
+	updated.Message = fmt.Sprintf("%d of %d nodes pulled %d images", pulled, desired, len(status.Images))
+	ch.prepullStatus = updated
+	return true, nil
+}
+
+// imagesPulled returns whether every container of the pod has been created, the image id is set after the pull.
+func imagesPulled(pod *v1.Pod) bool {
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.ImageID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanupPrepull deletes the pre-pull DaemonSets of the job after it runs.
+func (ch *CronJobHPA) cleanupPrepull() {
+	if ch.prepull == nil {
+		return
+	}
+	ref := ch.TargetRef
+	clients, err := ch.clientsOf(ref)
+	if err == nil {
+		propagation := metav1.DeletePropagationBackground
+		err = clients.dynamicClient.Resource(daemonSetResource).Namespace(ref.RefNamespace).DeleteCollection(context.Background(),
+			metav1.DeleteOptions{PropagationPolicy: &propagation}, metav1.ListOptions{LabelSelector: ch.prepullLabels().String()})
+	}
+	if err != nil {
+		log.Warningf("Failed to clean up prepull daemonsets of job %s of cronHPA %s in %s namespace,because of %v", ch.name, ch.HPARef.Name, ch.HPARef.Namespace, err)
+		return
+	}
+	ch.Lock()
+	defer ch.Unlock()
+	if ch.prepullStatus != nil && !ch.prepullStatus.CleanedUp {
+		status := ch.prepullStatus.DeepCopy()
+		status.CleanedUp = true
+		ch.prepullStatus = status
+	}
+}
+
+// PrepullStatus returns the progress of the last image pre-pull.
+func (ch *CronJobHPA) PrepullStatus() *v1beta1.PrepullStatus {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.prepullStatus
+}
+
+// prepullJobs starts the pre-pull of the jobs whose schedules are within their lead time, and records the progress
+// of the running ones in the conditions.
+func (cm *CronManager) prepullJobs() {
+	for _, entry := range cm.cronExecutor.ListEntries() {
+		job, ok := entry.Job.(*CronJobHPA)
+		if !ok || job.prepull == nil {
+			continue
+		}
+		if job.prepullDue(entry.Next) {
+			if err := job.startPrepull(entry.Next); err != nil {
+				log.Errorf("Failed to prepull images of job %s of cronHPA %s in %s namespace,because of %v", job.Name(), job.HPARef.Name, job.HPARef.Namespace, err)
+				cm.eventRecorder.Event(job.HPARef, v1.EventTypeWarning, "PrepullFailed", fmt.Sprintf("job %s: %v", job.Name(), err))
+				continue
+			}
+		}
+		changed, err := job.refreshPrepull()
+		if err != nil {
+			log.Warningf("Failed to refresh prepull of job %s of cronHPA %s in %s namespace,because of %v", job.Name(), job.HPARef.Name, job.HPARef.Namespace, err)
+			continue
+		}
+		if changed {
+			cm.recordPrepull(job)
+		}
+	}
+}
+
+func (cm *CronManager) recordPrepull(job *CronJobHPA) {
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := cm.client.Get(context.TODO(), types.NamespacedName{Namespace: job.HPARef.Namespace, Name: job.HPARef.Name}, instance); err != nil {
+		log.Errorf("Failed to fetch cronHPA %s in %s namespace,because of %v", job.HPARef.Name, job.HPARef.Namespace, err)
+		return
+	}
+	deepCopy := instance.DeepCopy()
+	for i := range instance.Status.Conditions {
+		if instance.Status.Conditions[i].Name == job.Name() {
+			instance.Status.Conditions[i].Prepull = job.PrepullStatus()
+		}
+	}
+	if err := cm.updateCronHPAStatusWithRetry(instance, deepCopy, job.Name()); err != nil {
+		log.Errorf("Failed to record prepull of job %s of cronHPA %s in %s namespace,because of %v", job.Name(), job.HPARef.Name, job.HPARef.Namespace, err)
+	}
+}
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"time"
+)
+
+const (
+	// uid of the cronHPA owning the balloon pod.
+	BalloonLabel = "cronhpa.alibabacloud.com/balloon"
+	// name of the job the balloon pod is created for.
+	BalloonJobAnnotation = "cronhpa.alibabacloud.com/balloon-job"
+
+	defaultBalloonPriorityClass = "cronhpa-balloon"
+	// the balloon pods only hold the capacity, so they always run the pause image.
+	balloonImage = "registry.k8s.io/pause:3.9"
+	// maximum number of the balloon pods of a job.
+	maxBalloonPods = 100
+	// the balloon pods stop holding the capacity if they are not deleted after the schedule.
+	balloonExtraDeadline = 10 * time.Minute
+	prewarmInterval      = 15 * time.Second
+)
+
+var priorityClassResource = schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}
+
+func checkPrewarm(job v1beta1.Job, distribution []*WeightedTargetRef, external *v1beta1.ExternalTarget) error {
+	if job.Prewarm == nil {
+		return nil
+	}
+	if !isScaleAction(job.Action) || distribution != nil || external != nil {
+		return fmt.Errorf("prewarm of job %s could not be used with distribution, external or actions other than scale", job.Name)
+	}
+	if job.Prewarm.LeadSeconds <= 0 {
+		return fmt.Errorf("leadSeconds of prewarm of job %s should be positive", job.Name)
+	}
+	if job.Prewarm.Replicas == nil && (job.TargetSizeExpr != "" || job.TargetSizeFrom != nil) {
+		return fmt.Errorf("replicas of prewarm of job %s should be set with targetSizeExpr or targetSizeFrom", job.Name)
+	}
+	if replicas := job.Prewarm.Replicas; replicas != nil {
+		if *replicas < 0 || *replicas > maxBalloonPods {
+			return fmt.Errorf("replicas of prewarm of job %s should be between 0 and %d", job.Name, maxBalloonPods)
+		}
+		if job.TargetSizeExpr == "" && job.TargetSizeFrom == nil && *replicas > job.TargetSize {
+			return fmt.Errorf("replicas of prewarm of job %s should not be more than targetSize %d", job.Name, job.TargetSize)
+		}
+	}
+	return nil
+}
+
+// prewarmDue returns whether the balloon pods of the job firing at next should be created now.
+func (ch *CronJobHPA) prewarmDue(next time.Time) bool {
+	if ch.prewarm == nil || next.IsZero() {
+		return false
+	}
+	left := time.Until(next)
+	if left <= 0 || left > time.Duration(ch.prewarm.LeadSeconds)*time.Second {
+		return false
+	}
+	ch.Lock()
+	defer ch.Unlock()
+	return !ch.prewarmedFor.Equal(next)
+}
+
+// prewarmBalloons creates the balloon pods of the job firing at next, the existing balloon pods of the job are kept.
+func (ch *CronJobHPA) prewarmBalloons(next time.Time) (int32, error) {
+	ch.Lock()
+	ch.prewarmedFor = next
+	ch.Unlock()
+	if skip, _ := IsTodayOff(ch.excludeDates); skip {
+		return 0, nil
+	}
+	if f, err := ch.freezes.frozen(ch.HPARef.Namespace, labels.Set(ch.HPARef.Labels)); err == nil && f != nil {
+		return 0, nil
+	}
+
+	ref := ch.TargetRef
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	replicas := ch.DesiredSize
+	if ch.prewarm.Replicas != nil {
+		replicas = *ch.prewarm.Replicas
+	} else {
+		current, err := env.currentReplicas()
+		if err != nil {
+			return 0, err
+		}
+		replicas -= current
+	}
+	if replicas > maxBalloonPods {
+		replicas = maxBalloonPods
+	}
+	existing, err := ch.listBalloons()
+	if err != nil {
+		return 0, err
+	}
+	replicas -= int32(len(existing))
+	if replicas <= 0 {
+		return 0, nil
+	}
+
+	template, err := ch.podTemplateOf(env)
+	if err != nil {
+		return 0, err
+	}
+	clients, err := ch.clientsOf(ref)
+	if err != nil {
+		return 0, err
+	}
+	// the priority classes are read with the identity of the controller, or from the remote cluster of the target
+	classes := ch.dynamicClient
+	if ref.Cluster != "" {
+		classes = clients.dynamicClient
+	}
+	priorityClass, err := ch.balloonPriorityClass(classes, &template.Spec)
+	if err != nil {
+		return 0, err
+	}
+	pod, err := ch.balloonPod(&template.Spec, priorityClass, time.Until(next))
+	if err != nil {
+		return 0, err
+	}
+	var created int32
+	for ; created < replicas; created++ {
+		if _, err := clients.dynamicClient.Resource(podResource).Namespace(ref.RefNamespace).Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+			return created, fmt.Errorf("failed to create balloon pod in %s namespace,because of %v", ref.RefNamespace, err)
+		}
+	}
+	return created, nil
+}
+
+// balloonPriorityClass returns the priority class of the balloon pods, which should exist and have a lower value than
+// the priority of the target pods, so the balloon pods never preempt the workloads.
+func (ch *CronJobHPA) balloonPriorityClass(dynamicClient dynamic.Interface, spec *v1.PodSpec) (string, error) {
+	priorityClass := ch.prewarm.PriorityClassName
+	if priorityClass == "" {
+		priorityClass = defaultBalloonPriorityClass
+	}
+	classes, err := dynamicClient.Resource(priorityClassResource).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list PriorityClasses,because of %v", err)
+	}
+	balloon, found := int64(0), false
+	// the pods without a priority class have the value of the global default class, or 0 if there is none.
+	var target int64
+	for _, pc := range classes.Items {
+		value, _, _ := unstructured.NestedInt64(pc.Object, "value")
+		if pc.GetName() == priorityClass {
+			balloon, found = value, true
+		}
+		if globalDefault, _, _ := unstructured.NestedBool(pc.Object, "globalDefault"); globalDefault && spec.PriorityClassName == "" {
+			target = value
+		}
+		if pc.GetName() == spec.PriorityClassName {
+			target = value
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("PriorityClass %s of the balloon pods is not found", priorityClass)
+	}
+	if balloon >= target {
+		return "", fmt.Errorf("value %d of PriorityClass %s of the balloon pods should be lower than the priority %d of the target pods", balloon, priorityClass, target)
+	}
+	return priorityClass, nil
+}
+
+// balloonPod returns a pause pod with the requests, the node selector, the affinity and the tolerations of the pod
+// template of the target.
+func (ch *CronJobHPA) balloonPod(spec *v1.PodSpec, priorityClass string, lead time.Duration) (*unstructured.Unstructured, error) {
+	requests, _ := podRequests(spec)
+	name := ch.HPARef.Name
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	deadline := int64((lead + balloonExtraDeadline) / time.Second)
+	var gracePeriod int64
+	automount := false
+	pod := &v1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + "-balloon-",
+			Labels:       map[string]string{BalloonLabel: string(ch.HPARef.UID)},
+			Annotations:  map[string]string{BalloonJobAnnotation: ch.name},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "balloon",
+				Image: balloonImage,
+				// limits equal to requests, the extended resources like GPUs need both
+				Resources: v1.ResourceRequirements{Requests: requests, Limits: requests},
+			}},
+			PriorityClassName:             priorityClass,
+			NodeSelector:                  spec.NodeSelector,
+			Affinity:                      spec.Affinity,
+			Tolerations:                   spec.Tolerations,
+			SchedulerName:                 spec.SchedulerName,
+			ActiveDeadlineSeconds:         &deadline,
+			TerminationGracePeriodSeconds: &gracePeriod,
+			AutomountServiceAccountToken:  &automount,
+		},
+	}
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: data}, nil
+}
+
+func (ch *CronJobHPA) listBalloons() ([]unstructured.Unstructured, error) {
+	clients, err := ch.clientsOf(ch.TargetRef)
+	if err != nil {
+		return nil, err
+	}
+	list, err := clients.dynamicClient.Resource(podResource).Namespace(ch.TargetRef.RefNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{BalloonLabel: string(ch.HPARef.UID)}).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list balloon pods in %s namespace,because of %v", ch.TargetRef.RefNamespace, err)
+	}
+	balloons := make([]unstructured.Unstructured, 0)
+	for _, pod := range list.Items {
+		if pod.GetAnnotations()[BalloonJobAnnotation] == ch.name {
+			balloons = append(balloons, pod)
+		}
+	}
+	return balloons, nil
+}
+
+// ownsBalloon returns whether the pod is a balloon pod created for the job.
+func (ch *CronJobHPA) ownsBalloon(pod *v1.Pod) bool {
+	return ch.HPARef != nil && pod.Labels[BalloonLabel] == string(ch.HPARef.UID) && pod.Annotations[BalloonJobAnnotation] == ch.name
+}
+
+// releaseBalloons deletes the balloon pods of the job at the schedule, so the pods of the scale-up preempt
+// into the capacity they held.
+func (ch *CronJobHPA) releaseBalloons() {
+	if ch.prewarm == nil {
+		return
+	}
+	balloons, err := ch.listBalloons()
+	if err == nil && len(balloons) > 0 {
+		clients, clientErr := ch.clientsOf(ch.TargetRef)
+		if clientErr != nil {
+			err = clientErr
+		} else {
+			for _, pod := range balloons {
+				if e := clients.dynamicClient.Resource(podResource).Namespace(pod.GetNamespace()).Delete(context.Background(), pod.GetName(), metav1.DeleteOptions{}); e != nil {
+					err = e
+				}
+			}
+		}
+	}
+	if err != nil {
+		log.Warningf("Failed to release balloon pods of job %s of cronHPA %s in %s namespace,because of %v", ch.name, ch.HPARef.Name, ch.HPARef.Namespace, err)
+	}
+}
+
+// prewarmLoop creates the balloon pods and pulls the images of the jobs whose schedules are within their lead time.
+func (cm *CronManager) prewarmLoop() {
+	ticker := time.NewTicker(prewarmInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				cm.prewarmJobs()
+				cm.prepullJobs()
+			}
+		}
+	}()
+}
+
+func (cm *CronManager) prewarmJobs() {
+	for _, entry := range cm.cronExecutor.ListEntries() {
+		job, ok := entry.Job.(*CronJobHPA)
+		if !ok || !job.prewarmDue(entry.Next) {
+			continue
+		}
+		created, err := job.prewarmBalloons(entry.Next)
+		if err != nil {
+			log.Errorf("Failed to prewarm job %s of cronHPA %s in %s namespace,because of %v", job.Name(), job.HPARef.Name, job.HPARef.Namespace, err)
+			cm.eventRecorder.Event(job.HPARef, v1.EventTypeWarning, "PrewarmFailed", fmt.Sprintf("job %s: %v", job.Name(), err))
+			continue
+		}
+		if created > 0 {
+			cm.eventRecorder.Event(job.HPARef, v1.EventTypeNormal, "Prewarmed", fmt.Sprintf("created %d balloon pods of job %s scheduled at %s",
+				created, job.Name(), entry.Next.Format(time.RFC3339)))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// resolveJobs returns the jobs of the cronHPA, the jobs are expanded from the profile when profileRef is set.
+func (r *ReconcileCronHorizontalPodAutoscaler) resolveJobs(instance *v1beta1.CronHorizontalPodAutoscaler) ([]v1beta1.Job, error) {
+	return ResolveJobs(r.Client, instance)
+}
+
+// ResolveJobs returns the jobs of the cronHPA with the profile read by the client.
+func ResolveJobs(c client.Client, instance *v1beta1.CronHorizontalPodAutoscaler) ([]v1beta1.Job, error) {
+	ref := instance.Spec.ProfileRef
+	if ref == nil {
+		return instance.Spec.Jobs, nil
+	}
+	if len(instance.Spec.Jobs) != 0 {
+		return nil, errors.New("jobs and profileRef could not be used together, use overrides of profileRef instead")
+	}
+	profile := &v1beta1.CronHPAProfile{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: ref.Name}, profile); err != nil {
+		return nil, fmt.Errorf("failed to get profile %s,because of %v", ref.Name, err)
+	}
+	return ExpandProfile(profile, ref)
+}
+
+// ExpandProfile converts the jobs of the profile to the jobs of a cronHPA with the parameters and overrides of the reference.
+func ExpandProfile(profile *v1beta1.CronHPAProfile, ref *v1beta1.ProfileRef) ([]v1beta1.Job, error) {
+	values := make(map[string]int32)
+	for _, p := range profile.Spec.Parameters {
+		if v, ok := ref.Parameters[p.Name]; ok {
+			values[p.Name] = v
+		} else if p.Default != nil {
+			values[p.Name] = *p.Default
+		}
+	}
+	for name := range ref.Parameters {
+		if !profileHasParameter(profile, name) {
+			return nil, fmt.Errorf("parameter %s is not defined by profile %s", name, profile.Name)
+		}
+	}
+
+	overrides := make(map[string]v1beta1.Job)
+	for _, job := range ref.Overrides {
+		overrides[job.Name] = job
+	}
+
+	jobs := make([]v1beta1.Job, 0, len(profile.Spec.Jobs)+len(ref.Overrides))
+	for _, pj := range profile.Spec.Jobs {
+		if job, ok := overrides[pj.Name]; ok {
+			jobs = append(jobs, job)
+			delete(overrides, pj.Name)
+			continue
+		}
+		job := pj.Job
+		if pj.TargetSizeParameter != "" {
+			v, ok := values[pj.TargetSizeParameter]
+			if !ok {
+				return nil, fmt.Errorf("parameter %s of job %s in profile %s has no value", pj.TargetSizeParameter, pj.Name, profile.Name)
+			}
+			job.TargetSize = v
+		}
+		jobs = append(jobs, job)
+	}
+	// keep the order of the overrides which are not in the profile
+	for _, job := range ref.Overrides {
+		if _, ok := overrides[job.Name]; ok {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func profileHasParameter(profile *v1beta1.CronHPAProfile, name string) bool {
+	for _, p := range profile.Spec.Parameters {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileToRequests enqueues the cronHPAs referencing the changed profile.
+func (r *ReconcileCronHorizontalPodAutoscaler) ProfileToRequests(obj handler.MapObject) []reconcile.Request {
+	list := &v1beta1.CronHorizontalPodAutoscalerList{}
+	if err := r.List(context.TODO(), list, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		log.Errorf("Failed to list cronHPA referencing profile %s in %s namespace,because of %v", obj.Meta.GetName(), obj.Meta.GetNamespace(), err)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, item := range list.Items {
+		if item.Spec.ProfileRef != nil && item.Spec.ProfileRef.Name == obj.Meta.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testProfile() *v1beta1.CronHPAProfile {
+	peak := int32(10)
+	return &v1beta1.CronHPAProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "business-hours"},
+		Spec: v1beta1.CronHPAProfileSpec{
+			Parameters: []v1beta1.ProfileParameter{{Name: "peak", Default: &peak}, {Name: "night"}},
+			Jobs: []v1beta1.ProfileJob{
+				{Job: v1beta1.Job{Name: "scale-up", Schedule: "0 0 9 * * *", TargetSize: 1}, TargetSizeParameter: "peak"},
+				{Job: v1beta1.Job{Name: "scale-down", Schedule: "0 0 19 * * *", TargetSize: 2}},
+			},
+		},
+	}
+}
+
+func TestExpandProfile(t *testing.T) {
+	cases := []struct {
+		name  string
+		ref   v1beta1.ProfileRef
+		jobs  []v1beta1.Job
+		err   string
+		night bool
+	}{
+		{
+			name: "default parameter",
+			ref:  v1beta1.ProfileRef{Name: "business-hours"},
+			jobs: []v1beta1.Job{
+				{Name: "scale-up", Schedule: "0 0 9 * * *", TargetSize: 10},
+				{Name: "scale-down", Schedule: "0 0 19 * * *", TargetSize: 2},
+			},
+		},
+		{
+			name: "parameter value",
+			ref:  v1beta1.ProfileRef{Name: "business-hours", Parameters: map[string]int32{"peak": 30}},
+			jobs: []v1beta1.Job{
+				{Name: "scale-up", Schedule: "0 0 9 * * *", TargetSize: 30},
+				{Name: "scale-down", Schedule: "0 0 19 * * *", TargetSize: 2},
+			},
+		},
+		{
+			name: "overrides replace and append",
+			ref: v1beta1.ProfileRef{Name: "business-hours", Overrides: []v1beta1.Job{
+				{Name: "lunch", Schedule: "0 0 12 * * *", TargetSize: 20},
+				{Name: "scale-down", Schedule: "0 0 21 * * *", TargetSize: 3},
+			}},
+			jobs: []v1beta1.Job{
+				{Name: "scale-up", Schedule: "0 0 9 * * *", TargetSize: 10},
+				{Name: "scale-down", Schedule: "0 0 21 * * *", TargetSize: 3},
+				{Name: "lunch", Schedule: "0 0 12 * * *", TargetSize: 20},
+			},
+		},
+		{
+			name: "unknown parameter",
+			ref:  v1beta1.ProfileRef{Name: "business-hours", Parameters: map[string]int32{"weekend": 1}},
+			err:  "parameter weekend is not defined",
+		},
+		{
+			name:  "parameter without value",
+			ref:   v1beta1.ProfileRef{Name: "business-hours"},
+			night: true,
+			err:   "parameter night of job scale-night in profile business-hours has no value",
+		},
+	}
+	for _, c := range cases {
+		profile := testProfile()
+		if c.night {
+			profile.Spec.Jobs = append(profile.Spec.Jobs, v1beta1.ProfileJob{Job: v1beta1.Job{Name: "scale-night", Schedule: "0 0 23 * * *"}, TargetSizeParameter: "night"})
+		}
+		jobs, err := ExpandProfile(profile, &c.ref)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error containing %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(jobs, c.jobs) {
+			t.Errorf("%s: expected jobs %+v, got %+v", c.name, c.jobs, jobs)
+		}
+	}
+}
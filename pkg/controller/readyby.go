@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/ringtail/go-cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// the lead time is the percentile of the durations plus the margin, bounded by maxReadyByLead.
+	readyByPercentile = 0.9
+	readyByMargin     = 30 * time.Second
+	maxReadyByLead    = 30 * time.Minute
+	maxReadySamples   = 20
+	readyPollInterval = 5 * time.Second
+	// a scale-up not Ready within the timeout is not measured.
+	readyTimeout = 30 * time.Minute
+)
+
+// ReadinessHistory keeps the durations the scale-ups of every target took to become Ready. They're seeded from
+// the status of the cronHPAs after a restart, and a new measurement is passed to the recorder which persists it.
+type ReadinessHistory struct {
+	sync.Mutex
+	durations map[string][]int32
+	recorder  func(job *CronJobHPA, durations []int32)
+}
+
+func NewReadinessHistory(recorder func(job *CronJobHPA, durations []int32)) *ReadinessHistory {
+	return &ReadinessHistory{
+		durations: make(map[string][]int32),
+		recorder:  recorder,
+	}
+}
+
+func (h *ReadinessHistory) seed(key string, durations []int32) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.durations[key]; !ok && len(durations) != 0 {
+		h.durations[key] = append([]int32{}, durations...)
+	}
+}
+
+func (h *ReadinessHistory) get(key string) []int32 {
+	h.Lock()
+	defer h.Unlock()
+	return append([]int32{}, h.durations[key]...)
+}
+
+// add keeps the last maxReadySamples durations of the target and returns them.
+func (h *ReadinessHistory) add(key string, seconds int32) []int32 {
+	h.Lock()
+	defer h.Unlock()
+	durations := append(h.durations[key], seconds)
+	if len(durations) > maxReadySamples {
+		durations = durations[len(durations)-maxReadySamples:]
+	}
+	h.durations[key] = durations
+	return append([]int32{}, durations...)
+}
+
+func checkReadyBy(job v1beta1.Job, distribution []*WeightedTargetRef, external *v1beta1.ExternalTarget) error {
+	if job.ReadyBy && (!isScaleAction(job.Action) || distribution != nil || external != nil) {
+		return fmt.Errorf("readyBy of job %s could not be used with distribution, external or actions other than scale", job.Name)
+	}
+	return nil
+}
+
+// readyByLead returns how long the job fires before its schedule, zero until a scale-up of the target is measured.
+func (ch *CronJobHPA) readyByLead() time.Duration {
+	if !ch.readyBy || ch.readiness == nil {
+		return 0
+	}
+	samples := ch.readiness.get(targetKey(ch.TargetRef))
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	index := int(math.Ceil(readyByPercentile*float64(len(samples)))) - 1
+	lead := time.Duration(samples[index])*time.Second + readyByMargin
+	if lead > maxReadyByLead {
+		lead = maxReadyByLead
+	}
+	return lead
+}
+
+// readyBySchedule fires a readyBy job earlier than its schedule by the lead time.
+type readyBySchedule struct {
+	schedule cron.Schedule
+	job      *CronJobHPA
+}
+
+func (s *readyBySchedule) Next(t time.Time) time.Time {
+	lead := s.job.readyByLead()
+	s.job.Lock()
+	defer s.job.Unlock()
+	// the schedule whose fire time has passed has fired early, it's not fired again
+	if !s.job.fireAt.IsZero() && !s.job.fireAt.After(t) {
+		s.job.firedFor = s.job.scheduledAt
+	}
+	from := t
+	if s.job.firedFor.After(from) {
+		from = s.job.firedFor
+	}
+	scheduled := s.schedule.Next(from)
+	if scheduled.IsZero() {
+		return scheduled
+	}
+	fire := scheduled.Add(-lead)
+	if !fire.After(t) {
+		// the lead time grew after the last fire, fire at once to be Ready as early as possible
+		fire = t.Add(time.Second)
+	}
+	s.job.scheduledAt, s.job.fireAt = scheduled, fire
+	return fire
+}
+
+// ReadyByStatus returns the lead time and the next fire time of a readyBy job.
+func (ch *CronJobHPA) ReadyByStatus() *v1beta1.ReadyByStatus {
+	if !ch.readyBy {
+		return nil
+	}
+	lead := ch.readyByLead()
+	status := &v1beta1.ReadyByStatus{
+		LeadSeconds: int32(lead / time.Second),
+		Samples:     int32(len(ch.readiness.get(targetKey(ch.TargetRef)))),
+	}
+	ch.Lock()
+	scheduled := ch.scheduledAt
+	ch.Unlock()
+	if scheduled.IsZero() {
+		// not scheduled by the engine yet
+		schedule, err := cron.Parse(ch.Plan)
+		if err != nil {
+			return status
+		}
+		scheduled = schedule.Next(time.Now().Add(lead))
+	}
+	if !scheduled.IsZero() {
+		fire := scheduled.Add(-lead)
+		if now := time.Now(); fire.Before(now) {
+			fire = now
+		}
+		status.ScheduledTime = &metav1.Time{Time: scheduled}
+		status.EffectiveFireTime = &metav1.Time{Time: fire}
+	}
+	return status
+}
+
+// measureReady polls the workload of the target after a scale-up started at start, and records how long it
+// took until the ready replicas reached the size.
+func (ch *CronJobHPA) measureReady(ref *TargetRef, size int32, start time.Time) {
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	workload, err := ch.workloadOf(env)
+	if err != nil {
+		log.Warningf("Failed to measure readiness of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return
+	}
+	resource, err := ch.resourceOf(workload)
+	if err != nil {
+		log.Warningf("Failed to measure readiness of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return
+	}
+	for first := true; time.Since(start) < readyTimeout; first = false {
+		obj, err := resource.Get(context.Background(), workload.RefName, metav1.GetOptions{})
+		if err == nil {
+			ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+			if int32(ready) >= size {
+				// nothing to measure if the target is Ready at once, e.g. a scale-down
+				if !first {
+					seconds := int32(math.Ceil(time.Since(start).Seconds()))
+					log.Infof("%s %s in %s namespace is Ready with %d replicas after %d seconds", workload.RefKind, workload.RefName, workload.RefNamespace, size, seconds)
+					durations := ch.readiness.add(targetKey(ref), seconds)
+					if ch.readiness.recorder != nil {
+						ch.readiness.recorder(ch, durations)
+					}
+				}
+				return
+			}
+		}
+		time.Sleep(readyPollInterval)
+	}
+	log.Warningf("%s %s in %s namespace is not Ready with %d replicas within %v", workload.RefKind, workload.RefName, workload.RefNamespace, size, readyTimeout)
+}
+
+// recordReadyDurations persists the durations in the status of the cronHPA, and reschedules the job with the new lead time.
+func (cm *CronManager) recordReadyDurations(job *CronJobHPA, durations []int32) {
+	cm.Lock()
+	if current, ok := cm.jobQueue[job.ID()]; ok && current == CronJob(job) {
+		if err := cm.cronExecutor.Update(job); err != nil {
+			log.Errorf("Failed to reschedule job %s of cronHPA %s in %s namespace,because of %v", job.Name(), job.HPARef.Name, job.HPARef.Namespace, err)
+		}
+	}
+	cm.Unlock()
+
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := cm.client.Get(context.TODO(), types.NamespacedName{Namespace: job.HPARef.Namespace, Name: job.HPARef.Name}, instance); err != nil {
+		log.Errorf("Failed to fetch cronHPA %s in %s namespace,because of %v", job.HPARef.Name, job.HPARef.Namespace, err)
+		return
+	}
+	deepCopy := instance.DeepCopy()
+	instance.Status.ReadyDurations = durations
+	for i := range instance.Status.Conditions {
+		if instance.Status.Conditions[i].Name == job.Name() {
+			instance.Status.Conditions[i].ReadyBy = job.ReadyByStatus()
+		}
+	}
+	if err := cm.updateCronHPAStatusWithRetry(instance, deepCopy, job.Name()); err != nil {
+		log.Errorf("Failed to record ready durations of cronHPA %s in %s namespace,because of %v", job.HPARef.Name, job.HPARef.Namespace, err)
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"github.com/ringtail/go-cron"
+	"testing"
+	"time"
+)
+
+func TestReadyByScheduleNext(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	at := func(h, m, s int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+	}
+	cases := []struct {
+		name    string
+		samples []int32
+		// the times the engine asks for the next fire time, in order
+		from []time.Time
+		fire time.Time
+	}{
+		{name: "not measured", from: []time.Time{at(8, 0, 0)}, fire: at(9, 0, 0)},
+		{name: "percentile plus margin", samples: []int32{60, 30, 120, 45}, from: []time.Time{at(8, 0, 0)}, fire: at(8, 57, 30)},
+		{name: "bounded lead", samples: []int32{7200}, from: []time.Time{at(8, 0, 0)}, fire: at(8, 30, 0)},
+		{name: "fired early is not fired again", samples: []int32{60}, from: []time.Time{at(8, 0, 0), at(8, 58, 30)}, fire: at(8, 58, 30).Add(24 * time.Hour)},
+		{name: "lead grew after the last fire", samples: []int32{60}, from: []time.Time{at(8, 59, 0)}, fire: at(8, 59, 1)},
+	}
+	for _, c := range cases {
+		schedule, err := cron.Parse("0 0 9 * * *")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := &TargetRef{RefName: "web", RefNamespace: "default", RefKind: "Deployment", RefGroup: "apps", RefVersion: "v1"}
+		job := &CronJobHPA{TargetRef: ref, readyBy: true, readiness: NewReadinessHistory(nil)}
+		job.readiness.seed(targetKey(ref), c.samples)
+		s := &readyBySchedule{schedule: schedule, job: job}
+		var fire time.Time
+		for _, from := range c.from {
+			fire = s.Next(from)
+		}
+		if !fire.Equal(c.fire) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.fire, fire)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"strings"
+)
+
+// parseJSONPointer splits a JSON pointer(RFC 6901) like /spec/workers/replicas into fields.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || pointer == "/" {
+		return nil, fmt.Errorf("invalid replicasPath %q, it should be a JSON pointer like /spec/replicas", pointer)
+	}
+	fields := strings.Split(pointer[1:], "/")
+	for i, f := range fields {
+		if f == "" {
+			return nil, fmt.Errorf("invalid replicasPath %q, empty field is not allowed", pointer)
+		}
+		fields[i] = strings.Replace(strings.Replace(f, "~1", "/", -1), "~0", "~", -1)
+	}
+	return fields, nil
+}
+
+// replicasOfPath returns the replicas in the field and whether the field exists, an absent field reads as 0.
+func replicasOfPath(obj *unstructured.Unstructured, pointer string) (int32, bool, error) {
+	fields, err := parseJSONPointer(pointer)
+	if err != nil {
+		return 0, false, err
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read %s of %s %s,because of %v", pointer, obj.GetKind(), obj.GetName(), err)
+	}
+	if !found || value == nil {
+		return 0, false, nil
+	}
+	switch v := value.(type) {
+	case int64:
+		return int32(v), true, nil
+	case float64:
+		return int32(v), true, nil
+	}
+	return 0, true, fmt.Errorf("%s of %s %s is not a number", pointer, obj.GetKind(), obj.GetName())
+}
+
+// ScalePathRef scales the target by patching the replicasPath through the dynamic client.
+// The patch tests the replicas read before, so a concurrent change fails the patch and it's retried.
+func (ch *CronJobHPA) ScalePathRef(ref *TargetRef, desiredSize int32) (msg string, err error) {
+	resource, err := ch.resourceOf(ref)
+	if err != nil {
+		return "", err
+	}
+	obj, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("failed to find source target %s %s in %s namespace", ref.RefKind, ref.RefName, ref.RefNamespace)
+		return "", fmt.Errorf("failed to find source target %s %s in %s namespace, err is %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+	}
+	current, found, err := replicasOfPath(obj, ref.ReplicasPath)
+	if err != nil {
+		return "", err
+	}
+
+	op := "add"
+	patch := make([]map[string]interface{}, 0, 2)
+	if found {
+		op = "replace"
+		patch = append(patch, map[string]interface{}{"op": "test", "path": ref.ReplicasPath, "value": current})
+	}
+	patch = append(patch, map[string]interface{}{"op": op, "path": ref.ReplicasPath, "value": desiredSize})
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	if _, err := resource.Patch(context.Background(), ref.RefName, types.JSONPatchType, data, metav1.PatchOptions{}); err != nil {
+		return "", fmt.Errorf("failed to scale %s %s in %s namespace to %d through %s, because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, desiredSize, ref.ReplicasPath, err)
+	}
+	log.Infof("%s %s in namespace %s has been scaled successfully through %s. job: %s replicas: %d", ref.RefKind, ref.RefName, ref.RefNamespace, ref.ReplicasPath, ch.Name(), desiredSize)
+	return fmt.Sprintf("current replicas:%d, desired replicas:%d.", current, desiredSize), nil
+}
@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/ringtail/go-cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	log "k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRolloutTimeout = 10 * time.Minute
+	rolloutPollInterval   = 10 * time.Second
+)
+
+// ScaleDeferred is the result of a job whose scale waits for the rollout of the target.
+type ScaleDeferred struct {
+	Reason   string
+	Deadline time.Time
+}
+
+func (d *ScaleDeferred) Error() string {
+	return fmt.Sprintf("deferred until %s, %s", d.Deadline.Format(time.RFC3339), d.Reason)
+}
+
+func checkWaitForRollout(policy *v1beta1.RolloutWaitPolicy, distribution []*WeightedTargetRef, external *v1beta1.ExternalTarget) error {
+	if policy == nil {
+		return nil
+	}
+	if distribution != nil || external != nil {
+		return fmt.Errorf("waitForRollout could not be used with distribution or external")
+	}
+	if policy.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeoutSeconds of waitForRollout should not be negative")
+	}
+	return nil
+}
+
+func (ch *CronJobHPA) rolloutTimeout() time.Duration {
+	if ch.waitForRollout.TimeoutSeconds == 0 {
+		return defaultRolloutTimeout
+	}
+	return time.Duration(ch.waitForRollout.TimeoutSeconds) * time.Second
+}
+
+// deferForRollout returns ScaleDeferred and starts to wait if the workload of the target is in a rollout. The scale
+// is not deferred if the rollout could not be checked.
+func (ch *CronJobHPA) deferForRollout(ref *TargetRef, size int32) error {
+	if ch.waitForRollout == nil || ch.rollouts == nil {
+		return nil
+	}
+	reason, err := ch.rolloutInProgress(ref)
+	if err != nil {
+		log.Warningf("Skip waitForRollout of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		return nil
+	}
+	if reason == "" {
+		return nil
+	}
+	deadline := time.Now().Add(ch.rolloutTimeout())
+	log.Infof("Defer scaling %s %s in %s namespace to %d by job %s until %s, %s", ref.RefKind, ref.RefName, ref.RefNamespace, size, ch.name, deadline.Format(time.RFC3339), reason)
+	ch.rollouts.start(ch, ref, size, reason, deadline)
+	return &ScaleDeferred{Reason: reason, Deadline: deadline}
+}
+
+// rolloutInProgress returns why the workload of the target is in a rollout, empty if it's not or the kind is unknown.
+func (ch *CronJobHPA) rolloutInProgress(ref *TargetRef) (string, error) {
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	workload, err := ch.workloadOf(env)
+	if err != nil {
+		return "", err
+	}
+	if workload.RefGroup != "apps" || (workload.RefKind != "Deployment" && workload.RefKind != "StatefulSet") {
+		return "", nil
+	}
+	resource, err := ch.resourceOf(workload)
+	if err != nil {
+		return "", err
+	}
+	obj, err := resource.Get(context.Background(), workload.RefName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s %s in %s namespace,because of %v", workload.RefKind, workload.RefName, workload.RefNamespace, err)
+	}
+	return rolloutReason(workload.RefKind, obj), nil
+}
+
+// rolloutReason follows kubectl rollout status. A Deployment exceeding its progress deadline is not waited for,
+// since its rollout doesn't progress any more.
+func rolloutReason(kind string, obj *unstructured.Unstructured) string {
+	name := obj.GetName()
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < obj.GetGeneration() {
+		return fmt.Sprintf("the latest spec of %s %s is not observed yet", kind, name)
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+
+	switch kind {
+	case "Deployment":
+		if paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused"); paused {
+			return fmt.Sprintf("Deployment %s is paused", name)
+		}
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if ok && condition["type"] == "Progressing" && condition["reason"] == "ProgressDeadlineExceeded" {
+				return ""
+			}
+		}
+		current, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+		available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+		if updated < replicas {
+			return fmt.Sprintf("%d of %d replicas of Deployment %s are updated", updated, replicas, name)
+		}
+		if current > updated {
+			return fmt.Sprintf("%d old replicas of Deployment %s are pending termination", current-updated, name)
+		}
+		if available < updated {
+			return fmt.Sprintf("%d of %d updated replicas of Deployment %s are available", available, updated, name)
+		}
+	case "StatefulSet":
+		currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+		updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+		if updateRevision != "" && currentRevision != updateRevision {
+			return fmt.Sprintf("revision %s of StatefulSet %s is rolling out, %d of %d replicas are updated", updateRevision, name, updated, replicas)
+		}
+	}
+	return ""
+}
+
+// RolloutWaiter waits for the rollouts of the targets of the deferred scales, one at most for every target. A job
+// changing the target or the removal of the job stops the wait, and the result of the deferred scale is passed to
+// the handler.
+type RolloutWaiter struct {
+	sync.Mutex
+	waiting map[string]rolloutWait
+	handler func(js *cron.JobResult)
+}
+
+type rolloutWait struct {
+	job  *CronJobHPA
+	stop chan struct{}
+}
+
+func NewRolloutWaiter(handler func(js *cron.JobResult)) *RolloutWaiter {
+	return &RolloutWaiter{
+		waiting: make(map[string]rolloutWait),
+		handler: handler,
+	}
+}
+
+func (w *RolloutWaiter) start(job *CronJobHPA, ref *TargetRef, size int32, reason string, deadline time.Time) {
+	stop := make(chan struct{})
+	w.Lock()
+	if old, ok := w.waiting[targetKey(ref)]; ok {
+		close(old.stop)
+	}
+	w.waiting[targetKey(ref)] = rolloutWait{job: job, stop: stop}
+	w.Unlock()
+	go w.run(job, ref, size, reason, deadline, stop)
+}
+
+func (w *RolloutWaiter) stop(ref *TargetRef) {
+	if w == nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	if old, ok := w.waiting[targetKey(ref)]; ok {
+		close(old.stop)
+		delete(w.waiting, targetKey(ref))
+	}
+}
+
+// stopJob stops the waits of the deferred scales of the job, which is removed or replaced.
+func (w *RolloutWaiter) stopJob(job *CronJobHPA) {
+	if w == nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	for key, old := range w.waiting {
+		if old.job == job {
+			close(old.stop)
+			delete(w.waiting, key)
+		}
+	}
+}
+
+// run scales the target after its rollout completes, or after the deadline even if the rollout is not complete.
+func (w *RolloutWaiter) run(job *CronJobHPA, ref *TargetRef, size int32, reason string, deadline time.Time, stop chan struct{}) {
+	start := time.Now()
+	for {
+		select {
+		case <-stop:
+			log.Infof("Stop waiting for the rollout of %s %s in %s namespace by job %s", ref.RefKind, ref.RefName, ref.RefNamespace, job.Name())
+			return
+		case <-time.After(rolloutPollInterval):
+		}
+		r, err := job.rolloutInProgress(ref)
+		if err != nil {
+			log.Warningf("Failed to check rollout of %s %s in %s namespace,because of %v", ref.RefKind, ref.RefName, ref.RefNamespace, err)
+		} else if reason = r; reason == "" {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+	}
+
+	w.Lock()
+	if w.waiting[targetKey(ref)].stop != stop {
+		w.Unlock()
+		return
+	}
+	delete(w.waiting, targetKey(ref))
+	w.Unlock()
+	waitMsg := fmt.Sprintf("deferred %v by the rollout of %s %s.", time.Since(start).Round(time.Second), ref.RefKind, ref.RefName)
+	if reason != "" {
+		waitMsg = fmt.Sprintf("rollout is not complete after %v, %s.", job.rolloutTimeout(), reason)
+	}
+	// a freeze or the global pause may start during the wait
+	if f, err := job.freezes.frozen(job.HPARef.Namespace, labels.Set(job.HPARef.Labels)); err == nil && f != nil {
+		log.Infof("Skip the deferred scale of %s %s in %s namespace by job %s, %v", ref.RefKind, ref.RefName, ref.RefNamespace, job.Name(), f)
+		if w.handler != nil {
+			w.handler(&cron.JobResult{JobId: job.ID(), Ref: job, Msg: waitMsg, Error: f})
+		}
+		return
+	}
+	log.Infof("Scale %s %s in %s namespace to %d by job %s, %s", ref.RefKind, ref.RefName, ref.RefNamespace, size, job.Name(), waitMsg)
+	msg, err := job.scaleTarget(ref, size)
+	if w.handler != nil {
+		w.handler(&cron.JobResult{JobId: job.ID(), Ref: job, Msg: waitMsg + " " + msg, Error: err})
+	}
+}
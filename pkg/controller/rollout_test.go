@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRolloutReason(t *testing.T) {
+	cases := []struct {
+		name   string
+		kind   string
+		object string
+		reason string
+	}{
+		{
+			name:   "deployment complete",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":3}}`,
+		},
+		{
+			name:   "spec not observed",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":3},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":3}}`,
+			reason: "is not observed yet",
+		},
+		{
+			name:   "paused",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3,"paused":true},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":1,"availableReplicas":3}}`,
+			reason: "is paused",
+		},
+		{
+			name:   "replicas not updated",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":4,"updatedReplicas":1,"availableReplicas":3}}`,
+			reason: "1 of 3 replicas",
+		},
+		{
+			name:   "old replicas terminating",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":4,"updatedReplicas":3,"availableReplicas":3}}`,
+			reason: "1 old replicas",
+		},
+		{
+			name:   "updated replicas not available",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":2}}`,
+			reason: "2 of 3 updated replicas",
+		},
+		{
+			name: "progress deadline exceeded",
+			kind: "Deployment",
+			object: `{"metadata":{"name":"web","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":4,"updatedReplicas":1,"availableReplicas":3,
+				"conditions":[{"type":"Progressing","status":"False","reason":"ProgressDeadlineExceeded"}]}}`,
+		},
+		{
+			name:   "default replicas",
+			kind:   "Deployment",
+			object: `{"metadata":{"name":"web","generation":1},"spec":{},"status":{"observedGeneration":1}}`,
+			reason: "0 of 1 replicas",
+		},
+		{
+			name:   "statefulset rolling",
+			kind:   "StatefulSet",
+			object: `{"metadata":{"name":"db","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"updatedReplicas":1,"currentRevision":"db-1","updateRevision":"db-2"}}`,
+			reason: "revision db-2 of StatefulSet db is rolling out",
+		},
+		{
+			name:   "statefulset complete",
+			kind:   "StatefulSet",
+			object: `{"metadata":{"name":"db","generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"updatedReplicas":3,"currentRevision":"db-2","updateRevision":"db-2"}}`,
+		},
+	}
+	for _, c := range cases {
+		reason := rolloutReason(c.kind, unstructuredOf(t, c.object))
+		if c.reason == "" && reason != "" {
+			t.Errorf("%s: expected no rollout, got %q", c.name, reason)
+		}
+		if c.reason != "" && !strings.Contains(reason, c.reason) {
+			t.Errorf("%s: expected reason containing %q, got %q", c.name, c.reason, reason)
+		}
+	}
+}
+
+func TestRolloutWaiterStopJob(t *testing.T) {
+	removed, other := &CronJobHPA{name: "scale-up"}, &CronJobHPA{name: "scale-up-weekend"}
+	w := NewRolloutWaiter(nil)
+	waits := map[string]rolloutWait{
+		"web": {job: removed, stop: make(chan struct{})},
+		"api": {job: other, stop: make(chan struct{})},
+	}
+	for key, wait := range waits {
+		w.waiting[key] = wait
+	}
+	w.stopJob(removed)
+	for key, wait := range waits {
+		stopped := false
+		select {
+		case <-wait.stop:
+			stopped = true
+		default:
+		}
+		if _, waiting := w.waiting[key]; stopped != (wait.job == removed) || waiting == stopped {
+			t.Errorf("%s: expected stopped %v, got stopped %v and waiting %v", key, wait.job == removed, stopped, waiting)
+		}
+	}
+}
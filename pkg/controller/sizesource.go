@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"io"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	log "k8s.io/klog/v2"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSizeSourceTimeout = 10 * time.Second
+	maxSizeSourceTimeout     = 60 * time.Second
+	// the response of a http source is a small JSON document.
+	maxSizeSourceResponse = 1 << 20
+)
+
+var configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func checkTargetSizeSource(source *v1beta1.TargetSizeSource, hosts *AllowedHosts) error {
+	if (source.ConfigMapKeyRef == nil) == (source.HTTP == nil) {
+		return errors.New("one and only one of configMapKeyRef and http should be set in targetSizeFrom")
+	}
+	if ref := source.ConfigMapKeyRef; ref != nil && (ref.Name == "" || ref.Key == "") {
+		return errors.New("name and key of configMapKeyRef could not be empty")
+	}
+	if source.HTTP != nil {
+		u, err := url.Parse(source.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url %q of targetSizeFrom", source.HTTP.URL)
+		}
+		if !hosts.allowed(u) {
+			return fmt.Errorf("host %s of targetSizeFrom is not allowed by the controller, see --sizeSourceHosts", u.Host)
+		}
+		if time.Duration(source.HTTP.TimeoutSeconds)*time.Second > maxSizeSourceTimeout || source.HTTP.TimeoutSeconds < 0 {
+			return fmt.Errorf("timeoutSeconds of targetSizeFrom should be between 0 and %d", int(maxSizeSourceTimeout/time.Second))
+		}
+		if _, err := parseSizeJSONPath(source.HTTP.JSONPath); err != nil {
+			return fmt.Errorf("invalid jsonPath %q of targetSizeFrom,because of %v", source.HTTP.JSONPath, err)
+		}
+	}
+	for _, v := range []*int32{source.Min, source.Max, source.Fallback} {
+		if v != nil && *v < 0 {
+			return errors.New("min, max and fallback of targetSizeFrom could not be negative")
+		}
+	}
+	if source.Min != nil && source.Max != nil && *source.Min > *source.Max {
+		return fmt.Errorf("min %d of targetSizeFrom is greater than max %d", *source.Min, *source.Max)
+	}
+	return nil
+}
+
+// parseSizeJSONPath accepts both {.a.b} and .a.b
+func parseSizeJSONPath(path string) (*jsonpath.JSONPath, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, errors.New("jsonPath could not be empty")
+	}
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	j := jsonpath.New("targetSize")
+	if err := j.Parse(path); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// resolveTargetSize reads the size from targetSizeFrom and applies the bounds.
+// The fallback is used when the source is unavailable.
+func (ch *CronJobHPA) resolveTargetSize() (int32, string, error) {
+	source := ch.TargetSizeFrom
+	size, from, err := ch.readSizeSource(source)
+	if err != nil {
+		if source.Fallback == nil {
+			return 0, "", fmt.Errorf("failed to read target size from %s,because of %v", from, err)
+		}
+		log.Warningf("Failed to read target size of job %s in cronHPA %s in %s namespace from %s and use fallback %d,because of %v",
+			ch.name, ch.HPARef.Name, ch.HPARef.Namespace, from, *source.Fallback, err)
+		size = *source.Fallback
+		from = fmt.Sprintf("fallback(%s unavailable)", from)
+	}
+	resolved := size
+	if source.Min != nil && resolved < *source.Min {
+		resolved = *source.Min
+	}
+	if source.Max != nil && resolved > *source.Max {
+		resolved = *source.Max
+	}
+
+	ch.Lock()
+	ch.evaluatedSize = &resolved
+	ch.sizeSource = from
+	ch.Unlock()
+	if resolved != size {
+		return resolved, fmt.Sprintf("target size %d read from %s is bounded to %d.", size, from, resolved), nil
+	}
+	return resolved, fmt.Sprintf("target size %d read from %s.", resolved, from), nil
+}
+
+func (ch *CronJobHPA) readSizeSource(source *v1beta1.TargetSizeSource) (int32, string, error) {
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		from := fmt.Sprintf("configmap %s/%s key %s", ch.HPARef.Namespace, ref.Name, ref.Key)
+		// read through the api server rather than cache, the value changes right before the fire time.
+		reader, err := ch.namespaceClient()
+		if err != nil {
+			return 0, from, err
+		}
+		cm, err := reader.Resource(configMapResource).Namespace(ch.HPARef.Namespace).Get(context.Background(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return 0, from, err
+		}
+		data, _, err := unstructured.NestedStringMap(cm.Object, "data")
+		if err != nil {
+			return 0, from, err
+		}
+		value, ok := data[ref.Key]
+		if !ok {
+			return 0, from, fmt.Errorf("key %s is not found", ref.Key)
+		}
+		size, err := parseSize(value)
+		return size, from, err
+	}
+
+	from := fmt.Sprintf("%s %s", source.HTTP.URL, source.HTTP.JSONPath)
+	size, err := readHTTPSize(source.HTTP, ch.sizeSourceHosts)
+	return size, from, err
+}
+
+func readHTTPSize(source *v1beta1.HTTPTargetSizeSource, hosts *AllowedHosts) (int32, error) {
+	timeout := defaultSizeSourceTimeout
+	if source.TimeoutSeconds > 0 {
+		timeout = time.Duration(source.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	for k, v := range source.Headers {
+		req.Header.Set(k, v)
+	}
+	if !hosts.allowed(req.URL) {
+		return 0, fmt.Errorf("host %s is not allowed", req.URL.Host)
+	}
+	resp, err := hosts.httpClient(timeout).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSizeSourceResponse+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(body) > maxSizeSourceResponse {
+		return 0, fmt.Errorf("response is larger than %d bytes", maxSizeSourceResponse)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, fmt.Errorf("invalid json response,because of %v", err)
+	}
+	j, err := parseSizeJSONPath(source.JSONPath)
+	if err != nil {
+		return 0, err
+	}
+	buf := &bytes.Buffer{}
+	if err := j.Execute(buf, data); err != nil {
+		return 0, err
+	}
+	return parseSize(buf.String())
+}
+
+// parseSize accepts non negative integers, floats are rounded down.
+func parseSize(value string) (int32, error) {
+	value = strings.TrimSpace(value)
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || v < 0 || v > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int32(math.Floor(v)), nil
+}
+
+// SizeSource returns where the last size of targetSizeFrom came from.
+func (ch *CronJobHPA) SizeSource() string {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.sizeSource
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	scaleclient "k8s.io/client-go/scale"
+	log "k8s.io/klog/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SleepReplicasAnnotation records the replicas of an object before the namespace sleeps.
+	SleepReplicasAnnotation = "cronhpa.alibabacloud.com/sleep-replicas"
+	// DefaultSleepExcludeLabel is the label to skip an object by the sleep action.
+	DefaultSleepExcludeLabel = "cronhpa.alibabacloud.com/sleep-exclude"
+	// WakeUpAnnotation on a cronHPA wakes the namespace up before the wake job.
+	WakeUpAnnotation = "cronhpa.alibabacloud.com/wake-up"
+)
+
+// namespaceSleeper scales every object with scale subresource in a namespace to 0 and restores them.
+type namespaceSleeper struct {
+	namespace     string
+	excludeLabel  string
+	discovery     discovery.DiscoveryInterface
+	dynamicClient dynamic.Interface
+	scaler        scaleclient.ScalesGetter
+}
+
+func newNamespaceSleeper(namespace string, spec *v1beta1.SleepSpec, discovery discovery.DiscoveryInterface, dynamicClient dynamic.Interface, scaler scaleclient.ScalesGetter) *namespaceSleeper {
+	excludeLabel := DefaultSleepExcludeLabel
+	if spec != nil && spec.ExcludeLabel != "" {
+		excludeLabel = spec.ExcludeLabel
+	}
+	return &namespaceSleeper{
+		namespace:     namespace,
+		excludeLabel:  excludeLabel,
+		discovery:     discovery,
+		dynamicClient: dynamicClient,
+		scaler:        scaler,
+	}
+}
+
+// scalableResources returns the namespaced resources with scale subresource.
+func (ns *namespaceSleeper) scalableResources() ([]schema.GroupVersionResource, error) {
+	lists, err := discovery.ServerPreferredNamespacedResources(ns.discovery)
+	if err != nil && len(lists) == 0 {
+		return nil, err
+	}
+	gvrs := make([]schema.GroupVersionResource, 0)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		scalable := make(map[string]bool)
+		for _, r := range list.APIResources {
+			if strings.HasSuffix(r.Name, "/scale") {
+				scalable[strings.TrimSuffix(r.Name, "/scale")] = true
+			}
+		}
+		for _, r := range list.APIResources {
+			if scalable[r.Name] {
+				gvrs = append(gvrs, gv.WithResource(r.Name))
+			}
+		}
+	}
+	return gvrs, nil
+}
+
+// objects lists the objects which the sleeper takes care of, an object served by several groups only appears once.
+func (ns *namespaceSleeper) objects() ([]schema.GroupVersionResource, []unstructured.Unstructured, error) {
+	gvrs, err := ns.scalableResources()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover scalable resources,because of %v", err)
+	}
+	seen := make(map[types.UID]bool)
+	resources := make([]schema.GroupVersionResource, 0)
+	objects := make([]unstructured.Unstructured, 0)
+	for _, gvr := range gvrs {
+		list, err := ns.dynamicClient.Resource(gvr).Namespace(ns.namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			log.Warningf("Failed to list %s in %s namespace and skip them,because of %v", gvr.String(), ns.namespace, err)
+			continue
+		}
+		for _, item := range list.Items {
+			if seen[item.GetUID()] {
+				continue
+			}
+			seen[item.GetUID()] = true
+			// the object is scaled by its controller, such as the ReplicaSet of a Deployment.
+			if metav1.GetControllerOf(&item) != nil {
+				continue
+			}
+			resources = append(resources, gvr)
+			objects = append(objects, item)
+		}
+	}
+	return resources, objects, nil
+}
+
+func (ns *namespaceSleeper) annotate(gvr schema.GroupVersionResource, name string, value *string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				SleepReplicasAnnotation: value,
+			},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = ns.dynamicClient.Resource(gvr).Namespace(ns.namespace).Patch(context.Background(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+func (ns *namespaceSleeper) scale(gvr schema.GroupVersionResource, name string, replicas int32) error {
+	scale, err := ns.scaler.Scales(ns.namespace).Get(context.Background(), gvr.GroupResource(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	scale.Spec.Replicas = replicas
+	_, err = ns.scaler.Scales(ns.namespace).Update(context.Background(), gvr.GroupResource(), scale, metav1.UpdateOptions{})
+	return err
+}
+
+func sleptObject(obj unstructured.Unstructured, replicas int32) v1beta1.SleptObject {
+	return v1beta1.SleptObject{
+		ScaleTargetRef: v1beta1.ScaleTargetRef{
+			ApiVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Name:       obj.GetName(),
+		},
+		Replicas: replicas,
+	}
+}
+
+// Sleep records the replicas of every object in annotation and then scales it to 0.
+// Objects which have been recorded are asleep already and only scaled to 0 again.
+func (ns *namespaceSleeper) Sleep() (*v1beta1.SleepStatus, string, error) {
+	resources, objects, err := ns.objects()
+	if err != nil {
+		return nil, "", err
+	}
+	status := &v1beta1.SleepStatus{Asleep: true, LastTransitionTime: metav1.Time{Time: time.Now()}}
+	errs := make([]string, 0)
+	for i, obj := range objects {
+		gvr := resources[i]
+		if _, excluded := obj.GetLabels()[ns.excludeLabel]; excluded {
+			continue
+		}
+		recorded, hasRecord := obj.GetAnnotations()[SleepReplicasAnnotation]
+		var replicas int32
+		if hasRecord {
+			r, err := strconv.ParseInt(recorded, 10, 32)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s %s has invalid %s annotation %q", obj.GetKind(), obj.GetName(), SleepReplicasAnnotation, recorded))
+				continue
+			}
+			replicas = int32(r)
+		} else {
+			scale, err := ns.scaler.Scales(ns.namespace).Get(context.Background(), gvr.GroupResource(), obj.GetName(), metav1.GetOptions{})
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("failed to get scale of %s %s: %v", obj.GetKind(), obj.GetName(), err))
+				continue
+			}
+			replicas = scale.Spec.Replicas
+			// record before scaling so that a failed sleep never loses the original replicas
+			value := strconv.Itoa(int(replicas))
+			if err := ns.annotate(gvr, obj.GetName(), &value); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to record replicas of %s %s: %v", obj.GetKind(), obj.GetName(), err))
+				continue
+			}
+		}
+		if err := ns.scale(gvr, obj.GetName(), 0); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to scale %s %s to 0: %v", obj.GetKind(), obj.GetName(), err))
+			continue
+		}
+		status.Objects = append(status.Objects, sleptObject(obj, replicas))
+	}
+	msg := fmt.Sprintf("%d objects in %s namespace fell asleep.", len(status.Objects), ns.namespace)
+	if len(errs) != 0 {
+		return status, msg, fmt.Errorf("failed to put %d objects to sleep: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return status, msg, nil
+}
+
+// Wake restores every object to the recorded replicas and removes the record.
+func (ns *namespaceSleeper) Wake() (*v1beta1.SleepStatus, string, error) {
+	resources, objects, err := ns.objects()
+	if err != nil {
+		return nil, "", err
+	}
+	status := &v1beta1.SleepStatus{Asleep: false, LastTransitionTime: metav1.Time{Time: time.Now()}}
+	errs := make([]string, 0)
+	restored := 0
+	for i, obj := range objects {
+		gvr := resources[i]
+		recorded, ok := obj.GetAnnotations()[SleepReplicasAnnotation]
+		if !ok {
+			continue
+		}
+		replicas, err := strconv.ParseInt(recorded, 10, 32)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s has invalid %s annotation %q", obj.GetKind(), obj.GetName(), SleepReplicasAnnotation, recorded))
+			continue
+		}
+		if err := ns.scale(gvr, obj.GetName(), int32(replicas)); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to restore %s %s to %d: %v", obj.GetKind(), obj.GetName(), replicas, err))
+			continue
+		}
+		if err := ns.annotate(gvr, obj.GetName(), nil); err != nil {
+			log.Warningf("Failed to remove %s annotation of %s %s in %s namespace,because of %v", SleepReplicasAnnotation, obj.GetKind(), obj.GetName(), ns.namespace, err)
+		}
+		restored++
+	}
+	msg := fmt.Sprintf("%d objects in %s namespace woke up.", restored, ns.namespace)
+	if len(errs) != 0 {
+		// the namespace is still asleep while some objects are not restored
+		status.Asleep = true
+		return status, msg, fmt.Errorf("failed to wake %d objects up: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return status, msg, nil
+}
+
+func (ch *CronJobHPA) runSleeper() (msg string, err error) {
+	var status *v1beta1.SleepStatus
+	if ch.Action == v1beta1.SleepAction {
+		status, msg, err = ch.sleeper.Sleep()
+	} else {
+		status, msg, err = ch.sleeper.Wake()
+	}
+	ch.Lock()
+	ch.sleepStatus = status
+	ch.Unlock()
+	return msg, err
+}
+
+// SleepStatus returns the state of the namespace after the last execution of a sleep or wake job.
+func (ch *CronJobHPA) SleepStatus() *v1beta1.SleepStatus {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.sleepStatus
+}
+
+func isSleepAction(action v1beta1.JobAction) bool {
+	return action == v1beta1.SleepAction || action == v1beta1.WakeAction
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/lib"
+	autoscalingapi "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const specVariablePrefix = "spec."
+
+// parseTargetSizeExpr parses the targetSizeExpr of a job and checks the variables are known.
+func parseTargetSizeExpr(s string) (lib.Expr, error) {
+	expr, err := lib.ParseExpr(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid targetSizeExpr %q,because of %v", s, err)
+	}
+	for _, name := range lib.ExprVariables(expr) {
+		switch {
+		case name == "current", name == "previous", name == "hpa.min", name == "hpa.max":
+		case strings.HasPrefix(name, specVariablePrefix) && len(name) > len(specVariablePrefix):
+		default:
+			return nil, fmt.Errorf("invalid targetSizeExpr %q,because of unknown variable %s", s, name)
+		}
+	}
+	return expr, nil
+}
+
+// targetSizeEnv resolves the variables of targetSizeExpr for one evaluation and records the inputs.
+type targetSizeEnv struct {
+	ch     *CronJobHPA
+	ref    *TargetRef
+	hpa    *autoscalingapi.HorizontalPodAutoscaler
+	object *unstructured.Unstructured
+	values map[string]float64
+	inputs []string
+}
+
+func (e *targetSizeEnv) Lookup(name string) (float64, error) {
+	if v, ok := e.values[name]; ok {
+		return v, nil
+	}
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	e.values[name] = v
+	e.inputs = append(e.inputs, fmt.Sprintf("%s=%s", name, strconv.FormatFloat(v, 'f', -1, 64)))
+	return v, nil
+}
+
+func (e *targetSizeEnv) lookup(name string) (float64, error) {
+	switch name {
+	case "current":
+		replicas, err := e.currentReplicas()
+		return float64(replicas), err
+	case "previous":
+		if previous := e.ch.EvaluatedSize(); previous != nil {
+			return float64(*previous), nil
+		}
+		// the job has never been evaluated
+		return e.Lookup("current")
+	case "hpa.min", "hpa.max":
+		hpa, err := e.getHPA()
+		if err != nil {
+			return 0, err
+		}
+		if name == "hpa.max" {
+			return float64(hpa.Spec.MaxReplicas), nil
+		}
+		if hpa.Spec.MinReplicas == nil {
+			return 1, nil
+		}
+		return float64(*hpa.Spec.MinReplicas), nil
+	}
+
+	obj, err := e.getObject()
+	if err != nil {
+		return 0, err
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(name, ".")...)
+	if err != nil || !found {
+		return 0, fmt.Errorf("field %s is not found in %s %s", name, e.ref.RefKind, e.ref.RefName)
+	}
+	switch v := value.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("field %s of %s %s is not a number", name, e.ref.RefKind, e.ref.RefName)
+}
+
+func (e *targetSizeEnv) getHPA() (*autoscalingapi.HorizontalPodAutoscaler, error) {
+	if e.ref.RefKind != "HorizontalPodAutoscaler" {
+		return nil, errors.New("hpa.min and hpa.max are only available when scaleTargetRef is HorizontalPodAutoscaler")
+	}
+	if e.hpa == nil {
+		clients, err := e.ch.clientsOf(e.ref)
+		if err != nil {
+			return nil, err
+		}
+		hpa := &autoscalingapi.HorizontalPodAutoscaler{}
+		if err := clients.client.Get(context.Background(), types.NamespacedName{Namespace: e.ref.RefNamespace, Name: e.ref.RefName}, hpa); err != nil {
+			return nil, fmt.Errorf("Failed to get HorizontalPodAutoscaler Ref,because of %v", err)
+		}
+		e.hpa = hpa
+	}
+	return e.hpa, nil
+}
+
+func (e *targetSizeEnv) getObject() (*unstructured.Unstructured, error) {
+	if e.object != nil {
+		return e.object, nil
+	}
+	if e.ref.RefKind == externalKind {
+		return nil, errors.New("spec fields are not available for external target")
+	}
+	resource, err := e.ch.resourceOf(e.ref)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := resource.Get(context.Background(), e.ref.RefName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s in %s namespace,because of %v", e.ref.RefKind, e.ref.RefName, e.ref.RefNamespace, err)
+	}
+	e.object = obj
+	return obj, nil
+}
+
+// currentReplicas returns the replicas of the target, or the current replicas of the HPA.
+func (e *targetSizeEnv) currentReplicas() (int32, error) {
+	if e.ref.RefKind == externalKind {
+		return e.ch.externalReplicas(e.ref)
+	}
+	if e.ref.RefKind == "HorizontalPodAutoscaler" {
+		hpa, err := e.getHPA()
+		if err != nil {
+			return 0, err
+		}
+		return hpa.Status.CurrentReplicas, nil
+	}
+	if e.ref.ReplicasPath != "" {
+		obj, err := e.getObject()
+		if err != nil {
+			return 0, err
+		}
+		replicas, _, err := replicasOfPath(obj, e.ref.ReplicasPath)
+		return replicas, err
+	}
+	if isKEDAScaledObject(e.ref) {
+		obj, err := e.getObject()
+		if err != nil {
+			return 0, err
+		}
+		targetRef, err := kedaScaleTargetRef(obj, e.ref)
+		if err != nil {
+			return 0, err
+		}
+		return e.ch.scaleReplicas(targetRef)
+	}
+	return e.ch.scaleReplicas(e.ref)
+}
+
+// evaluateTargetSize evaluates targetSizeExpr against the target, the result is rounded down.
+func (ch *CronJobHPA) evaluateTargetSize(ref *TargetRef) (int32, string, error) {
+	env := &targetSizeEnv{ch: ch, ref: ref, values: make(map[string]float64)}
+	v, err := ch.sizeExpr.Eval(env)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to evaluate targetSizeExpr %q,because of %v", ch.TargetSizeExpr, err)
+	}
+	if math.IsNaN(v) || v < 0 || v > math.MaxInt32 {
+		return 0, "", fmt.Errorf("targetSizeExpr %q evaluated to invalid size %v with %s", ch.TargetSizeExpr, v, strings.Join(env.inputs, ", "))
+	}
+	size := int32(math.Floor(v))
+	ch.Lock()
+	ch.evaluatedSize = &size
+	ch.Unlock()
+	msg := fmt.Sprintf("targetSizeExpr %q evaluated to %d with %s.", ch.TargetSizeExpr, size, strings.Join(env.inputs, ", "))
+	log.Infof("Job %s of cronHPA %s in %s namespace: %s", ch.name, ch.HPARef.Name, ch.HPARef.Namespace, msg)
+	return size, msg, nil
+}
+
+// EvaluatedSize returns the result of the last evaluation of targetSizeExpr.
+func (ch *CronJobHPA) EvaluatedSize() *int32 {
+	ch.Lock()
+	defer ch.Unlock()
+	return ch.evaluatedSize
+}
+
+// SetEvaluatedSize restores the result of the last evaluation from the status, which is the previous of next evaluation.
+func (ch *CronJobHPA) SetEvaluatedSize(size *int32) {
+	ch.Lock()
+	defer ch.Unlock()
+	ch.evaluatedSize = size
+}
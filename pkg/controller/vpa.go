@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var vpaGroupKind = schema.GroupKind{Group: "autoscaling.k8s.io", Kind: "VerticalPodAutoscaler"}
+
+// newVPATarget checks the vpa of the job and that the VerticalPodAutoscaler CRD is installed.
+func newVPATarget(spec *v1beta1.VPASpec, namespace string, mapper apimeta.RESTMapper) (*TargetRef, error) {
+	if spec.Name == "" {
+		return nil, errors.New("name of vpa could not be empty")
+	}
+	switch spec.UpdateMode {
+	case "", "Off", "Initial", "Recreate", "Auto":
+	default:
+		return nil, fmt.Errorf("unknown updateMode %s of vpa", spec.UpdateMode)
+	}
+	if spec.UpdateMode == "" && len(spec.ContainerPolicies) == 0 {
+		return nil, errors.New("updateMode or containerPolicies of vpa should be set")
+	}
+	names := make(map[string]bool)
+	for _, p := range spec.ContainerPolicies {
+		if p.ContainerName == "" || names[p.ContainerName] {
+			return nil, fmt.Errorf("containerName %q of vpa is empty or duplicated", p.ContainerName)
+		}
+		names[p.ContainerName] = true
+	}
+	mapping, err := mapper.RESTMapping(vpaGroupKind)
+	if err != nil {
+		return nil, fmt.Errorf("VerticalPodAutoscaler is not installed in the cluster,because of %v", err)
+	}
+	return &TargetRef{
+		RefName:      spec.Name,
+		RefNamespace: namespace,
+		RefKind:      vpaGroupKind.Kind,
+		RefGroup:     vpaGroupKind.Group,
+		RefVersion:   mapping.GroupVersionKind.Version,
+	}, nil
+}
+
+// vpaPatch merges the policies of the job into the container policies of the VPA.
+// The whole list is in the patch because a merge patch replaces lists, so the patch carries the resourceVersion
+// of the VPA and fails on a conflict rather than dropping the policies changed in the meantime.
+func vpaPatch(vpa *unstructured.Unstructured, spec *v1beta1.VPASpec) ([]byte, error) {
+	patchSpec := make(map[string]interface{})
+	if spec.UpdateMode != "" {
+		patchSpec["updatePolicy"] = map[string]interface{}{"updateMode": spec.UpdateMode}
+	}
+	if len(spec.ContainerPolicies) != 0 {
+		policies, _, err := unstructured.NestedSlice(vpa.Object, "spec", "resourcePolicy", "containerPolicies")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range spec.ContainerPolicies {
+			var policy map[string]interface{}
+			for _, existing := range policies {
+				if m, ok := existing.(map[string]interface{}); ok && m["containerName"] == p.ContainerName {
+					policy = m
+				}
+			}
+			if policy == nil {
+				policy = map[string]interface{}{"containerName": p.ContainerName}
+				policies = append(policies, policy)
+			}
+			mergeResourceList(policy, "minAllowed", p.MinAllowed)
+			mergeResourceList(policy, "maxAllowed", p.MaxAllowed)
+		}
+		patchSpec["resourcePolicy"] = map[string]interface{}{"containerPolicies": policies}
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": vpa.GetResourceVersion()},
+		"spec":     patchSpec,
+	})
+}
+
+// mergeResourceList sets the resources of list in the field of policy and keeps the others.
+func mergeResourceList(policy map[string]interface{}, field string, list corev1.ResourceList) {
+	if len(list) == 0 {
+		return
+	}
+	m, ok := policy[field].(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{}, len(list))
+	}
+	for name, quantity := range list {
+		m[string(name)] = quantity.String()
+	}
+	policy[field] = m
+}
+
+func (ch *CronJobHPA) runVPA() (string, error) {
+	ref := ch.TargetRef
+	return retryUntilTimeout(fmt.Sprintf("update VerticalPodAutoscaler %s in %s namespace", ref.RefName, ref.RefNamespace), func() (string, error) {
+		resource, err := ch.resourceOf(ref)
+		if err != nil {
+			return "", err
+		}
+		vpa, err := resource.Get(context.Background(), ref.RefName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get VerticalPodAutoscaler %s in %s namespace,because of %v", ref.RefName, ref.RefNamespace, err)
+		}
+		data, err := vpaPatch(vpa, ch.vpa)
+		if err != nil {
+			return "", err
+		}
+		// the previous values are always stored for the revert action
+		return ch.applyPatch(ref, types.MergePatchType, data, true)
+	})
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"reflect"
+	"testing"
+)
+
+// TestRevertVPA checks the revert of a vpa job only restores the containerPolicies changed by the job.
+func TestRevertVPA(t *testing.T) {
+	original := `{"metadata":{"name":"web","resourceVersion":"7"},"spec":{"updatePolicy":{"updateMode":"Auto"},"resourcePolicy":{"containerPolicies":[` +
+		`{"containerName":"web","maxAllowed":{"cpu":"2","memory":"1Gi"}},{"containerName":"log","maxAllowed":{"memory":"100Mi"}}]}}}`
+	cases := []struct {
+		name     string
+		spec     v1beta1.VPASpec
+		current  func(policies []interface{}) []interface{}
+		restored string
+		conflict bool
+	}{
+		{
+			name:     "policy changed by others",
+			spec:     v1beta1.VPASpec{ContainerPolicies: []v1beta1.VPAContainerPolicy{{ContainerName: "web", MaxAllowed: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")}}}},
+			restored: `[{"containerName":"web","maxAllowed":{"cpu":"2","memory":"1Gi"}},{"containerName":"log","maxAllowed":{"memory":"200Mi"}},{"containerName":"proxy"}]`,
+			current: func(policies []interface{}) []interface{} {
+				policies[1] = map[string]interface{}{"containerName": "log", "maxAllowed": map[string]interface{}{"memory": "200Mi"}}
+				return append(policies, map[string]interface{}{"containerName": "proxy"})
+			},
+		},
+		{
+			name:     "policy added by the job",
+			spec:     v1beta1.VPASpec{ContainerPolicies: []v1beta1.VPAContainerPolicy{{ContainerName: "batch", MinAllowed: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}}},
+			restored: `[{"containerName":"web","maxAllowed":{"cpu":"2","memory":"1Gi"}},{"containerName":"log","maxAllowed":{"memory":"100Mi"}},{"containerName":"proxy"}]`,
+			current: func(policies []interface{}) []interface{} {
+				return append(policies, map[string]interface{}{"containerName": "proxy"})
+			},
+		},
+		{
+			name: "policy of the job changed by others",
+			spec: v1beta1.VPASpec{ContainerPolicies: []v1beta1.VPAContainerPolicy{{ContainerName: "web", MaxAllowed: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")}}}},
+			current: func(policies []interface{}) []interface{} {
+				policies[0].(map[string]interface{})["maxAllowed"].(map[string]interface{})["memory"] = "8Gi"
+				return policies
+			},
+			conflict: true,
+		},
+	}
+	for _, c := range cases {
+		vpa := unstructuredOf(t, original)
+		data, err := vpaPatch(vpa, &c.spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		patchedData, err := jsonpatch.MergePatch([]byte(original), data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		patched := unstructuredOf(t, string(patchedData))
+		inverse, err := inverseJSONPatch(vpa, patched)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+
+		current := patched.DeepCopy()
+		policies := current.Object["spec"].(map[string]interface{})["resourcePolicy"].(map[string]interface{})
+		policies["containerPolicies"] = c.current(policies["containerPolicies"].([]interface{}))
+		err = checkInverse(current, inverse)
+		if c.conflict {
+			if err == nil {
+				t.Errorf("%s: expected the revert to be refused", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		patch, _ := jsonpatch.DecodePatch([]byte(inverse))
+		currentData, _ := json.Marshal(current.Object)
+		restored, err := patch.Apply(currentData)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := unstructuredOf(t, string(restored)).Object["spec"].(map[string]interface{})["resourcePolicy"].(map[string]interface{})["containerPolicies"]
+		var expected interface{}
+		if err := json.Unmarshal([]byte(c.restored), &expected); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected containerPolicies %v, got %v", c.name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/ringtail/go-cron"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ScheduleAnnotation on a workload generates a cronHPA owned by the workload.
+	// The value is a list of "<schedule>=<targetSize>" separated by ";".
+	ScheduleAnnotation = "cronhpa.alibabacloud.com/schedule"
+	// GeneratedByLabel marks the cronHPA generated from the ScheduleAnnotation.
+	GeneratedByLabel = "cronhpa.alibabacloud.com/generated-by"
+)
+
+// NewWorkloadReconciler returns a new reconcile.Reconciler which generates cronHPA from the annotations of workloads of the kind.
+// newObject should return an empty object of the kind, such as Deployment and StatefulSet.
+func NewWorkloadReconciler(mgr manager.Manager, gvk schema.GroupVersionKind, newObject func() runtime.Object) reconcile.Reconciler {
+	return &ReconcileWorkloadAnnotation{
+		Client:        mgr.GetClient(),
+		scheme:        mgr.GetScheme(),
+		gvk:           gvk,
+		newObject:     newObject,
+		eventRecorder: mgr.GetEventRecorderFor("CronHorizontalPodAutoscaler"),
+	}
+}
+
+var _ reconcile.Reconciler = &ReconcileWorkloadAnnotation{}
+
+// ReconcileWorkloadAnnotation keeps the generated cronHPA consistent with the ScheduleAnnotation of a workload
+type ReconcileWorkloadAnnotation struct {
+	client.Client
+	scheme        *runtime.Scheme
+	gvk           schema.GroupVersionKind
+	newObject     func() runtime.Object
+	eventRecorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=autoscaling.alibabacloud.com,resources=cronhorizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+func (r *ReconcileWorkloadAnnotation) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	obj := r.newObject()
+	err := r.Get(context.TODO(), request.NamespacedName, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the generated cronHPA is collected by the owner reference
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	workload := obj.(metav1.Object)
+
+	name := generatedCronHPAName(workload.GetName(), r.gvk.Kind)
+	existing := &v1beta1.CronHorizontalPodAutoscaler{}
+	err = r.Get(context.TODO(), types.NamespacedName{Namespace: request.Namespace, Name: name}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return reconcile.Result{}, err
+	}
+	found := err == nil
+	if found && !metav1.IsControlledBy(existing, workload) {
+		log.Warningf("Skip generating cronHPA %s in %s namespace from %s %s, because the cronHPA is not owned by it", name, request.Namespace, r.gvk.Kind, workload.GetName())
+		return reconcile.Result{}, nil
+	}
+
+	value, ok := workload.GetAnnotations()[ScheduleAnnotation]
+	if !ok {
+		if found {
+			log.Infof("Remove cronHPA %s in %s namespace, because %s annotation of %s %s is removed", name, request.Namespace, ScheduleAnnotation, r.gvk.Kind, workload.GetName())
+			if err := r.Delete(context.TODO(), existing); err != nil && !errors.IsNotFound(err) {
+				return reconcile.Result{}, err
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
+	jobs, err := ParseScheduleAnnotation(value)
+	if err != nil {
+		log.Errorf("Failed to parse %s annotation of %s %s in %s namespace,because of %v", ScheduleAnnotation, r.gvk.Kind, workload.GetName(), request.Namespace, err)
+		r.eventRecorder.Event(obj, v1.EventTypeWarning, "InvalidSchedule", fmt.Sprintf("Failed to parse %s annotation,because of %v", ScheduleAnnotation, err))
+		return reconcile.Result{}, nil
+	}
+
+	spec := v1beta1.CronHorizontalPodAutoscalerSpec{
+		ScaleTargetRef: v1beta1.ScaleTargetRef{
+			ApiVersion: r.gvk.GroupVersion().String(),
+			Kind:       r.gvk.Kind,
+			Name:       workload.GetName(),
+		},
+		Jobs: jobs,
+	}
+
+	if !found {
+		instance := &v1beta1.CronHorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: request.Namespace,
+				Labels: map[string]string{
+					GeneratedByLabel: strings.ToLower(r.gvk.Kind),
+				},
+			},
+			Spec: spec,
+		}
+		if err := controllerutil.SetControllerReference(workload, instance, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+		log.Infof("Generate cronHPA %s in %s namespace from %s %s", name, request.Namespace, r.gvk.Kind, workload.GetName())
+		return reconcile.Result{}, r.Create(context.TODO(), instance)
+	}
+
+	if equality.Semantic.DeepEqual(existing.Spec, spec) {
+		return reconcile.Result{}, nil
+	}
+	existing.Spec = spec
+	log.Infof("Update cronHPA %s in %s namespace from %s %s", name, request.Namespace, r.gvk.Kind, workload.GetName())
+	return reconcile.Result{}, r.Update(context.TODO(), existing)
+}
+
+func generatedCronHPAName(workloadName string, kind string) string {
+	return fmt.Sprintf("%s-%s", workloadName, strings.ToLower(kind))
+}
+
+// ParseScheduleAnnotation parses jobs like "0 0 9 * * MON-FRI=10; 0 0 20 * * *=2".
+// The jobs are named by their position in the annotation.
+func ParseScheduleAnnotation(value string) ([]v1beta1.Job, error) {
+	jobs := make([]v1beta1.Job, 0)
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		index := strings.LastIndex(item, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("job %q should be in format <schedule>=<targetSize>", item)
+		}
+		schedule := strings.TrimSpace(item[:index])
+		if _, err := cron.Parse(schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule of job %q,because of %v", item, err)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(item[index+1:]), 10, 32)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid targetSize of job %q", item)
+		}
+		jobs = append(jobs, v1beta1.Job{
+			Name:       fmt.Sprintf("job-%d", len(jobs)),
+			Schedule:   schedule,
+			TargetSize: int32(size),
+		})
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job is found in %q", value)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package externalscaler defines the gRPC protocol between the controller and the scalers of
+// targets outside of the cluster. Messages are encoded as JSON with the content subtype "json",
+// so a scaler could be written in any language without the generated code of a proto file.
+//
+//	service cronhpa.external.v1.ExternalScaler {
+//	  rpc GetCurrent(TargetRequest) returns (GetCurrentResponse);
+//	  rpc SetDesired(SetDesiredRequest) returns (SetDesiredResponse);
+//	  rpc Describe(TargetRequest) returns (DescribeResponse);
+//	}
+package externalscaler
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"time"
+)
+
+const (
+	ServiceName = "cronhpa.external.v1.ExternalScaler"
+	// ContentSubtype of the codec, the content type on the wire is application/grpc+json.
+	ContentSubtype = "json"
+)
+
+type TargetRequest struct {
+	// name of the target in the spec of the cronHPA.
+	Name string `json:"name"`
+	// namespace of the cronHPA.
+	Namespace string            `json:"namespace"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+type GetCurrentResponse struct {
+	Replicas int32 `json:"replicas"`
+}
+
+type SetDesiredRequest struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Replicas  int32             `json:"replicas"`
+}
+
+type SetDesiredResponse struct {
+	// replicas accepted by the scaler, it may differ from the desired replicas.
+	Replicas int32 `json:"replicas"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+type DescribeResponse struct {
+	// kind of the target, e.g. NodePool.
+	Kind string `json:"kind,omitempty"`
+	// bounds of the target, the desired replicas are bounded to them. 0 of maxReplicas means unlimited.
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// ExternalScalerServer is implemented by the external scalers.
+type ExternalScalerServer interface {
+	GetCurrent(context.Context, *TargetRequest) (*GetCurrentResponse, error)
+	SetDesired(context.Context, *SetDesiredRequest) (*SetDesiredResponse, error)
+	Describe(context.Context, *TargetRequest) (*DescribeResponse, error)
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return ContentSubtype
+}
+
+func RegisterExternalScalerServer(s *grpc.Server, srv ExternalScalerServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ExternalScalerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetCurrent", Handler: getCurrentHandler},
+		{MethodName: "SetDesired", Handler: setDesiredHandler},
+		{MethodName: "Describe", Handler: describeHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func getCurrentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TargetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExternalScalerServer).GetCurrent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/GetCurrent"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExternalScalerServer).GetCurrent(ctx, req.(*TargetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func setDesiredHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDesiredRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExternalScalerServer).SetDesired(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/SetDesired"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExternalScalerServer).SetDesired(ctx, req.(*SetDesiredRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func describeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TargetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExternalScalerServer).Describe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Describe"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExternalScalerServer).Describe(ctx, req.(*TargetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Client calls an external scaler, every call is bounded by the timeout.
+type Client struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+// Dial connects to the scaler at address, plaintext is used if tlsConfig is nil.
+func Dial(address string, tlsConfig *tls.Config, timeout time.Duration) (*Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(ContentSubtype)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, timeout: timeout}, nil
+}
+
+func (c *Client) GetCurrent(in *TargetRequest) (*GetCurrentResponse, error) {
+	out := new(GetCurrentResponse)
+	return out, c.invoke("GetCurrent", in, out)
+}
+
+func (c *Client) SetDesired(in *SetDesiredRequest) (*SetDesiredResponse, error) {
+	out := new(SetDesiredResponse)
+	return out, c.invoke("SetDesired", in, out)
+}
+
+func (c *Client) Describe(in *TargetRequest) (*DescribeResponse, error) {
+	out := new(DescribeResponse)
+	return out, c.invoke("Describe", in, out)
+}
+
+func (c *Client) invoke(method string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/"+method, in, out)
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
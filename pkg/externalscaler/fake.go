@@ -0,0 +1,122 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalscaler
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"sync"
+)
+
+// FakeTarget is a target kept in memory by the FakeServer.
+type FakeTarget struct {
+	Replicas    int32
+	MinReplicas int32
+	MaxReplicas int32
+}
+
+// FakeServer is an in-process reference implementation of the external scaler for tests.
+// Targets are keyed by namespace/name and have to be added with SetTarget before use.
+type FakeServer struct {
+	sync.Mutex
+	targets map[string]*FakeTarget
+	server  *grpc.Server
+}
+
+func NewFakeServer() *FakeServer {
+	return &FakeServer{targets: make(map[string]*FakeTarget)}
+}
+
+// Start serves on a random local port and returns the address.
+func (s *FakeServer) Start() (string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	s.server = grpc.NewServer()
+	RegisterExternalScalerServer(s.server, s)
+	go s.server.Serve(lis)
+	return lis.Addr().String(), nil
+}
+
+func (s *FakeServer) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+func (s *FakeServer) SetTarget(namespace, name string, target FakeTarget) {
+	s.Lock()
+	defer s.Unlock()
+	s.targets[namespace+"/"+name] = &target
+}
+
+// Replicas returns the replicas of the target, false if it doesn't exist.
+func (s *FakeServer) Replicas(namespace, name string) (int32, bool) {
+	s.Lock()
+	defer s.Unlock()
+	t, ok := s.targets[namespace+"/"+name]
+	if !ok {
+		return 0, false
+	}
+	return t.Replicas, true
+}
+
+func (s *FakeServer) target(namespace, name string) (*FakeTarget, error) {
+	t, ok := s.targets[namespace+"/"+name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "target %s/%s is not found", namespace, name)
+	}
+	return t, nil
+}
+
+func (s *FakeServer) GetCurrent(ctx context.Context, in *TargetRequest) (*GetCurrentResponse, error) {
+	s.Lock()
+	defer s.Unlock()
+	t, err := s.target(in.Namespace, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &GetCurrentResponse{Replicas: t.Replicas}, nil
+}
+
+func (s *FakeServer) SetDesired(ctx context.Context, in *SetDesiredRequest) (*SetDesiredResponse, error) {
+	s.Lock()
+	defer s.Unlock()
+	t, err := s.target(in.Namespace, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	if in.Replicas < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid replicas %d", in.Replicas)
+	}
+	t.Replicas = in.Replicas
+	return &SetDesiredResponse{Replicas: t.Replicas}, nil
+}
+
+func (s *FakeServer) Describe(ctx context.Context, in *TargetRequest) (*DescribeResponse, error) {
+	s.Lock()
+	defer s.Unlock()
+	t, err := s.target(in.Namespace, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeResponse{Kind: "Fake", MinReplicas: t.MinReplicas, MaxReplicas: t.MaxReplicas}, nil
+}
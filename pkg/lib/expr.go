@@ -0,0 +1,353 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Env resolves the variables of an expression.
+type Env interface {
+	Lookup(name string) (float64, error)
+}
+
+// Expr is a parsed arithmetic expression. Only numbers, variables, + - * / %, parentheses and
+// the functions min, max, ceil, floor, round and abs are supported, so it is safe to evaluate user input.
+type Expr interface {
+	Eval(env Env) (float64, error)
+	String() string
+}
+
+type exprFunc struct {
+	minArgs int
+	maxArgs int // -1 means no limit
+	call    func(args []float64) float64
+}
+
+var exprFuncs = map[string]exprFunc{
+	"min": {minArgs: 1, maxArgs: -1, call: func(args []float64) float64 {
+		r := args[0]
+		for _, a := range args[1:] {
+			r = math.Min(r, a)
+		}
+		return r
+	}},
+	"max": {minArgs: 1, maxArgs: -1, call: func(args []float64) float64 {
+		r := args[0]
+		for _, a := range args[1:] {
+			r = math.Max(r, a)
+		}
+		return r
+	}},
+	"ceil":  {minArgs: 1, maxArgs: 1, call: func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {minArgs: 1, maxArgs: 1, call: func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {minArgs: 1, maxArgs: 1, call: func(args []float64) float64 { return math.Round(args[0]) }},
+	"abs":   {minArgs: 1, maxArgs: 1, call: func(args []float64) float64 { return math.Abs(args[0]) }},
+}
+
+type numberExpr float64
+
+func (n numberExpr) Eval(env Env) (float64, error) {
+	return float64(n), nil
+}
+
+func (n numberExpr) String() string {
+	return strconv.FormatFloat(float64(n), 'f', -1, 64)
+}
+
+type variableExpr string
+
+func (v variableExpr) Eval(env Env) (float64, error) {
+	return env.Lookup(string(v))
+}
+
+func (v variableExpr) String() string {
+	return string(v)
+}
+
+type negExpr struct {
+	x Expr
+}
+
+func (n *negExpr) Eval(env Env) (float64, error) {
+	x, err := n.x.Eval(env)
+	return -x, err
+}
+
+func (n *negExpr) String() string {
+	return "-" + n.x.String()
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y Expr
+}
+
+func (b *binaryExpr) Eval(env Env) (float64, error) {
+	x, err := b.x.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	y, err := b.y.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return x + y, nil
+	case '-':
+		return x - y, nil
+	case '*':
+		return x * y, nil
+	case '/':
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero in %s", b.String())
+		}
+		return x / y, nil
+	case '%':
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero in %s", b.String())
+		}
+		return math.Mod(x, y), nil
+	}
+	return 0, fmt.Errorf("unknown operator %c", b.op)
+}
+
+func (b *binaryExpr) String() string {
+	return fmt.Sprintf("(%s %c %s)", b.x.String(), b.op, b.y.String())
+}
+
+type callExpr struct {
+	name string
+	args []Expr
+}
+
+func (c *callExpr) Eval(env Env) (float64, error) {
+	args := make([]float64, 0, len(c.args))
+	for _, a := range c.args {
+		v, err := a.Eval(env)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, v)
+	}
+	return exprFuncs[c.name].call(args), nil
+}
+
+func (c *callExpr) String() string {
+	args := make([]string, 0, len(c.args))
+	for _, a := range c.args {
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("%s(%s)", c.name, strings.Join(args, ", "))
+}
+
+// ParseExpr parses expressions like "max(current, 20)", "ceil(current * 1.5)" and "hpa.max / 2".
+func ParseExpr(s string) (Expr, error) {
+	p := &exprParser{input: s}
+	p.next()
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tok, p.start)
+	}
+	return e, nil
+}
+
+// ExprVariables returns the names of the variables used by the expression in order of appearance.
+func ExprVariables(e Expr) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	var walk func(e Expr)
+	walk = func(e Expr) {
+		switch t := e.(type) {
+		case variableExpr:
+			if !seen[string(t)] {
+				seen[string(t)] = true
+				names = append(names, string(t))
+			}
+		case *negExpr:
+			walk(t.x)
+		case *binaryExpr:
+			walk(t.x)
+			walk(t.y)
+		case *callExpr:
+			for _, a := range t.args {
+				walk(a)
+			}
+		}
+	}
+	walk(e)
+	return names
+}
+
+type exprParser struct {
+	input string
+	pos   int
+	start int
+	tok   string
+	err   error
+}
+
+func isIdentChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && (c == '.' || (c >= '0' && c <= '9'))
+}
+
+// next moves to the next token, tok is empty at the end of input.
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+	p.start = p.pos
+	if p.pos >= len(p.input) {
+		p.tok = ""
+		return
+	}
+	c := p.input[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+	case isIdentChar(c, true):
+		for p.pos < len(p.input) && isIdentChar(p.input[p.pos], false) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.input[p.start:p.pos]
+}
+
+func (p *exprParser) parseSum() (Expr, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseProduct() (Expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" || p.tok == "%" {
+		op := p.tok[0]
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if p.tok == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, errors.New("unexpected end of expression")
+	case tok == "(":
+		p.next()
+		x, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ) at position %d", p.start)
+		}
+		p.next()
+		return x, nil
+	case tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok, p.start)
+		}
+		p.next()
+		return numberExpr(v), nil
+	case isIdentChar(tok[0], true):
+		start := p.start
+		p.next()
+		if p.tok != "(" {
+			if strings.HasSuffix(tok, ".") || strings.Contains(tok, "..") {
+				return nil, fmt.Errorf("invalid variable %q at position %d", tok, start)
+			}
+			return variableExpr(tok), nil
+		}
+		f, ok := exprFuncs[tok]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q at position %d", tok, start)
+		}
+		p.next()
+		args := make([]Expr, 0)
+		for p.tok != ")" {
+			a, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+			if p.tok == "," {
+				p.next()
+				if p.tok == ")" {
+					return nil, fmt.Errorf("missing argument of function %s at position %d", tok, p.start)
+				}
+				continue
+			}
+			if p.tok != ")" {
+				return nil, fmt.Errorf("missing ) of function %s at position %d", tok, p.start)
+			}
+		}
+		p.next()
+		if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+			return nil, fmt.Errorf("wrong number of arguments of function %s", tok)
+		}
+		return &callExpr{name: tok, args: args}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok, p.start)
+}
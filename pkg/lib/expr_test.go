@@ -0,0 +1,110 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type mapEnv map[string]float64
+
+func (m mapEnv) Lookup(name string) (float64, error) {
+	v, ok := m[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown variable %s", name)
+	}
+	return v, nil
+}
+
+func TestParseExpr(t *testing.T) {
+	env := mapEnv{"current": 10, "hpa.max": 30, "spec.parallelism": 4}
+	cases := []struct {
+		expr      string
+		value     float64
+		variables []string
+	}{
+		{expr: "5", value: 5, variables: []string{}},
+		{expr: "1 + 2 * 3", value: 7, variables: []string{}},
+		{expr: "(1 + 2) * 3", value: 9, variables: []string{}},
+		{expr: "10 - 4 - 3", value: 3, variables: []string{}},
+		{expr: "-current + 12", value: 2, variables: []string{"current"}},
+		{expr: "7 % 4", value: 3, variables: []string{}},
+		{expr: "max(current, 20)", value: 20, variables: []string{"current"}},
+		{expr: "min(current, hpa.max, 15)", value: 10, variables: []string{"current", "hpa.max"}},
+		{expr: "ceil(current * 1.25)", value: 13, variables: []string{"current"}},
+		{expr: "floor(hpa.max / 4)", value: 7, variables: []string{"hpa.max"}},
+		{expr: "round(2.5) + abs(-1)", value: 4, variables: []string{}},
+		{expr: "spec.parallelism * current + current", value: 50, variables: []string{"spec.parallelism", "current"}},
+	}
+	for _, c := range cases {
+		e, err := ParseExpr(c.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.expr, err)
+			continue
+		}
+		v, err := e.Eval(env)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.expr, err)
+			continue
+		}
+		if v != c.value {
+			t.Errorf("%s: expected %v, got %v", c.expr, c.value, v)
+		}
+		if variables := ExprVariables(e); !reflect.DeepEqual(variables, c.variables) {
+			t.Errorf("%s: expected variables %v, got %v", c.expr, c.variables, variables)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: "", err: "unexpected end"},
+		{expr: "1 +", err: "unexpected end"},
+		{expr: "(1 + 2", err: "missing )"},
+		{expr: "1 2", err: "unexpected"},
+		{expr: "1.2.3", err: "invalid number"},
+		{expr: "sqrt(4)", err: "unknown function"},
+		{expr: "max(1,)", err: "missing argument"},
+		{expr: "current.", err: "invalid variable"},
+		{expr: "hpa..max", err: "invalid variable"},
+		{expr: "1 & 2", err: "unexpected"},
+	}
+	for _, c := range cases {
+		_, err := ParseExpr(c.expr)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: expected error containing %q, got %v", c.expr, c.err, err)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, s := range []string{"current / 0", "current % (1 - 1)", "unknown + 1"} {
+		e, err := ParseExpr(s)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", s, err)
+		}
+		if _, err := e.Eval(mapEnv{"current": 1}); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/controller"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	log "k8s.io/klog/v2"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strings"
+)
+
+// ApproveVerb is the verb on cronhorizontalpodautoscalers granted to the approvers of the jobs.
+const ApproveVerb = "approve"
+
+// ApprovalAuthorizer rejects the approvals added by the users who are not allowed to approve the jobs of the cronHPA.
+type ApprovalAuthorizer struct {
+	client client.Client
+}
+
+func NewApprovalAuthorizer(client client.Client) *ApprovalAuthorizer {
+	return &ApprovalAuthorizer{client: client}
+}
+
+func (a *ApprovalAuthorizer) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := json.Unmarshal(req.Object.Raw, instance); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	old := &v1beta1.CronHorizontalPodAutoscaler{}
+	if req.Operation == admissionv1beta1.Update {
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	approvals := newApprovals(old.Annotations, instance.Annotations)
+	if len(approvals) == 0 {
+		return admission.Allowed("")
+	}
+
+	attr := &authorizationv1.ResourceAttributes{
+		Namespace: req.Namespace,
+		Verb:      ApproveVerb,
+		Group:     v1beta1.SchemeGroupVersion.Group,
+		Resource:  "cronhorizontalpodautoscalers",
+		Name:      instance.Name,
+	}
+	allowed, reason, err := review(ctx, a.client, req, attr)
+	if err != nil {
+		log.Errorf("Failed to review access of %s to %s,because of %v", req.UserInfo.Username, describe(attr), err)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !allowed {
+		msg := fmt.Sprintf("user %s is not allowed to approve jobs %s, %s is required", req.UserInfo.Username, strings.Join(approvals, ","), describe(attr))
+		if reason != "" {
+			msg = msg + ", " + reason
+		}
+		return admission.Denied(msg)
+	}
+	return admission.Allowed("")
+}
+
+// newApprovals returns the jobs added to the approve annotation.
+func newApprovals(old, current map[string]string) []string {
+	approved := controller.ApprovedJobs(old)
+	approvals := make([]string, 0)
+	for _, name := range controller.ApprovedJobs(current) {
+		found := false
+		for _, o := range approved {
+			if o == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			approvals = append(approvals, name)
+		}
+	}
+	return approvals
+}
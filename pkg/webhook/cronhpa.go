@@ -0,0 +1,374 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook checks at admission time that the author of a cronHPA could change its targets,
+// that the cronHPA follows the CronHPAPolicies and that the approver of its jobs is allowed to approve,
+// and records the author and the approver in annotations.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/controller"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	log "k8s.io/klog/v2"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strings"
+)
+
+const (
+	MutatePath   = "/mutate-autoscaling-alibabacloud-com-v1beta1-cronhorizontalpodautoscaler"
+	ValidatePath = "/validate-autoscaling-alibabacloud-com-v1beta1-cronhorizontalpodautoscaler"
+
+	// user who changed the spec of the cronHPA the last time, the controller impersonates it with --impersonateAuthor.
+	AuthorAnnotation       = controller.AuthorAnnotation
+	AuthorGroupsAnnotation = controller.AuthorGroupsAnnotation
+)
+
+// AuthorAnnotator records the user changing the spec in annotations.
+// The annotations are kept when only the metadata or status is changed, e.g. by the controller.
+type AuthorAnnotator struct{}
+
+func (a *AuthorAnnotator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := json.Unmarshal(req.Object.Raw, instance); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	author, groups := req.UserInfo.Username, strings.Join(req.UserInfo.Groups, ",")
+	old := &v1beta1.CronHorizontalPodAutoscaler{}
+	if req.Operation == admissionv1beta1.Update {
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, instance.Spec) {
+			author, groups = old.Annotations[AuthorAnnotation], old.Annotations[AuthorGroupsAnnotation]
+		}
+	}
+	// only the user adding an approval is recorded as the approver, it's removed together with the approvals.
+	approvedBy := ""
+	if len(newApprovals(old.Annotations, instance.Annotations)) != 0 {
+		approvedBy = req.UserInfo.Username
+	} else if len(controller.ApprovedJobs(instance.Annotations)) != 0 {
+		approvedBy = old.Annotations[controller.ApprovedByAnnotation]
+	}
+
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	setOrDelete(annotations, AuthorAnnotation, author)
+	setOrDelete(annotations, AuthorGroupsAnnotation, groups)
+	setOrDelete(annotations, controller.ApprovedByAnnotation, approvedBy)
+	instance.SetAnnotations(annotations)
+
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, data)
+}
+
+func setOrDelete(m map[string]string, key, value string) {
+	if value == "" {
+		delete(m, key)
+		return
+	}
+	m[key] = value
+}
+
+// TargetAuthorizer rejects the cronHPA if the requesting user could not change one of its targets.
+type TargetAuthorizer struct {
+	client client.Client
+	mapper apimeta.RESTMapper
+}
+
+func NewTargetAuthorizer(client client.Client, mapper apimeta.RESTMapper) *TargetAuthorizer {
+	return &TargetAuthorizer{client: client, mapper: mapper}
+}
+
+func (a *TargetAuthorizer) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := json.Unmarshal(req.Object.Raw, instance); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if req.Operation == admissionv1beta1.Update {
+		old := &v1beta1.CronHorizontalPodAutoscaler{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// status updates of the controller
+		if equality.Semantic.DeepEqual(old.Spec, instance.Spec) {
+			return admission.Allowed("")
+		}
+	}
+
+	attributes, err := a.targetAttributes(ctx, instance, req.Namespace)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	for _, attr := range attributes {
+		allowed, reason, err := review(ctx, a.client, req, attr)
+		if err != nil {
+			log.Errorf("Failed to review access of %s to %s,because of %v", req.UserInfo.Username, describe(attr), err)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if !allowed {
+			msg := fmt.Sprintf("user %s is not allowed to %s", req.UserInfo.Username, describe(attr))
+			if reason != "" {
+				msg = msg + ", " + reason
+			}
+			return admission.Denied(msg)
+		}
+	}
+	return admission.Allowed("")
+}
+
+// review checks the access of the requesting user by a SubjectAccessReview.
+func review(ctx context.Context, c client.Client, req admission.Request, attr *authorizationv1.ResourceAttributes) (bool, string, error) {
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attr,
+			User:               req.UserInfo.Username,
+			Groups:             req.UserInfo.Groups,
+			UID:                req.UserInfo.UID,
+			Extra:              extra,
+		},
+	}
+	if err := c.Create(ctx, sar); err != nil {
+		return false, "", err
+	}
+	return sar.Status.Allowed, sar.Status.Reason, nil
+}
+
+// targetAttributes returns the access needed by the jobs, including the jobs of the profile. The targets in remote
+// clusters and outside of the cluster are skipped, but the Secrets used to reach them are checked.
+func (a *TargetAuthorizer) targetAttributes(ctx context.Context, instance *v1beta1.CronHorizontalPodAutoscaler, namespace string) ([]*authorizationv1.ResourceAttributes, error) {
+	spec := instance.Spec
+	attributes := make([]*authorizationv1.ResourceAttributes, 0)
+	add := func(attrs ...*authorizationv1.ResourceAttributes) {
+	next:
+		for _, attr := range attrs {
+			for _, existing := range attributes {
+				if *existing == *attr {
+					continue next
+				}
+			}
+			attributes = append(attributes, attr)
+		}
+	}
+	secret := func(name string) {
+		add(&authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "get", Resource: "secrets", Name: name})
+	}
+
+	jobs, err := controller.ResolveJobs(a.client, instance)
+	if err != nil {
+		return nil, err
+	}
+	targets := []v1beta1.ScaleTargetRef{spec.ScaleTargetRef}
+	if spec.Distribution != nil {
+		targets = targets[:0]
+		for _, t := range spec.Distribution.Targets {
+			targets = append(targets, t.ScaleTargetRef)
+		}
+	}
+	for _, target := range targets {
+		if target.Cluster != nil {
+			secret(target.Cluster.SecretName)
+		}
+	}
+	if spec.External != nil && spec.External.TLS != nil && spec.External.TLS.SecretName != "" {
+		secret(spec.External.TLS.SecretName)
+	}
+
+	scaleJobs, patchJobs := false, false
+	for _, job := range jobs {
+		// the balloon pods of the prewarm
+		if job.Prewarm != nil && spec.ScaleTargetRef.Cluster == nil {
+			add(&authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "create", Resource: "pods"})
+		}
+		// the DaemonSet pulling the images
+		if job.PrepullImages != nil && spec.ScaleTargetRef.Cluster == nil {
+			add(&authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "create", Group: "apps", Resource: "daemonsets"})
+		}
+		switch job.Action {
+		case "", v1beta1.ScaleAction:
+			scaleJobs = true
+		case v1beta1.SleepAction, v1beta1.WakeAction:
+			// every scalable object in the namespace
+			add(&authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "update", Group: "*", Resource: "*", Subresource: "scale"})
+		case v1beta1.PatchAction:
+			if job.Patch != nil && job.Patch.Target != nil {
+				if job.Patch.Target.Cluster != nil {
+					secret(job.Patch.Target.Cluster.SecretName)
+				}
+				attr, err := a.patchAttributes(*job.Patch.Target, namespace)
+				if err != nil {
+					return nil, err
+				}
+				if attr != nil {
+					add(attr)
+				}
+			} else {
+				patchJobs = true
+			}
+		case v1beta1.VPAAction:
+			if job.VPA != nil {
+				add(&authorizationv1.ResourceAttributes{Namespace: namespace, Verb: "patch", Group: "autoscaling.k8s.io", Resource: "verticalpodautoscalers", Name: job.VPA.Name})
+			}
+		}
+	}
+
+	if patchJobs {
+		attr, err := a.patchAttributes(spec.ScaleTargetRef, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if attr != nil {
+			add(attr)
+		}
+	}
+	if !scaleJobs || spec.External != nil {
+		return attributes, nil
+	}
+	for _, target := range targets {
+		attrs, err := a.scaleAttributes(ctx, target, namespace)
+		if err != nil {
+			return nil, err
+		}
+		add(attrs...)
+	}
+	return attributes, nil
+}
+
+// scaleAttributes returns update of the scale subresource, update of the HPA and the scale subresource of its
+// target, or patch of the objects scaled by patching.
+func (a *TargetAuthorizer) scaleAttributes(ctx context.Context, target v1beta1.ScaleTargetRef, namespace string) ([]*authorizationv1.ResourceAttributes, error) {
+	if target.Cluster != nil {
+		return nil, nil
+	}
+	mapping, err := a.mappingOf(target)
+	if err != nil {
+		return nil, err
+	}
+	attr := &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Group:     mapping.Resource.Group,
+		Resource:  mapping.Resource.Resource,
+		Name:      target.Name,
+	}
+	switch {
+	case target.Kind == "HorizontalPodAutoscaler":
+		attr.Verb = "update"
+		// the bounds of the HPA scale its target
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+		err := a.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, hpa)
+		if errors.IsNotFound(err) {
+			return []*authorizationv1.ResourceAttributes{attr}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get HorizontalPodAutoscaler %s,because of %v", target.Name, err)
+		}
+		ref := hpa.Spec.ScaleTargetRef
+		hpaTarget, err := a.mappingOf(v1beta1.ScaleTargetRef{ApiVersion: ref.APIVersion, Kind: ref.Kind, Name: ref.Name})
+		if err != nil {
+			return nil, err
+		}
+		return []*authorizationv1.ResourceAttributes{attr, {
+			Namespace:   namespace,
+			Verb:        "update",
+			Group:       hpaTarget.Resource.Group,
+			Resource:    hpaTarget.Resource.Resource,
+			Subresource: "scale",
+			Name:        ref.Name,
+		}}, nil
+	case target.ReplicasPath != "" || isPatchScaled(mapping.GroupVersionKind.GroupKind()):
+		attr.Verb = "patch"
+	default:
+		attr.Verb = "update"
+		attr.Subresource = "scale"
+	}
+	return []*authorizationv1.ResourceAttributes{attr}, nil
+}
+
+func (a *TargetAuthorizer) patchAttributes(target v1beta1.ScaleTargetRef, namespace string) (*authorizationv1.ResourceAttributes, error) {
+	if target.Cluster != nil {
+		return nil, nil
+	}
+	mapping, err := a.mappingOf(target)
+	if err != nil {
+		return nil, err
+	}
+	return &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "patch",
+		Group:     mapping.Resource.Group,
+		Resource:  mapping.Resource.Resource,
+		Name:      target.Name,
+	}, nil
+}
+
+func (a *TargetAuthorizer) mappingOf(target v1beta1.ScaleTargetRef) (*apimeta.RESTMapping, error) {
+	gv, err := schema.ParseGroupVersion(target.ApiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion %s of %s %s,because of %v", target.ApiVersion, target.Kind, target.Name, err)
+	}
+	mapping, err := a.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: target.Kind}, gv.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource of %s %s,because of %v", target.Kind, target.Name, err)
+	}
+	return mapping, nil
+}
+
+// isPatchScaled returns true for the autoscalers whose bounds are patched by the controller.
+func isPatchScaled(gk schema.GroupKind) bool {
+	return (gk.Group == "keda.sh" && gk.Kind == "ScaledObject") ||
+		(gk.Group == "serving.knative.dev" && (gk.Kind == "Service" || gk.Kind == "Revision"))
+}
+
+func describe(attr *authorizationv1.ResourceAttributes) string {
+	resource := attr.Resource
+	if attr.Group != "" {
+		resource = resource + "." + attr.Group
+	}
+	if attr.Subresource != "" {
+		resource = resource + "/" + attr.Subresource
+	}
+	if attr.Name != "" {
+		return fmt.Sprintf("%s %s %s in %s namespace", attr.Verb, resource, attr.Name, attr.Namespace)
+	}
+	return fmt.Sprintf("%s %s in %s namespace", attr.Verb, resource, attr.Namespace)
+}
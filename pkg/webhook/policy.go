@@ -0,0 +1,75 @@
+/*
+Copyright 2018 zhongwei.lzw@alibaba-inc.com.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/apis/autoscaling/v1beta1"
+	"github.com/AliyunContainerService/kubernetes-cronhpa-controller/pkg/controller"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+	log "k8s.io/klog/v2"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PolicyValidator rejects the cronHPA violating the CronHPAPolicies of its namespace.
+type PolicyValidator struct {
+	client        client.Client
+	mapper        apimeta.RESTMapper
+	dynamicClient dynamic.Interface
+}
+
+func NewPolicyValidator(client client.Client, mapper apimeta.RESTMapper, dynamicClient dynamic.Interface) *PolicyValidator {
+	return &PolicyValidator{client: client, mapper: mapper, dynamicClient: dynamicClient}
+}
+
+func (v *PolicyValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+	instance := &v1beta1.CronHorizontalPodAutoscaler{}
+	if err := json.Unmarshal(req.Object.Raw, instance); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if req.Operation == admissionv1beta1.Update {
+		old := &v1beta1.CronHorizontalPodAutoscaler{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// status updates of the controller
+		if equality.Semantic.DeepEqual(old.Spec, instance.Spec) {
+			return admission.Allowed("")
+		}
+	}
+	if instance.Namespace == "" {
+		instance.Namespace = req.Namespace
+	}
+
+	if err := controller.CheckPolicies(ctx, v.client, v.mapper, v.dynamicClient, instance); err != nil {
+		if _, ok := err.(*controller.PolicyViolation); ok {
+			return admission.Denied(err.Error())
+		}
+		log.Errorf("Failed to check policies of cronHPA %s in %s namespace,because of %v", instance.Name, instance.Namespace, err)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.Allowed("")
+}